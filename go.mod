@@ -10,6 +10,7 @@ require (
 	github.com/sergi/go-diff v1.3.1
 	github.com/stretchr/testify v1.4.0
 	github.com/ungerik/go-dry v0.0.0-20230805093253-df9da4cd3437
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
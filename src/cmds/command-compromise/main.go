@@ -5,11 +5,8 @@ package main
 import (
 	"flag"
 	"fmt"
-	"github.com/omakoto/compromise/src/compromise"
-	"github.com/omakoto/compromise/src/compromise/compfunc"
 	"github.com/omakoto/compromise/src/compromise/compmain"
 	"github.com/omakoto/go-common/src/common"
-	"github.com/omakoto/go-common/src/shell"
 	"os"
 	"strconv"
 )
@@ -20,15 +17,6 @@ var (
 	command  = flag.String("c", "", "Command that generates the candidates. Current token is set to $1.")
 )
 
-func init() {
-	compfunc.Register("takeCandidateFromCommand", takeCandidateFromCommand)
-}
-
-func takeCandidateFromCommand(ctx compromise.CompleteContext, arg string) compromise.CandidateList {
-	tok := ctx.WordAtCursor(0)
-	return compfunc.BuildCandidateListFromCommand(arg + " " + shell.Escape(tok))
-}
-
 func main() {
 	compmain.MaybeHandleCompletion()
 	flag.Usage = func() {
@@ -47,8 +35,8 @@ func main() {
 		spec += "    @cand takeFile\n"
 	}
 	if *command != "" {
-		spec += "    @cand takeCandidateFromCommand "
-		spec += strconv.Quote(*command)
+		spec += "    @exec "
+		spec += strconv.Quote(*command + ` "$1"`)
 		spec += "\n"
 	}
 
@@ -0,0 +1,83 @@
+package main
+
+// A small client of the completion daemon, which install scripts run instead of a completion
+// executable when COMPROMISE_DAEMON=1, so that each TAB doesn't need to start the executable.
+//
+// Usage: compromise-client EXECUTABLE --compromise-complete SPEC-FILE ARGS...
+//
+// If the daemon isn't available, it runs EXECUTABLE with the rest of the arguments instead, which
+// also starts the daemon for later requests.
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compclient"
+	"io"
+	"os"
+	"os/exec"
+)
+
+func main() {
+	os.Exit(realMain(os.Args[1:]))
+}
+
+func realMain(args []string) int {
+	if len(args) < 4 {
+		fmt.Fprintf(os.Stderr, "Usage: %s EXECUTABLE --compromise-complete SPEC-FILE ARGS...\n", compclient.ClientName)
+		return 1
+	}
+	executable, option, specFile, rest := args[0], args[1], args[2], args[3:]
+
+	spec, err := readSpec(specFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: unable to read from %s: %s\n", compclient.ClientName, specFile, err)
+		return 1
+	}
+
+	if res, err := compclient.Complete(executable, spec, rest); err == nil && !res.Declined {
+		return res.Status
+	}
+	return runExecutable(executable, option, spec, rest)
+}
+
+// readSpec reads a spec from a file, or from stdin if path is "-".
+func readSpec(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	return string(data), err
+}
+
+// runExecutable performs a completion with the executable. The spec has been read already, so
+// it's passed through a pipe.
+func runExecutable(executable, option, spec string, args []string) int {
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", compclient.ClientName, err)
+		return 1
+	}
+	cmd := exec.Command(executable, append([]string{option, "/dev/fd/3"}, args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{rd}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", compclient.ClientName, err)
+		return 1
+	}
+	rd.Close()
+	go func() {
+		io.WriteString(wr, spec)
+		wr.Close()
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			return e.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", compclient.ClientName, err)
+		return 1
+	}
+	return 0
+}
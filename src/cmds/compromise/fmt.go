@@ -0,0 +1,94 @@
+package main
+
+// The fmt subcommand, which formats specs, either in spec files, or in "var spec = ..." in Go files.
+
+import (
+	"flag"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfmt"
+	"github.com/omakoto/go-common/src/common"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fmtOptions holds the flags of the fmt subcommand.
+type fmtOptions struct {
+	write bool
+	diff  bool
+	list  bool
+}
+
+func formatSpecs(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	opts := fmtOptions{}
+	fs.BoolVar(&opts.write, "w", false, "Write result to the source file instead of stdout")
+	fs.BoolVar(&opts.diff, "d", false, "Display diffs instead of rewriting files, and exit with 1 if any file needs formatting")
+	fs.BoolVar(&opts.list, "l", false, "List files whose formatting differs")
+	fs.Usage = usage
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if opts.write {
+			common.Fatal("-w can't be used with stdin")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		common.Check(err, "unable to read from stdin")
+		if !formatFile("<stdin>", data, opts) {
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, file := range fs.Args() {
+		data, err := os.ReadFile(file)
+		common.Checkf(err, "unable to read from %s", file)
+		if !formatFile(file, data, opts) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile formats a file, and returns false if the file needs formatting in the diff mode,
+// or it can't be formatted.
+func formatFile(file string, data []byte, opts fmtOptions) bool {
+	var formatted []byte
+	if filepath.Ext(file) == ".go" {
+		res, err := compfmt.FormatGoSource(file, data)
+		if err != nil {
+			common.Warnf("%s", err)
+			return false
+		}
+		formatted = res
+	} else {
+		d := compromise.ExtractDirectives(string(data)).SetFilename(file)
+		res, err := compfmt.Format(string(data), d)
+		if err != nil {
+			common.Warnf("%s", err)
+			return false
+		}
+		formatted = []byte(res)
+	}
+
+	changed := string(data) != string(formatted)
+	if opts.list && changed {
+		fmt.Println(file)
+	}
+	if opts.diff {
+		fmt.Print(compfmt.Diff(file, string(data), string(formatted)))
+		return !changed
+	}
+	if opts.write {
+		if changed {
+			common.Checkf(os.WriteFile(file, formatted, 0644), "unable to write to %s", file)
+		}
+		return true
+	}
+	if !opts.list {
+		os.Stdout.Write(formatted)
+	}
+	return true
+}
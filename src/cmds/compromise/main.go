@@ -0,0 +1,116 @@
+package main
+
+// Tools for writing specs.
+
+import (
+	"flag"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compgen"
+	"github.com/omakoto/compromise/src/compromise/compimport"
+	"github.com/omakoto/compromise/src/compromise/compstruct"
+	"github.com/omakoto/go-common/src/common"
+	"os"
+	"path/filepath"
+)
+
+func usage() {
+	name := common.MustGetBinName()
+	fmt.Fprintf(os.Stderr, "Usage: %s gen-spec [-c COMMAND] -- CMD [ARGS...]\n", name)
+	fmt.Fprintf(os.Stderr, "  Run CMD, e.g. \"git --help\", and print a spec from the help in the output.\n")
+	fmt.Fprintf(os.Stderr, "  Use \"sh -c 'CMD --help 2>&1'\" for a command that prints the help to stderr.\n")
+	fmt.Fprintf(os.Stderr, "Usage: %s import [-format fish|bash] FILE\n", name)
+	fmt.Fprintf(os.Stderr, "  Print a spec from a fish or bash completion script. The format defaults to fish\n")
+	fmt.Fprintf(os.Stderr, "  for files ending with .fish, and bash for others.\n")
+	fmt.Fprintf(os.Stderr, "Usage: %s convert -to text|json|yaml FILE\n", name)
+	fmt.Fprintf(os.Stderr, "  Print a spec, either a text spec or a JSON or YAML spec, in another format.\n")
+	fmt.Fprintf(os.Stderr, "Usage: %s fmt [-w] [-d] [-l] [FILES...]\n", name)
+	fmt.Fprintf(os.Stderr, "  Format specs. Files ending with .go are Go files, and \"var spec = ...\" in them\n")
+	fmt.Fprintf(os.Stderr, "  will be formatted. Other files are spec files. Reads a spec file from stdin if no\n")
+	fmt.Fprintf(os.Stderr, "  files are given. -w writes the result to the files, -d prints diffs and fails if any\n")
+	fmt.Fprintf(os.Stderr, "  file needs formatting, and -l lists files whose formatting differs.\n")
+	os.Exit(1)
+}
+
+func main() {
+	common.RunAndExit(realMain)
+}
+
+func realMain() int {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "gen-spec":
+		return genSpec(os.Args[2:])
+	case "import":
+		return importScript(os.Args[2:])
+	case "convert":
+		return convert(os.Args[2:])
+	case "fmt":
+		return formatSpecs(os.Args[2:])
+	}
+	usage()
+	return 1
+}
+
+func genSpec(args []string) int {
+	fs := flag.NewFlagSet("gen-spec", flag.ExitOnError)
+	command := fs.String("c", "", "Command name for the spec, instead of the base name of CMD")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		usage()
+	}
+
+	fmt.Print(compgen.FromCommand(*command, fs.Args()))
+	return 0
+}
+
+func importScript(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "Format of the script, either fish or bash")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	file := fs.Arg(0)
+	data, err := os.ReadFile(file)
+	common.Checkf(err, "unable to read from %s", file)
+
+	if *format == "" {
+		*format = "bash"
+		if filepath.Ext(file) == ".fish" {
+			*format = "fish"
+		}
+	}
+	switch *format {
+	case "fish":
+		fmt.Print(compimport.FromFish(string(data)))
+	case "bash":
+		fmt.Print(compimport.FromBash(string(data)))
+	default:
+		usage()
+	}
+	return 0
+}
+
+func convert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := fs.String("to", "", "Format to convert to, either text, json or yaml")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() != 1 || *to == "" {
+		usage()
+	}
+	file := fs.Arg(0)
+	data, err := os.ReadFile(file)
+	common.Checkf(err, "unable to read from %s", file)
+
+	d := compromise.ExtractDirectives(string(data)).SetFilename(file)
+	converted, err := compstruct.Convert(string(data), d, *to)
+	common.Checkf(err, "unable to convert %s", file)
+	fmt.Print(converted)
+	return 0
+}
@@ -30,6 +30,21 @@ type Candidate interface {
 	// Help returns a help string for a candidate.
 	Help() string
 
+	// File returns whether a candidate is a filename (or a directory name). Shells that
+	// handle filenames specially (e.g. zsh) use it instead of checking the file system.
+	File() bool
+
+	// Score returns how well a candidate matched the word on the command line, which is set by
+	// the last GetCandidate(). The higher the better.
+	Score() int
+
+	// MatchScore returns whether a candidate matches a word with a Matcher, and if so, a score.
+	MatchScore(m Matcher, word string) (score int, ok bool)
+
+	// Group returns a group label of a candidate, e.g. "options", "commands". Shells that can
+	// show candidates in groups use it. Empty if not in any group.
+	Group() string
+
 	Serialize(wr *bufio.Writer)
 
 	Deserialize(rd *bufio.Reader) error
@@ -40,6 +55,9 @@ type Candidate interface {
 	SetContinues(continues bool) Candidate
 	SetForce(force bool) Candidate
 	SetHelp(help string) Candidate
+	SetFile(file bool) Candidate
+	SetGroup(group string) Candidate
+	SetScore(score int) Candidate
 }
 
 type candidate struct {
@@ -49,6 +67,9 @@ type candidate struct {
 	continues bool
 	force     bool
 	help      string
+	file      bool
+	group     string
+	score     int
 }
 
 var _ Candidate = (*candidate)(nil)
@@ -61,6 +82,7 @@ const (
 	continues
 	force
 	help
+	file
 )
 
 func NewCandidate() Candidate {
@@ -68,7 +90,7 @@ func NewCandidate() Candidate {
 }
 
 func (c *candidate) String() string {
-	return fmt.Sprintf("value=%q, raw=%v, continues=%v, hidden=%v, force=%v, help=%q", c.value, c.raw, c.continues, c.hidden, c.force, c.help)
+	return fmt.Sprintf("value=%q, raw=%v, continues=%v, hidden=%v, force=%v, help=%q, file=%v, group=%q", c.value, c.raw, c.continues, c.hidden, c.force, c.help, c.file, c.group)
 }
 
 func (c *candidate) Value() string {
@@ -95,6 +117,18 @@ func (c *candidate) Help() string {
 	return c.help
 }
 
+func (c *candidate) File() bool {
+	return c.file
+}
+
+func (c *candidate) Group() string {
+	return c.group
+}
+
+func (c *candidate) Score() int {
+	return c.score
+}
+
 func (c *candidate) SetValue(value string) Candidate {
 	c.value = value
 	return c
@@ -125,8 +159,29 @@ func (c *candidate) SetHelp(help string) Candidate {
 	return c
 }
 
+func (c *candidate) SetFile(file bool) Candidate {
+	c.file = file
+	return c
+}
+
+func (c *candidate) SetGroup(group string) Candidate {
+	c.group = group
+	return c
+}
+
+func (c *candidate) SetScore(score int) Candidate {
+	c.score = score
+	return c
+}
+
+func (c *candidate) MatchScore(m Matcher, word string) (int, bool) {
+	score, ok := m.Match(c.value, word)
+	return score, ok || c.Force()
+}
+
 func (c *candidate) Matches(prefix string) bool {
-	return c.Force() || StringMatches(c.value, prefix)
+	_, ok := c.MatchScore(DefaultMatcher, prefix)
+	return ok
 }
 
 func (c *candidate) MatchesFully(target string) bool {
@@ -134,7 +189,11 @@ func (c *candidate) MatchesFully(target string) bool {
 }
 
 func (c *candidate) GetCandidate(prefix string) []Candidate {
-	if c.Matches(prefix) {
+	return c.GetCandidateWithMatcher(DefaultMatcher, prefix)
+}
+
+func (c *candidate) GetCandidateWithMatcher(m Matcher, prefix string) []Candidate {
+	if _, ok := c.MatchScore(m, prefix); ok {
 		return []Candidate{c}
 	}
 	return nil
@@ -145,6 +204,8 @@ func (c *candidate) Serialize(wr *bufio.Writer) {
 	wr.WriteByte(0)
 	wr.WriteString(c.help)
 	wr.WriteByte(0)
+	wr.WriteString(c.group)
+	wr.WriteByte(0)
 
 	var v byte
 	if c.raw {
@@ -159,6 +220,9 @@ func (c *candidate) Serialize(wr *bufio.Writer) {
 	if c.force {
 		v |= force
 	}
+	if c.file {
+		v |= file
+	}
 	wr.WriteByte(v)
 }
 
@@ -169,6 +233,9 @@ func (c *candidate) Deserialize(rd *bufio.Reader) error {
 	s, _ = rd.ReadString(0)
 	c.help = s[0 : len(s)-1]
 
+	s, _ = rd.ReadString(0)
+	c.group = s[0 : len(s)-1]
+
 	v, err := rd.ReadByte()
 	if (v & raw) != 0 {
 		c.raw = true
@@ -182,6 +249,9 @@ func (c *candidate) Deserialize(rd *bufio.Reader) error {
 	if (v & force) != 0 {
 		c.force = true
 	}
+	if (v & file) != 0 {
+		c.file = true
+	}
 	return err
 }
 
@@ -2,12 +2,12 @@ package compromise
 
 type CandidateListGenerator func(ctx CompleteContext, args []string) CandidateList
 
-func filter(candidates []Candidate, prefix string) []Candidate {
+func filter(candidates []Candidate, m Matcher, prefix string) []Candidate {
 	ret := make([]Candidate, 0)
 
 	for _, c := range candidates {
-		if c.Matches(prefix) {
-			ret = append(ret, c)
+		if score, ok := c.MatchScore(m, prefix); ok {
+			ret = append(ret, c.SetScore(score))
 		}
 	}
 	return ret
@@ -22,6 +22,25 @@ type CandidateList interface {
 	MatchesFully(word string) bool
 }
 
+// MatcherCandidateList is a CandidateList that can match candidates with a Matcher other than
+// the default one, e.g. for fuzzy matching. Lists that don't implement it only return candidates
+// that start with the prefix.
+type MatcherCandidateList interface {
+	CandidateList
+
+	// GetCandidateWithMatcher returns the candidates that match a prefix with a Matcher.
+	GetCandidateWithMatcher(m Matcher, prefix string) []Candidate
+}
+
+// GetCandidates returns the candidates in a list that match a prefix with a Matcher, if the list
+// supports it.
+func GetCandidates(list CandidateList, m Matcher, prefix string) []Candidate {
+	if ml, ok := list.(MatcherCandidateList); ok {
+		return ml.GetCandidateWithMatcher(m, prefix)
+	}
+	return list.GetCandidate(prefix)
+}
+
 // OpenCandidates generates an "open" CandidateList from a given list of Candidate's.
 // it's "open" because candidates are considered to be non-exhaustive and any strings are
 // considered to be potential matches.
@@ -46,10 +65,14 @@ type staticCandidates struct {
 	strict     bool
 }
 
-var _ CandidateList = (*staticCandidates)(nil)
+var _ MatcherCandidateList = (*staticCandidates)(nil)
 
 func (s *staticCandidates) GetCandidate(prefix string) []Candidate {
-	return filter(s.candidates, prefix)
+	return s.GetCandidateWithMatcher(DefaultMatcher, prefix)
+}
+
+func (s *staticCandidates) GetCandidateWithMatcher(m Matcher, prefix string) []Candidate {
+	return filter(s.candidates, m, prefix)
 }
 
 func (s *staticCandidates) Matches(word string) bool {
@@ -80,10 +103,14 @@ type lazyCandidates struct {
 	generator func(prefix string) []Candidate
 }
 
-var _ CandidateList = (*lazyCandidates)(nil)
+var _ MatcherCandidateList = (*lazyCandidates)(nil)
 
 func (s *lazyCandidates) GetCandidate(prefix string) []Candidate {
-	return filter(s.generator(prefix), prefix)
+	return s.GetCandidateWithMatcher(DefaultMatcher, prefix)
+}
+
+func (s *lazyCandidates) GetCandidateWithMatcher(m Matcher, prefix string) []Candidate {
+	return filter(s.generator(prefix), m, prefix)
 }
 
 func (s *lazyCandidates) Matches(word string) bool {
@@ -16,6 +16,7 @@ const (
 	TokenLiteral
 	TokenLabel
 	TokenHelp
+	TokenComment // Only returned when the tokenizer is keeping comments.
 
 	// This is used as an expected type.
 	TokenAny
@@ -26,6 +27,7 @@ var tokenTypeNames = []string{
 	"Literal",
 	"Label",
 	"Help",
+	"Comment",
 	"Any",
 }
 
@@ -66,6 +68,12 @@ const (
 	NodeGoCall
 	NodeCandidate
 	NodeLiteral
+	NodeGroup
+	NodeIf
+	NodeSet
+	NodeCapture
+	NodeExec
+	NodeLines
 )
 
 var nodeTypeNames = []string{
@@ -83,6 +91,12 @@ var nodeTypeNames = []string{
 	"GoCall",
 	"Candidate",
 	"Literal",
+	"Group",
+	"If",
+	"Set",
+	"Capture",
+	"Exec",
+	"Lines",
 }
 
 // Node implements a tree of Tokens. This tree is a basic AST of the completion spec.
@@ -103,6 +117,9 @@ type Node struct {
 	nodeType  int
 	selfToken *Token
 
+	// Namespace of the spec fragment that the node is defined in. "" for the main spec.
+	namespace string
+
 	// Parameters
 	literal  *Token
 	command  *Token
@@ -110,7 +127,23 @@ type Node struct {
 	funcName *Token
 	label    *Token
 	help     *Token
+	group    *Token
 	args     []*Token
+	params   []*Token
+
+	// Condition of @if, e.g. "env" or "!file", whose operands are in args.
+	condition *Token
+
+	// For an instance of a parameterized label, the original label.
+	template *Node
+
+	// Set by @once and @exclusive on a branch in a @switchloop.
+	once      bool
+	exclusive *Token
+
+	// Set by @joined and @bundle on a literal flag.
+	joined bool
+	bundle bool
 
 	// Used to detect infinity loop.
 	lastVisitedWordIndex int
@@ -135,7 +168,7 @@ func (n *Node) SelfToken() *Token {
 
 func (n *Node) maxChildren() int {
 	switch n.nodeType {
-	case NodeCommand, NodeCall, NodeFinish, NodeGoCall:
+	case NodeCommand, NodeCall, NodeFinish, NodeGoCall, NodeGroup, NodeSet, NodeCapture:
 		return 0
 	}
 	return math.MaxInt32
@@ -163,7 +196,7 @@ func (n *Node) AddChild(new *Node) {
 		n.root.commandJumpTo[cmd] = new
 		n.root.targetCommands = append(n.root.targetCommands, new.command.Word)
 	case NodeLabel:
-		label := strings.ToLower(new.label.Word)
+		label := QualifyLabel(new.namespace, new.label.Word)
 		if _, ok := n.root.labels[label]; ok {
 			panic(compromise.NewSpecErrorf(new.selfToken, "Duplicate label :%s", label))
 		}
@@ -226,9 +259,43 @@ func (n *Node) Next() *Node {
 	return n.next
 }
 
-// GetLabeledNode returns the NodeLabel with a given label. Only supported by a root node.
+// Namespace returns the namespace of the spec fragment that the node is defined in.
+func (n *Node) Namespace() string {
+	return n.namespace
+}
+
+// SetNamespace sets the namespace of a node. Must be called before the node is added to a tree.
+func (n *Node) SetNamespace(namespace string) {
+	n.namespace = namespace
+}
+
+// QualifyLabel returns a label name in the global namespace, which is "namespace.label" for
+// labels in spec fragments.
+func QualifyLabel(namespace, label string) string {
+	// Arguments of a label instance, e.g. `x("a")`, are case-sensitive.
+	name, args := label, ""
+	if i := strings.IndexByte(label, '('); i >= 0 {
+		name, args = label[:i], label[i:]
+	}
+	if namespace != "" {
+		name = namespace + "." + name
+	}
+	return strings.ToLower(name) + args
+}
+
+// FindLabeledNode returns the NodeLabel with a given label as seen from node n, or nil if not
+// found. A label is first looked up in the namespace of n, and then in the global namespace, where
+// labels in other namespaces are "namespace.label".
+func (n *Node) FindLabeledNode(label string) *Node {
+	if ret, ok := n.root.labels[QualifyLabel(n.namespace, label)]; ok {
+		return ret
+	}
+	return n.root.labels[QualifyLabel("", label)]
+}
+
+// GetLabeledNode returns the NodeLabel with a given label as seen from node n.
 func (n *Node) GetLabeledNode(label string, referrer *Token) *Node {
-	if n, ok := n.labels[strings.ToLower(label)]; ok {
+	if n := n.FindLabeledNode(label); n != nil {
 		return n
 	}
 	panic(compromise.NewSpecErrorf(referrer, "undefined label :%s", label))
@@ -238,7 +305,7 @@ func (n *Node) GetLabeledNode(label string, referrer *Token) *Node {
 // for the command, taking @command's into account.
 func (n *Node) GetStartNodeForCommand(command string) *Node {
 	if commandNode, ok := n.commandJumpTo[command]; ok && commandNode.label != nil {
-		return n.GetLabeledNode(commandNode.label.Word, commandNode.command).Child()
+		return commandNode.GetLabeledNode(commandNode.label.Word, commandNode.command).Child()
 	}
 	return n.Child()
 }
@@ -293,6 +360,17 @@ func (n *Node) HelpText() string {
 	return ""
 }
 
+func (n *Node) Group() *Token {
+	return n.group
+}
+
+func (n *Node) GroupName() string {
+	if n.group != nil {
+		return n.group.Word
+	}
+	return ""
+}
+
 func (n *Node) UpdateLastVisitedWordIndex(index int) {
 	if n.lastVisitedWordIndex == index {
 		common.Panicf("Node %s already visited for index %d", n, index)
@@ -300,6 +378,15 @@ func (n *Node) UpdateLastVisitedWordIndex(index int) {
 	n.lastVisitedWordIndex = index
 }
 
+// ResetVisitStates resets the states used to detect infinity loops in the whole tree, so that
+// the tree can be executed again.
+func (n *Node) ResetVisitStates() {
+	for ; n != nil; n = n.next {
+		n.lastVisitedWordIndex = 0
+		n.child.ResetVisitStates()
+	}
+}
+
 func (n *Node) AsCandidates() []compromise.Candidate {
 	switch n.nodeType {
 	case NodeAny:
@@ -325,6 +412,68 @@ func (n *Node) AsCandidates() []compromise.Candidate {
 	}
 }
 
+// Condition returns the condition of an @if, e.g. "env" or "!file".
+func (n *Node) Condition() *Token {
+	return n.condition
+}
+
+// Params returns the parameters of a label, e.g. "$kind".
+func (n *Node) Params() []*Token {
+	return n.params
+}
+
+// Template returns the parameterized label that a label is instantiated from, or nil.
+func (n *Node) Template() *Node {
+	return n.template
+}
+
+// Once returns whether the node is a branch that's offered only once in a @switchloop.
+func (n *Node) Once() bool {
+	return n.once
+}
+
+// SetOnce marks the node as a branch that's offered only once in a @switchloop.
+func (n *Node) SetOnce() {
+	n.once = true
+}
+
+// Exclusive returns the group of mutually exclusive branches that the node is in, or nil.
+func (n *Node) Exclusive() *Token {
+	return n.exclusive
+}
+
+// SetExclusive puts the node in a group of mutually exclusive branches in a @switchloop.
+func (n *Node) SetExclusive(group *Token) {
+	n.exclusive = assertType(group, TokenLabel, "group")
+}
+
+// Joined returns whether a literal flag may have a value in the same word, i.e. "--flag=VALUE"
+// for long flags and "-fVALUE" for short flags.
+func (n *Node) Joined() bool {
+	return n.joined
+}
+
+// SetJoined allows a literal flag to have a value in the same word.
+func (n *Node) SetJoined() {
+	n.joined = true
+}
+
+// IsShortFlag returns whether a word is a short flag, such as "-a".
+func IsShortFlag(word string) bool {
+	return len(word) == 2 && word[0] == '-' && word[1] != '-'
+}
+
+// Bundle returns whether a literal short flag may be combined with other short flags in the same
+// word, e.g. "-la".
+func (n *Node) Bundle() bool {
+	return n.bundle
+}
+
+// SetBundle allows a literal short flag to be combined with other short flags.
+func (n *Node) SetBundle() {
+	n.bundle = true
+}
+
 func (n *Node) Args() []string {
 	ret := make([]string, 0, len(n.args))
 	for _, a := range n.args {
@@ -41,11 +41,28 @@ func (n *Node) dumpInner(indent string, wr *bufio.Writer, multiLine bool) *bufio
 	dumpField(n.funcName, "funcName")
 	dumpField(n.label, "label")
 	dumpField(n.help, "help")
+	dumpField(n.group, "group")
+	dumpField(n.condition, "condition")
+	dumpField(n.exclusive, "exclusive")
+	if n.once {
+		wr.WriteString(" once")
+	}
+	if n.joined {
+		wr.WriteString(" joined")
+	}
+	if n.bundle {
+		wr.WriteString(" bundle")
+	}
 
-	if len(n.args) > 0 {
-		wr.WriteString(" args=[")
+	dumpList := func(tokens []*Token, name string) {
+		if len(tokens) == 0 {
+			return
+		}
+		wr.WriteString(" ")
+		wr.WriteString(name)
+		wr.WriteString("=[")
 		first := true
-		for _, arg := range n.args {
+		for _, arg := range tokens {
 			if arg == nil {
 				continue
 			}
@@ -58,6 +75,8 @@ func (n *Node) dumpInner(indent string, wr *bufio.Writer, multiLine bool) *bufio
 		}
 		wr.WriteString("]")
 	}
+	dumpList(n.args, "args")
+	dumpList(n.params, "params")
 
 	if multiLine {
 		wr.WriteString("\n")
@@ -4,7 +4,6 @@ package compast
 
 import (
 	"github.com/omakoto/compromise/src/compromise"
-	"github.com/omakoto/compromise/src/compromise/compfunc"
 	"sync/atomic"
 )
 
@@ -52,15 +51,24 @@ func NewCommand(this, command, label *Token) *Node {
 	return n
 }
 
-func NewLabel(this, label *Token) *Node {
+func NewLabel(this, label, help *Token, params []*Token) *Node {
 	n := newNode(NodeLabel, assertType(this, TokenCommand, "this"))
 	n.label = assertType(label, TokenLabel, "label")
+	n.help = assertTypeOrNil(help, TokenHelp, "help")
+	for _, p := range params {
+		assertType(p, TokenLiteral, "params")
+	}
+	n.params = params
 	return n
 }
 
-func NewCall(this, label *Token) *Node {
+func NewCall(this, label *Token, args []*Token) *Node {
 	n := newNode(NodeCall, assertType(this, TokenCommand, "this"))
 	n.label = assertType(label, TokenLabel, "label")
+	for _, a := range args {
+		assertType(a, TokenLiteral, "args")
+	}
+	n.args = args
 	return n
 }
 
@@ -108,6 +116,12 @@ func NewSwitchLoop(this, pattern, label *Token) *Node {
 	return n
 }
 
+func NewGroup(this, group *Token) *Node {
+	n := newNode(NodeGroup, assertType(this, TokenCommand, "this"))
+	n.group = assertType(group, TokenLiteral, "group")
+	return n
+}
+
 func NewGoCall(this, funcName *Token, args []*Token) *Node {
 	return newGolangCallNode(NodeGoCall, this, funcName, args)
 }
@@ -123,11 +137,48 @@ func newGolangCallNode(nodeType int, this, funcName *Token, args []*Token) *Node
 		assertType(a, TokenLiteral, "args")
 	}
 	n.args = args
+	return n
+}
 
-	if err := compfunc.Defined(n.funcName.Word); err != nil {
-		panic(compromise.NewSpecError(funcName, err.Error()))
+func NewIf(this, condition *Token, args []*Token) *Node {
+	n := newNode(NodeIf, assertType(this, TokenCommand, "this"))
+	n.condition = assertType(condition, TokenLiteral, "condition")
+	for _, a := range args {
+		assertType(a, TokenLiteral, "args")
 	}
+	n.args = args
+	return n
+}
 
+// NewSet creates a node that stores a value in the state of the completion, whose name and value
+// are in args.
+func NewSet(this, name, value *Token) *Node {
+	n := newNode(NodeSet, assertType(this, TokenCommand, "this"))
+	n.args = []*Token{assertType(name, TokenLiteral, "name"), assertType(value, TokenLiteral, "value")}
+	return n
+}
+
+// NewCapture creates a node that stores the last matched word in the state of the completion,
+// whose name is in args.
+func NewCapture(this, name *Token) *Node {
+	n := newNode(NodeCapture, assertType(this, TokenCommand, "this"))
+	n.args = []*Token{assertType(name, TokenLiteral, "name")}
+	return n
+}
+
+// NewExec creates a node that takes a word from the output of a shell command, which is in args.
+func NewExec(this, command, help *Token) *Node {
+	n := newNode(NodeExec, assertType(this, TokenCommand, "this"))
+	n.args = []*Token{assertType(command, TokenLiteral, "command")}
+	n.help = assertTypeOrNil(help, TokenHelp, "help")
+	return n
+}
+
+// NewLines creates a node that takes a word from the lines in a file, whose path is in args.
+func NewLines(this, path, help *Token) *Node {
+	n := newNode(NodeLines, assertType(this, TokenCommand, "this"))
+	n.args = []*Token{assertType(path, TokenLiteral, "path")}
+	n.help = assertTypeOrNil(help, TokenHelp, "help")
 	return n
 }
 
@@ -0,0 +1,104 @@
+package compast
+
+// Instances of parameterized labels.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InstanceName returns the name of a label instantiated with given arguments, e.g.
+// `intent_body("activity")`.
+func InstanceName(label string, args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, strconv.Quote(a))
+	}
+	return label + "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// Instantiate adds a copy of a parameterized label to the tree, with the parameters in literals,
+// help strings and arguments replaced with given values. If the instance already exists, it just
+// returns it.
+func (n *Node) Instantiate(args []string) *Node {
+	name := InstanceName(n.label.Word, args)
+	if ret, ok := n.root.labels[QualifyLabel(n.namespace, name)]; ok {
+		return ret
+	}
+
+	// Replace longer names first, so "$a" won't replace a part of "$ab".
+	params := make([]int, len(n.params))
+	for i := range params {
+		params[i] = i
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return len(n.params[params[i]].Word) > len(n.params[params[j]].Word)
+	})
+	pairs := make([]string, 0, len(params)*2)
+	for _, i := range params {
+		pairs = append(pairs, n.params[i].Word, args[i])
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	substitute := func(t *Token) *Token {
+		if t == nil {
+			return nil
+		}
+		ret := *t
+		ret.Word = replacer.Replace(t.Word)
+		ret.RawWord = replacer.Replace(t.RawWord)
+		return &ret
+	}
+
+	label := *n.label
+	label.Word = name
+	ret := NewLabel(n.selfToken, &label, substitute(n.help), nil)
+	ret.namespace = n.namespace
+	ret.template = n
+	n.root.AddChild(ret)
+
+	for c := n.child; c != nil; c = c.next {
+		c.copyInto(ret, substitute)
+	}
+	return ret
+}
+
+// copyInto adds a deep copy of a node to a parent, with tokens that may have parameters
+// substituted.
+func (n *Node) copyInto(parent *Node, substitute func(t *Token) *Token) {
+	c := newNode(n.nodeType, n.selfToken)
+	c.namespace = n.namespace
+
+	c.literal = substitute(n.literal)
+	c.command = n.command
+	c.pattern = n.pattern
+	c.funcName = n.funcName
+	c.label = n.label
+	c.help = substitute(n.help)
+	c.group = n.group
+	c.condition = n.condition
+	c.once = n.once
+	c.exclusive = n.exclusive
+	c.joined = n.joined
+	c.bundle = n.bundle
+	for _, a := range n.args {
+		c.args = append(c.args, substitute(a))
+	}
+	if c.literal != nil {
+		c.selfToken = c.literal
+	}
+
+	// Add children after the node is added, so they'll have the root set.
+	parent.AddChild(c)
+	for child := n.child; child != nil; child = child.next {
+		child.copyInto(c, substitute)
+	}
+}
+
+// SetLabelWord changes the label that a node refers to.
+func (n *Node) SetLabelWord(label string) {
+	t := *n.label
+	t.Word = label
+	n.label = &t
+}
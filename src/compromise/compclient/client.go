@@ -0,0 +1,127 @@
+// Package compclient is the client side of the completion daemon, which doesn't depend on the rest
+// of compromise, so small binaries can use it to skip starting the completion executable.
+//
+// The client sends its stdin, stdout and stderr file descriptors, environmental variables and
+// current directory along with a request, and the daemon performs a completion with them as if it
+// was the client process.
+package compclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DaemonOption starts the daemon, when given to a completion executable.
+	DaemonOption = "compromise-daemon"
+
+	// ClientName is the name of the client command, which install scripts use when it's found
+	// in the PATH.
+	ClientName = "compromise-client"
+
+	dialTimeout = 100 * time.Millisecond
+)
+
+// Request is sent from a client to the daemon.
+type Request struct {
+	Spec string
+	Args []string
+	Env  []string
+	Cwd  string
+}
+
+// Response is sent back from the daemon to a client.
+type Response struct {
+	// Declined is set when the daemon didn't perform the completion, in which case the client
+	// needs to do it by itself.
+	Declined bool
+
+	// Exit status.
+	Status int
+}
+
+// daemonID returns a string that identifies a daemon. Each executable, with each set of
+// COMPROMISE_* environmental variables (which are only read at startup), has its own daemon.
+func daemonID(executable string) string {
+	env := make([]string, 0)
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, "COMPROMISE_") {
+			env = append(env, v)
+		}
+	}
+	sort.Strings(env)
+
+	sum := sha1.Sum([]byte(executable + "\x00" + strings.Join(env, "\x00")))
+	return toSafeName(filepath.Base(executable)) + "-" + hex.EncodeToString(sum[:8])
+}
+
+func toSafeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// SocketPath returns the path of the socket that the daemon of an executable, which must be an
+// absolute path without symlinks, listens on.
+func SocketPath(executable string) string {
+	return filepath.Join(compenv.CompDir, "daemon-"+daemonID(executable)+".sock")
+}
+
+// LockPath returns the path of the file that the daemon of an executable locks while running.
+func LockPath(executable string) string {
+	return filepath.Join(compenv.CompDir, "daemon-"+daemonID(executable)+".lock")
+}
+
+// Complete asks the daemon of an executable to perform a completion for the current process,
+// and returns the response, or an error if the daemon isn't available.
+func Complete(executable, spec string, args []string) (*Response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(executable), dialTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to daemon")
+	}
+	defer conn.Close()
+
+	cwd, _ := os.Getwd()
+	req := &Request{Spec: spec, Args: args, Env: os.Environ(), Cwd: cwd}
+	return Send(conn.(*net.UnixConn), req, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// Send sends a request with file descriptors for the stdin, stdout and stderr of a completion,
+// and waits for the response.
+func Send(conn *net.UnixConn, req *Request, stdin, stdout, stderr *os.File) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file descriptors are sent with the first byte, followed by the request.
+	fds := syscall.UnixRights(int(stdin.Fd()), int(stdout.Fd()), int(stderr.Fd()))
+	if _, _, err := conn.WriteMsgUnix([]byte{0}, fds, nil); err != nil {
+		return nil, errors.Wrap(err, "unable to send file descriptors")
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, errors.Wrap(err, "unable to send request")
+	}
+	if err := conn.CloseWrite(); err != nil {
+		return nil, errors.Wrap(err, "unable to send request")
+	}
+
+	res := &Response{}
+	if err := json.NewDecoder(conn).Decode(res); err != nil {
+		return nil, errors.Wrap(err, "unable to receive response")
+	}
+	return res, nil
+}
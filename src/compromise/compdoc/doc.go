@@ -0,0 +1,235 @@
+// Package compdoc generates references of commands, in Markdown or man pages, from the help
+// strings in specs.
+package compdoc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/internal/specwalk"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Formats is the list of formats that Write supports.
+var Formats = []string{"markdown", "man"}
+
+// flag is an option of a command.
+type flag struct {
+	names []string
+	help  string
+	value string // Placeholder of the value, or empty if it takes no value.
+}
+
+// entry is a subcommand, which may have a section if it takes more words.
+type entry struct {
+	names   []string
+	help    string
+	section *section
+}
+
+// section describes a command or a subcommand.
+type section struct {
+	words []string // The command and the subcommands.
+	flags []*flag
+	args  []string // Placeholders of the positional arguments.
+	subs  []*entry
+
+	// Whether more than one of the subs can be used, e.g. in a @loop.
+	subsRepeat bool
+}
+
+// builder walks a spec tree and builds sections.
+type builder struct {
+	walker specwalk.Walker
+}
+
+// walkSequence adds nodes that match words one after another to a section.
+func (b *builder) walkSequence(n *compast.Node, s *section) {
+	b.walker.Sequence(n, func(n *compast.Node) {
+		switch n.NodeType() {
+		case compast.NodeSwitch, compast.NodeSwitchLoop, compast.NodeLoop:
+			if specwalk.IsFlagSwitch(n) {
+				b.addFlags(n.Child(), s)
+				return
+			}
+			repeat := ""
+			if n.NodeType() != compast.NodeSwitch {
+				repeat = "..."
+			}
+			subs := len(s.subs)
+			arg := b.addBranches(n.Child(), s)
+			switch {
+			case len(s.subs) > subs:
+				// Other branches are listed among the subs.
+				if arg != "" {
+					s.subs = append(s.subs, &entry{names: []string{arg}})
+				}
+				if repeat != "" {
+					s.subsRepeat = true
+				}
+			case arg != "":
+				s.args = append(s.args, arg+repeat)
+			}
+		default:
+			if arg := placeholder(n); arg != "" {
+				s.args = append(s.args, arg)
+			}
+		}
+	})
+}
+
+// addFlags adds the branches of a switch for flags to a section.
+func (b *builder) addFlags(n *compast.Node, s *section) {
+	b.walker.Flags(n, func(n *compast.Node) {
+		if n.NodeType() != compast.NodeLiteral {
+			return
+		}
+		f := &flag{names: specwalk.Words(n), help: n.HelpText()}
+		if n.Child() != nil {
+			// The first word after the flag is its value.
+			values := &section{}
+			b.walkSequence(n.Child(), values)
+			if len(values.args) > 0 {
+				f.value = values.args[0]
+			}
+		}
+		s.flags = append(s.flags, f)
+	})
+}
+
+// addBranches adds the literals of a switch with children or help as subcommands, and returns a
+// placeholder for the other branches, if any.
+func (b *builder) addBranches(n *compast.Node, s *section) string {
+	var alts []string
+	b.walker.Branches(n, func(n *compast.Node) {
+		if n.NodeType() != compast.NodeLiteral {
+			if arg := placeholder(n); arg != "" {
+				alts = append(alts, arg)
+			}
+			return
+		}
+		names := specwalk.Words(n)
+		if n.Child() == nil && n.HelpText() == "" {
+			alts = append(alts, names...)
+			return
+		}
+		e := &entry{names: names, help: n.HelpText()}
+		if n.Child() != nil {
+			sub := &section{words: append(s.words[:len(s.words):len(s.words)], names[0])}
+			b.walkSequence(n.Child(), sub)
+			if len(sub.flags) > 0 || len(sub.args) > 0 || len(sub.subs) > 0 {
+				e.section = sub
+			}
+		}
+		s.subs = append(s.subs, e)
+	})
+	return strings.Join(alts, "|")
+}
+
+var wordBoundaryRe = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// placeholder returns a placeholder for a node that matches an argument, e.g. "<serial>" for
+// "@any # Serial", and "<device-package>" for "@cand takeDevicePackage".
+func placeholder(n *compast.Node) string {
+	name := ""
+	switch n.NodeType() {
+	case compast.NodeLiteral:
+		return strings.Join(specwalk.Words(n), "|")
+	case compast.NodeAny, compast.NodeExec, compast.NodeLines:
+		name = helpPlaceholder(n.HelpText())
+	case compast.NodeCandidate:
+		name = strings.TrimPrefix(strings.TrimPrefix(n.FuncName().Word, "take"), "Take")
+		name = wordBoundaryRe.ReplaceAllString(name, "$1-$2")
+	default:
+		return ""
+	}
+	if name == "" {
+		name = "arg"
+	}
+	return "<" + strings.ToLower(strings.Replace(name, " ", "-", -1)) + ">"
+}
+
+var leadingPlaceholderRe = regexp.MustCompile(`^<([^>]+)>`)
+
+// helpPlaceholder returns a name from a help, which is the help itself if it's short, or the
+// placeholder at the start, e.g. "ID" in "<ID> use device with given transport id".
+func helpPlaceholder(help string) string {
+	if m := leadingPlaceholderRe.FindStringSubmatch(help); m != nil {
+		return m[1]
+	}
+	if len(strings.Fields(help)) > 3 {
+		return ""
+	}
+	return help
+}
+
+// usage returns the synopsis of a section, e.g. "adb [options] <command>".
+func (s *section) usage() string {
+	u := strings.Join(s.words, " ")
+	if len(s.flags) > 0 {
+		u += " [options]"
+	}
+	for _, a := range s.args {
+		u += " " + a
+	}
+	if len(s.subs) > 0 {
+		if s.hasCommands() {
+			u += " <command>"
+		} else {
+			u += " <arg>"
+		}
+		if s.subsRepeat {
+			u += "..."
+		}
+	}
+	return u
+}
+
+// hasCommands returns whether any of the subs takes more words, which makes them commands rather
+// than arguments.
+func (s *section) hasCommands() bool {
+	for _, e := range s.subs {
+		if e.section != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// sections returns the section and all the subsections in order.
+func (s *section) sections() []*section {
+	ret := []*section{s}
+	for _, e := range s.subs {
+		if e.section != nil {
+			ret = append(ret, e.section.sections()...)
+		}
+	}
+	return ret
+}
+
+type writer func(out *bytes.Buffer, s *section)
+
+var writers = map[string]writer{
+	"markdown": writeMarkdown,
+	"man":      writeMan,
+}
+
+// Write writes a reference of the commands in a parsed spec, with the subcommands, flags and
+// arguments, in Markdown or a man page.
+func Write(root *compast.Node, format string, commands []string, out io.Writer) error {
+	w, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unsupported format %q; must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	buf := &bytes.Buffer{}
+	for _, command := range commands {
+		b := &builder{}
+		s := &section{words: []string{command}}
+		b.walkSequence(root.GetStartNodeForCommand(command), s)
+		w(buf, s)
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,51 @@
+package compdoc
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"github.com/omakoto/compromise/src/compromise/internal/golden"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	compfunc.Register("takeDevicePackage", compfunc.TakeAny)
+}
+
+// TestFixtures writes testdata/mytool.spec in each format, and compares it with mytool.md and
+// mytool.1.
+func TestFixtures(t *testing.T) {
+	root := parser.Parse(golden.Read(t, "testdata/mytool.spec"), compromise.NewDirectives())
+
+	files := map[string]string{"markdown": "testdata/mytool.md", "man": "testdata/mytool.1"}
+	golden.Formats(t, Formats, func(format string) string {
+		return files[format]
+	}, func(t *testing.T, format string) string {
+		out := &bytes.Buffer{}
+		assert.NoError(t, Write(root, format, root.TargetCommands(), out))
+		return out.String()
+	})
+}
+
+func TestPlaceholder(t *testing.T) {
+	root := parser.Parse(`
+@command cmd
+@any # Serial Number
+@any
+@any # <ID> use device with given transport id
+@any # Name of the output file
+@cand takeDevicePackage
+@cand TakeFile
+a|b
+`, compromise.NewDirectives())
+
+	var placeholders []string
+	for n := root.GetStartNodeForCommand("cmd"); n != nil; n = n.Next() {
+		if p := placeholder(n); p != "" {
+			placeholders = append(placeholders, p)
+		}
+	}
+	assert.Equal(t, []string{"<serial-number>", "<arg>", "<id>", "<arg>", "<device-package>", "<file>", "a|b"}, placeholders)
+}
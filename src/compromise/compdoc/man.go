@@ -0,0 +1,64 @@
+package compdoc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+var roffEscaper = strings.NewReplacer(`\`, `\e`, `-`, `\-`)
+
+// roff escapes text for roff, so it isn't taken as a request even at the start of a line.
+func roff(s string) string {
+	return `\&` + roffEscaper.Replace(s)
+}
+
+func writeMan(out *bytes.Buffer, top *section) {
+	command := top.words[0]
+	fmt.Fprintf(out, ".TH %s 1\n", roff(strings.ToUpper(command)))
+	out.WriteString(".SH NAME\n")
+	out.WriteString(roff(command) + "\n")
+	out.WriteString(".SH SYNOPSIS\n")
+	out.WriteString(roff(top.usage()) + "\n")
+
+	for i, s := range top.sections() {
+		// The top command has the sections, and subcommands have subsections.
+		heading := ".SH"
+		if i > 0 {
+			heading = ".SS"
+			fmt.Fprintf(out, ".SH %s\n", roff(strings.ToUpper(strings.Join(s.words, " "))))
+			out.WriteString(roff(s.usage()) + "\n")
+		}
+		if len(s.flags) > 0 {
+			fmt.Fprintf(out, "%s OPTIONS\n", heading)
+			for _, f := range s.flags {
+				var names []string
+				for _, n := range f.names {
+					if f.value != "" {
+						n += " " + f.value
+					}
+					names = append(names, n)
+				}
+				writeManItem(out, strings.Join(names, ", "), f.help)
+			}
+		}
+		if len(s.subs) > 0 {
+			if s.hasCommands() {
+				fmt.Fprintf(out, "%s COMMANDS\n", heading)
+			} else {
+				fmt.Fprintf(out, "%s ARGUMENTS\n", heading)
+			}
+			for _, e := range s.subs {
+				writeManItem(out, strings.Join(e.names, ", "), e.help)
+			}
+		}
+	}
+}
+
+func writeManItem(out *bytes.Buffer, tag, help string) {
+	out.WriteString(".TP\n")
+	out.WriteString(".B " + roff(tag) + "\n")
+	if help != "" {
+		out.WriteString(roff(help) + "\n")
+	}
+}
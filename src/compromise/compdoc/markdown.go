@@ -0,0 +1,77 @@
+package compdoc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func writeMarkdown(out *bytes.Buffer, top *section) {
+	for _, s := range top.sections() {
+		depth := len(s.words)
+		if depth > 6 {
+			depth = 6
+		}
+		fmt.Fprintf(out, "%s %s\n\n", strings.Repeat("#", depth), strings.Join(s.words, " "))
+		fmt.Fprintf(out, "Usage: `%s`\n\n", s.usage())
+
+		if len(s.flags) > 0 {
+			out.WriteString("Options:\n\n")
+			for _, f := range s.flags {
+				fmt.Fprintf(out, "- %s", markdownNames(f.names, f.value))
+				writeMarkdownHelp(out, f.help)
+			}
+			out.WriteString("\n")
+		}
+		if len(s.subs) > 0 {
+			if s.hasCommands() {
+				out.WriteString("Commands:\n\n")
+			} else {
+				out.WriteString("Arguments:\n\n")
+			}
+			for _, e := range s.subs {
+				names := markdownNames(e.names, "")
+				if e.section != nil {
+					names = fmt.Sprintf("[%s](#%s)", names, markdownAnchor(e.section))
+				}
+				out.WriteString("- " + names)
+				writeMarkdownHelp(out, e.help)
+			}
+			out.WriteString("\n")
+		}
+	}
+}
+
+// markdownNames returns names as code, with the placeholder of the value if any.
+func markdownNames(names []string, value string) string {
+	var ret []string
+	for _, n := range names {
+		if value != "" {
+			n += " " + value
+		}
+		ret = append(ret, "`"+n+"`")
+	}
+	return strings.Join(ret, ", ")
+}
+
+func writeMarkdownHelp(out *bytes.Buffer, help string) {
+	if help != "" {
+		out.WriteString(": " + help)
+	}
+	out.WriteString("\n")
+}
+
+// markdownAnchor returns the anchor that GitHub generates for the heading of a section.
+func markdownAnchor(s *section) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '-'
+		case r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return -1
+	}, strings.Join(s.words, " "))
+}
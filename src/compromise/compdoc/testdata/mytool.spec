@@ -0,0 +1,39 @@
+@command mytool
+
+@switchloop "^-"
+	-v|--verbose         # Show more output
+	-C                   # Run in a directory
+		@cand takeDir
+	--color              # When to use colors
+		@switch
+			auto
+			always
+			never
+
+@switch
+	build|b              # Build targets
+		@switchloop "^-"
+			-j           # Number of jobs
+				@any     # Jobs
+		@loop
+			@call :target
+	run                  # Run a program
+		@any             # Program
+		@loop
+			@cand takeFile
+	version              # Print the version
+	help                 # Show help
+		@call :command
+
+@label :target
+	@switch
+		all              # Everything
+		test             # Tests only
+		@if env MYTOOL_EXTRA
+			extra        # Extra targets
+
+@label :command
+	@switch
+		@call :command
+		build
+		run
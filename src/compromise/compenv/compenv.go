@@ -35,12 +35,19 @@ var (
 	HelpStartEscape = utils.FirstNonEmpty(os.Getenv("COMPROMISE_HELP_START"), "\x1b[36m")
 	HelpEndEscape   = utils.FirstNonEmpty(os.Getenv("COMPROMISE_HELP_END"), "\x1b[0m")
 
+	GroupStartEscape = utils.FirstNonEmpty(os.Getenv("COMPROMISE_GROUP_START"), "\x1b[33;1m")
+	GroupEndEscape   = utils.FirstNonEmpty(os.Getenv("COMPROMISE_GROUP_END"), "\x1b[0m")
+
 	// Whether to do case insensitive match or not.
 	IgnoreCase = getBoolEnv("COMPROMISE_IGNORE_CASE", true)
 
 	// Treat underscores and hyphens interchangeably.
 	MapCase = getBoolEnv("COMPROMISE_MAP_CASE", true)
 
+	// Name of the matcher to use, which overrides the "matcher" directive in specs.
+	// One of "prefix" (default), "substring", "fuzzy" and "initialism".
+	Matcher = os.Getenv("COMPROMISE_MATCHER")
+
 	// Bell style, not used yet.
 	BellStyle = os.Getenv("COMPROMISE_BELL_STYPE")
 
@@ -80,6 +87,21 @@ var (
 	// Set "" to disable cache.
 	CacheFilename = path.Join(CompDir, "lastcandidates.dat")
 
+	// Whether to rank candidates by how often and how recently they were selected. Off by default.
+	Frecency = getBoolEnv("COMPROMISE_FRECENCY", false)
+
+	// Selection history file used for frecency ranking.
+	HistoryFilename = path.Join(CompDir, "history.json")
+
+	// Directory for results of functions registered with compfunc.RegisterCached.
+	FuncCacheDir = path.Join(CompDir, "funccache")
+
+	// Whether to use the completion daemon, which keeps parsed specs and caches in memory.
+	UseDaemon = getBoolEnv("COMPROMISE_DAEMON", false)
+
+	// The completion daemon exits after being idle for this long.
+	DaemonIdleTimeout = time.Duration(utils.ParseInt(os.Getenv("COMPROMISE_DAEMON_IDLE_TIMEOUT_SEC"), 10, 30*60)) * time.Second
+
 	// Timeout for the cache.
 	CacheTimeout = time.Duration(utils.ParseInt(os.Getenv("COMPROMISE_CACHE_TIMEOUT_MS"), 10, 1000)) * time.Millisecond
 
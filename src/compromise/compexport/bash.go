@@ -0,0 +1,134 @@
+package compexport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// bashContext is a context with the subcommands that lead to it, separated with spaces.
+type bashContext struct {
+	parent, path string
+	ctx          *context
+
+	// The names of the last subcommand, the first one of which is in the path.
+	names []string
+}
+
+func bashContexts(parent string, names []string, ctx *context) []bashContext {
+	path := ""
+	if len(names) > 0 {
+		path = strings.TrimPrefix(parent+" "+names[0], " ")
+	}
+	ret := []bashContext{{parent, path, ctx, names}}
+	ctx.eachSub(func(names []string, sub *context) {
+		ret = append(ret, bashContexts(path, names, sub)...)
+	})
+	return ret
+}
+
+// bashPatterns returns case patterns that match any of the words.
+func bashPatterns(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, quote(w))
+	}
+	return strings.Join(quoted, "|")
+}
+
+// bashCompgen returns a command that sets COMPREPLY for a position.
+func bashCompgen(p *position) string {
+	var cmds []string
+	if len(p.candidates) > 0 {
+		cmds = append(cmds, `COMPREPLY=($(compgen -W `+quote(strings.Join(values(p.candidates), " "))+` -- "$cur"))`)
+	}
+	switch p.action {
+	case actionFile:
+		cmds = append(cmds, `COMPREPLY+=($(compgen -f -- "$cur"))`)
+	case actionDir:
+		cmds = append(cmds, `COMPREPLY+=($(compgen -d -- "$cur"))`)
+	}
+	if len(cmds) == 0 {
+		return ":"
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// writeBash writes a function that finds the subcommands and the position of the current word
+// by walking the words, as bash can't show the help.
+func writeBash(out *bytes.Buffer, command string, ctx *context) {
+	name := funcName(command)
+	contexts := bashContexts("", nil, ctx)
+	flags := ctx.allFlags()
+
+	fmt.Fprintf(out, "%s() {\n", name)
+	out.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	out.WriteString("\tCOMPREPLY=()\n\n")
+
+	// Values of flags.
+	var valueFlags []string
+	out.WriteString("\tcase \"$prev\" in\n")
+	for _, f := range flags {
+		if f.value == nil {
+			continue
+		}
+		valueFlags = append(valueFlags, f.names...)
+		fmt.Fprintf(out, "\t%s)\n\t\t%s\n\t\treturn\n\t\t;;\n", bashPatterns(f.names), bashCompgen(f.value))
+	}
+	out.WriteString("\tesac\n\n")
+
+	// Find the subcommands and the position.
+	out.WriteString("\tlocal sub=\"\" n=0 i\n")
+	out.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	out.WriteString("\t\tcase \"$sub:${COMP_WORDS[i]}\" in\n")
+	for _, c := range contexts[1:] {
+		patterns := make([]string, 0, len(c.names))
+		for _, name := range c.names {
+			patterns = append(patterns, c.parent+":"+name)
+		}
+		fmt.Fprintf(out, "\t\t%s)\n\t\t\tsub=%s\n\t\t\tn=0\n\t\t\tcontinue\n\t\t\t;;\n", bashPatterns(patterns), quote(c.path))
+	}
+	out.WriteString("\t\tesac\n")
+	out.WriteString("\t\tcase \"${COMP_WORDS[i]}\" in\n")
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(out, "\t\t%s)\n\t\t\t((i++))\n\t\t\t;;\n", bashPatterns(valueFlags))
+	}
+	out.WriteString("\t\t-*)\n\t\t\t;;\n")
+	out.WriteString("\t\t*)\n\t\t\t((n++))\n\t\t\t;;\n")
+	out.WriteString("\t\tesac\n")
+	out.WriteString("\tdone\n\n")
+
+	// Flags.
+	out.WriteString("\tif [[ \"$cur\" == -* ]]; then\n")
+	out.WriteString("\t\tcase \"$sub\" in\n")
+	for _, c := range contexts {
+		var names []string
+		for _, f := range c.ctx.flags {
+			names = append(names, f.names...)
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(out, "\t\t%s)\n\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n\t\t\t;;\n", quote(c.path), quote(strings.Join(names, " ")))
+		}
+	}
+	out.WriteString("\t\tesac\n")
+	out.WriteString("\t\treturn\n")
+	out.WriteString("\tfi\n\n")
+
+	// Arguments.
+	out.WriteString("\tcase \"$sub:$n\" in\n")
+	for _, c := range contexts {
+		for i, p := range c.ctx.positions {
+			pattern := quote(fmt.Sprintf("%s:%d", c.path, i))
+			if p.repeat {
+				pattern = quote(c.path+":") + "*"
+			}
+			fmt.Fprintf(out, "\t%s)\n\t\t%s\n\t\t;;\n", pattern, bashCompgen(p))
+			if p.repeat {
+				break
+			}
+		}
+	}
+	out.WriteString("\tesac\n")
+	out.WriteString("}\n")
+	fmt.Fprintf(out, "complete -F %s %s\n", name, quote(command))
+}
@@ -0,0 +1,66 @@
+// Package compexport converts specs into standalone completion scripts for zsh, fish and bash,
+// which don't need the compromise binary at completion time.
+package compexport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Shells is the list of shells that Export supports.
+var Shells = []string{"zsh", "fish", "bash"}
+
+type writer func(out *bytes.Buffer, command string, ctx *context)
+
+var writers = map[string]writer{
+	"zsh":  writeZsh,
+	"fish": writeFish,
+	"bash": writeBash,
+}
+
+// Export writes a script for a shell that completes the commands in a parsed spec, and returns
+// a report of the nodes that have no static equivalent, e.g. "@cand" with a Go function, in the
+// "file:line:col: message" form.
+func Export(root *compast.Node, shell string, commands []string, out io.Writer) (report []string, err error) {
+	w, ok := writers[shell]
+	if !ok {
+		return nil, fmt.Errorf("unsupported shell %q; must be one of %s", shell, strings.Join(Shells, ", "))
+	}
+	x := newExporter()
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Completion for %s, exported from a compromise spec.\n", strings.Join(commands, ", "))
+	for _, command := range commands {
+		ctx := &context{}
+		x.walkSequence(root.GetStartNodeForCommand(command), ctx)
+		ctx.continueSubs()
+		buf.WriteString("\n")
+		w(buf, command, ctx)
+	}
+	_, err = out.Write(buf.Bytes())
+	return x.report, err
+}
+
+var nonIdentRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// funcName returns a shell function name for a command and subcommands.
+func funcName(command string, path ...string) string {
+	return nonIdentRe.ReplaceAllString(strings.Join(append([]string{"_" + command}, path...), "_"), "_")
+}
+
+// quote single-quotes a string for all the shells.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// values returns the values of candidates.
+func values(cands []*candidate) []string {
+	ret := make([]string, 0, len(cands))
+	for _, c := range cands {
+		ret = append(ret, c.value)
+	}
+	return ret
+}
@@ -0,0 +1,51 @@
+package compexport
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"github.com/omakoto/compromise/src/compromise/internal/golden"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func init() {
+	// A function that has no static equivalent.
+	compfunc.Register("takeGoOutput", compfunc.TakeAny)
+}
+
+// TestFixtures exports testdata/mytool.spec for each shell, and compares the script with the
+// file with the shell's extension, and the report with mytool.report.
+func TestFixtures(t *testing.T) {
+	spec := golden.Read(t, "testdata/mytool.spec")
+	root := parser.Parse(spec, compromise.NewDirectives().SetFilename("mytool.spec"))
+	golden.Formats(t, Shells, func(shell string) string {
+		return "testdata/mytool." + shell
+	}, func(t *testing.T, shell string) string {
+		out := &bytes.Buffer{}
+		report, err := Export(root, shell, root.TargetCommands(), out)
+		assert.NoError(t, err)
+		golden.Assert(t, "testdata/mytool.report", strings.Join(report, "\n")+"\n")
+		return out.String()
+	})
+}
+
+func TestRecursion(t *testing.T) {
+	root := parser.Parse(`
+@command cmd
+@call :args
+
+@label :args
+	@switch
+		-r
+			@call :args
+		file
+`, compromise.NewDirectives().SetFilename("x"))
+
+	out := &bytes.Buffer{}
+	report, err := Export(root, "fish", []string{"cmd"}, out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`x:8:25: recursive @call isn't exported`}, report)
+}
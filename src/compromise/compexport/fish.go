@@ -0,0 +1,112 @@
+package compexport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func writeFish(out *bytes.Buffer, command string, ctx *context) {
+	fmt.Fprintf(out, "complete -c %s -f\n", quote(command))
+	writeFishContext(out, command, nil, ctx)
+}
+
+// fishCondition returns a condition for the words completed in a context after subcommands.
+// Each element of path has the aliases of a subcommand, separated with spaces.
+func fishCondition(path []string, ctx *context) string {
+	var conds []string
+	for _, name := range path {
+		conds = append(conds, "__fish_seen_subcommand_from "+name)
+	}
+	if ctx.subPosition() >= 0 {
+		var subs []string
+		ctx.eachSub(func(names []string, _ *context) {
+			subs = append(subs, names...)
+		})
+		if len(path) == 0 {
+			conds = append(conds, "__fish_use_subcommand")
+		} else {
+			conds = append(conds, "not __fish_seen_subcommand_from "+strings.Join(subs, " "))
+		}
+	}
+	return strings.Join(conds, "; and ")
+}
+
+func writeFishContext(out *bytes.Buffer, command string, path []string, ctx *context) {
+	prefix := "complete -c " + quote(command)
+	flagPrefix := prefix
+	if len(path) > 0 {
+		flagPrefix += " -n " + quote(fishCondition(path, &context{}))
+	}
+	for _, f := range ctx.flags {
+		out.WriteString(flagPrefix)
+		for _, name := range f.names {
+			switch {
+			case strings.HasPrefix(name, "--"):
+				out.WriteString(" -l " + quote(name[2:]))
+			case len(name) == 2:
+				out.WriteString(" -s " + quote(name[1:]))
+			default:
+				out.WriteString(" -o " + quote(name[1:]))
+			}
+		}
+		if f.help != "" {
+			out.WriteString(" -d " + quote(f.help))
+		}
+		if f.value != nil {
+			out.WriteString(" -r" + fishAction(f.value))
+		}
+		out.WriteString("\n")
+	}
+
+	argPrefix := prefix
+	if cond := fishCondition(path, ctx); cond != "" {
+		argPrefix += " -n " + quote(cond)
+	}
+	written := make(map[string]bool)
+	for _, p := range ctx.positions {
+		for _, c := range p.candidates {
+			out.WriteString(argPrefix + " -a " + quote(c.value))
+			if c.help != "" {
+				out.WriteString(" -d " + quote(c.help))
+			}
+			out.WriteString("\n")
+		}
+		if p.action == actionFile || p.action == actionDir {
+			line := argPrefix + fishAction(&position{action: p.action})
+			if p.help != "" {
+				line += " -d " + quote(p.help)
+			}
+			// Consecutive positions often complete the same.
+			if !written[line] {
+				written[line] = true
+				out.WriteString(line + "\n")
+			}
+		}
+		if p.hasSubcommands() {
+			// Only the subcommands are completed until one is used.
+			break
+		}
+	}
+
+	ctx.eachSub(func(names []string, sub *context) {
+		writeFishContext(out, command, append(path[:len(path):len(path)], strings.Join(names, " ")), sub)
+	})
+}
+
+// fishAction returns the options to complete the value of a flag.
+func fishAction(p *position) string {
+	var opts string
+	switch p.action {
+	case actionFile:
+		opts = " -F"
+	case actionDir:
+		opts = " -x -a '(__fish_complete_directories)'"
+	default:
+		opts = " -x"
+	}
+	if len(p.candidates) > 0 {
+		opts += " -a " + quote(strings.Join(values(p.candidates), " "))
+	}
+	return opts
+}
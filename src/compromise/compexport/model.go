@@ -0,0 +1,235 @@
+package compexport
+
+// Converts a spec tree into a static model of flags, positional arguments and subcommands, which
+// all the shells can express.
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/internal/specwalk"
+	"strings"
+)
+
+// Actions for the words that aren't from a list.
+const (
+	actionNone = ""
+	actionAny  = "any"
+	actionFile = "file"
+	actionDir  = "dir"
+)
+
+type candidate struct {
+	value, help string
+
+	// What follows the candidate, if it's a subcommand.
+	sub *context
+}
+
+// position is what's completed for a positional argument, or the value of a flag.
+type position struct {
+	candidates []*candidate
+	action     string
+	help       string
+
+	// Whether it repeats, e.g. in a @loop.
+	repeat bool
+}
+
+func (p *position) empty() bool {
+	return len(p.candidates) == 0 && p.action == actionNone
+}
+
+func (p *position) hasSubcommands() bool {
+	for _, c := range p.candidates {
+		if c.sub != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *position) setAction(action, help string) {
+	// Files are the most useful when multiple actions are mixed.
+	if p.action == actionNone || action == actionFile {
+		p.action = action
+	}
+	if p.help == "" {
+		p.help = help
+	}
+}
+
+type flag struct {
+	names []string
+	help  string
+	value *position // nil if it takes no value.
+}
+
+// context is where completion is, either at the top of a command, or after subcommands.
+type context struct {
+	flags     []*flag
+	positions []*position
+}
+
+// exporter walks a spec tree and builds contexts.
+type exporter struct {
+	walker *specwalk.Walker
+
+	report []string
+	lost   map[string]bool
+}
+
+func newExporter() *exporter {
+	x := &exporter{lost: make(map[string]bool)}
+	x.walker = &specwalk.Walker{
+		OnRecursion: func(n *compast.Node) {
+			x.lose(n.SelfToken(), "recursive %s isn't exported", n.SelfToken().RawWord)
+		},
+		OnCondition: func(n *compast.Node) {
+			x.lose(n.SelfToken(), "the condition of %s isn't exported, and the children are always completed", n.SelfToken().RawWord)
+		},
+	}
+	return x
+}
+
+// lose reports a node that can't be exported as is.
+func (x *exporter) lose(t *compast.Token, format string, args ...interface{}) {
+	file, line, column := t.SourceLocation()
+	msg := fmt.Sprintf("%s:%d:%d: %s", file, line, column, fmt.Sprintf(format, args...))
+	if !x.lost[msg] {
+		x.lost[msg] = true
+		x.report = append(x.report, msg)
+	}
+}
+
+// walkSequence adds nodes that match words one after another to a context.
+func (x *exporter) walkSequence(n *compast.Node, ctx *context) {
+	x.walker.Sequence(n, func(n *compast.Node) {
+		switch n.NodeType() {
+		case compast.NodeSwitch, compast.NodeSwitchLoop, compast.NodeLoop:
+			if specwalk.IsFlagSwitch(n) {
+				x.addFlags(n.Child(), ctx)
+				return
+			}
+			p := &position{repeat: n.NodeType() != compast.NodeSwitch}
+			x.walker.Branches(n.Child(), func(n *compast.Node) {
+				x.addBranch(n, p)
+			})
+			if !p.empty() {
+				ctx.positions = append(ctx.positions, p)
+			}
+		case compast.NodeLiteral, compast.NodeAny, compast.NodeCandidate, compast.NodeExec, compast.NodeLines:
+			p := &position{}
+			x.addBranch(n, p)
+			ctx.positions = append(ctx.positions, p)
+		case compast.NodeGoCall, compast.NodeSet, compast.NodeCapture:
+			x.lose(n.SelfToken(), "%s is ignored", n.SelfToken().RawWord)
+		}
+	})
+}
+
+// addFlags adds the branches of a switch for flags to a context.
+func (x *exporter) addFlags(n *compast.Node, ctx *context) {
+	x.walker.Flags(n, func(n *compast.Node) {
+		if n.NodeType() != compast.NodeLiteral {
+			x.lose(n.SelfToken(), "%s among flags isn't exported", n.SelfToken().RawWord)
+			return
+		}
+		f := &flag{names: specwalk.Words(n), help: n.HelpText()}
+		if n.Child() != nil {
+			// The first word after the flag is its value.
+			values := &context{}
+			x.walkSequence(n.Child(), values)
+			if len(values.positions) > 0 {
+				f.value = values.positions[0]
+			}
+		}
+		ctx.flags = append(ctx.flags, f)
+	})
+}
+
+// addBranch adds a node that matches a word to a position.
+func (x *exporter) addBranch(n *compast.Node, p *position) {
+	switch n.NodeType() {
+	case compast.NodeLiteral:
+		var sub *context
+		if n.Child() != nil {
+			sub = &context{}
+			x.walkSequence(n.Child(), sub)
+		}
+		for _, c := range n.AsCandidates() {
+			p.candidates = append(p.candidates, &candidate{value: c.Value(), help: n.HelpText(), sub: sub})
+		}
+	case compast.NodeAny:
+		p.setAction(actionAny, n.HelpText())
+	case compast.NodeCandidate:
+		switch strings.ToLower(n.FuncName().Word) {
+		case "takefile":
+			p.setAction(actionFile, "")
+		case "takedir":
+			p.setAction(actionDir, "")
+		case "takeany", "takeinteger":
+			p.setAction(actionAny, "")
+		default:
+			x.lose(n.SelfToken(), "@cand %s has no static equivalent, and completes files instead", n.FuncName().Word)
+			p.setAction(actionFile, "")
+		}
+	case compast.NodeExec, compast.NodeLines:
+		x.lose(n.SelfToken(), "%s has no static equivalent, and completes files instead", n.SelfToken().RawWord)
+		p.setAction(actionFile, n.HelpText())
+	case compast.NodeGoCall, compast.NodeSet, compast.NodeCapture:
+		x.lose(n.SelfToken(), "%s is ignored", n.SelfToken().RawWord)
+	}
+}
+
+// allFlags returns the flags in a context and all the subcommands.
+func (ctx *context) allFlags() []*flag {
+	ret := append([]*flag{}, ctx.flags...)
+	ctx.eachSub(func(_ []string, sub *context) {
+		ret = append(ret, sub.allFlags()...)
+	})
+	return ret
+}
+
+// eachSub calls f with each distinct subcommand context and the names that lead to it.
+func (ctx *context) eachSub(f func(names []string, sub *context)) {
+	for _, p := range ctx.positions {
+		for i, c := range p.candidates {
+			if c.sub == nil || (i > 0 && p.candidates[i-1].sub == c.sub) {
+				continue
+			}
+			names := make([]string, 0)
+			for _, d := range p.candidates[i:] {
+				if d.sub != c.sub {
+					break
+				}
+				names = append(names, d.value)
+			}
+			f(names, c.sub)
+		}
+	}
+}
+
+// subPosition returns the index of the first position with subcommands, or -1.
+func (ctx *context) subPosition() int {
+	for i, p := range ctx.positions {
+		if p.hasSubcommands() {
+			return i
+		}
+	}
+	return -1
+}
+
+// continueSubs moves the positions after subcommands to the end of the subcommands, because
+// they're completed after the words that the subcommands take.
+func (ctx *context) continueSubs() {
+	i := ctx.subPosition()
+	if i < 0 {
+		return
+	}
+	rest := ctx.positions[i+1:]
+	ctx.positions = ctx.positions[:i+1]
+	ctx.eachSub(func(_ []string, sub *context) {
+		sub.positions = append(sub.positions, rest...)
+		sub.continueSubs()
+	})
+}
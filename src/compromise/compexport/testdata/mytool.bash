@@ -0,0 +1,79 @@
+# Completion for mytool, exported from a compromise spec.
+
+_mytool() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	COMPREPLY=()
+
+	case "$prev" in
+	'-C')
+		COMPREPLY+=($(compgen -d -- "$cur"))
+		return
+		;;
+	'--color')
+		COMPREPLY=($(compgen -W 'auto always never' -- "$cur"))
+		return
+		;;
+	'-j')
+		:
+		return
+		;;
+	'--go_out')
+		COMPREPLY+=($(compgen -f -- "$cur"))
+		return
+		;;
+	esac
+
+	local sub="" n=0 i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "$sub:${COMP_WORDS[i]}" in
+		':build'|':b')
+			sub='build'
+			n=0
+			continue
+			;;
+		':run')
+			sub='run'
+			n=0
+			continue
+			;;
+		esac
+		case "${COMP_WORDS[i]}" in
+		'-C'|'--color'|'-j'|'--go_out')
+			((i++))
+			;;
+		-*)
+			;;
+		*)
+			((n++))
+			;;
+		esac
+	done
+
+	if [[ "$cur" == -* ]]; then
+		case "$sub" in
+		'')
+			COMPREPLY=($(compgen -W '-v --verbose -C --color' -- "$cur"))
+			;;
+		'build')
+			COMPREPLY=($(compgen -W '-j --go_out' -- "$cur"))
+			;;
+		esac
+		return
+	fi
+
+	case "$sub:$n" in
+	':0')
+		COMPREPLY=($(compgen -W 'build b run version' -- "$cur"))
+		;;
+	'build:'*)
+		COMPREPLY=($(compgen -W 'all test extra' -- "$cur"))
+		;;
+	'run:0')
+		COMPREPLY+=($(compgen -f -- "$cur"))
+		;;
+	'run:'*)
+		COMPREPLY+=($(compgen -f -- "$cur"))
+		;;
+	esac
+}
+complete -F _mytool 'mytool'
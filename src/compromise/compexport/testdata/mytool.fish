@@ -0,0 +1,16 @@
+# Completion for mytool, exported from a compromise spec.
+
+complete -c 'mytool' -f
+complete -c 'mytool' -s 'v' -l 'verbose' -d 'Show more output'
+complete -c 'mytool' -s 'C' -d 'Run in a directory' -r -x -a '(__fish_complete_directories)'
+complete -c 'mytool' -l 'color' -d 'When to use colors' -r -x -a 'auto always never'
+complete -c 'mytool' -n '__fish_use_subcommand' -a 'build' -d 'Build targets'
+complete -c 'mytool' -n '__fish_use_subcommand' -a 'b' -d 'Build targets'
+complete -c 'mytool' -n '__fish_use_subcommand' -a 'run' -d 'Run a program'
+complete -c 'mytool' -n '__fish_use_subcommand' -a 'version' -d 'Print the version'
+complete -c 'mytool' -n '__fish_seen_subcommand_from build b' -s 'j' -d 'Number of jobs' -r -x
+complete -c 'mytool' -n '__fish_seen_subcommand_from build b' -l 'go_out' -d 'Custom output' -r -F
+complete -c 'mytool' -n '__fish_seen_subcommand_from build b' -a 'all' -d 'Everything'
+complete -c 'mytool' -n '__fish_seen_subcommand_from build b' -a 'test' -d 'Tests only'
+complete -c 'mytool' -n '__fish_seen_subcommand_from build b' -a 'extra' -d 'Extra targets'
+complete -c 'mytool' -n '__fish_seen_subcommand_from run' -F
@@ -0,0 +1,33 @@
+@command mytool
+
+@switchloop "^-"
+	-v|--verbose         # Show more output
+	-C                   # Run in a directory
+		@cand takeDir
+	--color              # When to use colors
+		@switch
+			auto
+			always
+			never
+
+@switch
+	build|b              # Build targets
+		@switchloop "^-"
+			-j           # Number of jobs
+				@any
+			--go_out     # Custom output
+				@cand takeGoOutput
+		@loop
+			@call :target
+	run                  # Run a program
+		@lines "~/.mytool-programs"
+		@loop
+			@cand takeFile
+	version              # Print the version
+
+@label :target
+	@switch
+		all                  # Everything
+		test                 # Tests only
+		@if env MYTOOL_EXTRA
+			extra            # Extra targets
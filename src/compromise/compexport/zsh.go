@@ -0,0 +1,151 @@
+package compexport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func writeZsh(out *bytes.Buffer, command string, ctx *context) {
+	writeZshContext(out, command, nil, ctx)
+	fmt.Fprintf(out, "compdef %s %s\n", funcName(command), quote(command))
+}
+
+var zshEscaper = strings.NewReplacer(`\`, `\\`, `:`, `\:`, `[`, `\[`, `]`, `\]`)
+
+// zshMessage returns a message for _arguments, which needs to be non-empty to be shown.
+func zshMessage(help string) string {
+	if help == "" {
+		return " "
+	}
+	return zshEscaper.Replace(help)
+}
+
+// zshAction returns an _arguments action that doesn't need a state.
+func zshAction(p *position) string {
+	if len(p.candidates) > 0 {
+		return "(" + strings.Join(values(p.candidates), " ") + ")"
+	}
+	switch p.action {
+	case actionFile:
+		return "_files"
+	case actionDir:
+		return "_files -/"
+	}
+	return " "
+}
+
+func writeZshContext(out *bytes.Buffer, command string, path []string, ctx *context) {
+	name := funcName(command, path...)
+	fmt.Fprintf(out, "%s() {\n", name)
+	out.WriteString("\tlocal curcontext=\"$curcontext\" state state_descr line\n")
+	out.WriteString("\ttypeset -A opt_args\n")
+	out.WriteString("\t_arguments -C")
+
+	for _, f := range ctx.flags {
+		out.WriteString(" \\\n\t\t")
+		spec := ""
+		if len(f.names) > 1 {
+			fmt.Fprintf(out, "'(%s)'{%s}", strings.Join(f.names, " "), strings.Join(f.names, ","))
+		} else {
+			spec = f.names[0]
+		}
+		spec += "[" + zshEscaper.Replace(f.help) + "]"
+		if f.value != nil {
+			spec += ":" + zshMessage(f.value.help) + ":" + zshAction(f.value)
+		}
+		out.WriteString(quote(spec))
+	}
+
+	// Positions with candidates are completed with _describe to show the help.
+	var states []int
+	subIndex := ctx.subPosition()
+	for i, p := range ctx.positions {
+		spec := fmt.Sprintf("%d", i+1)
+		if p.repeat {
+			spec = "*"
+		}
+		switch {
+		case i == subIndex:
+			spec += ": :->subcommands"
+		case len(p.candidates) > 0:
+			spec += fmt.Sprintf(": :->arg%d", i+1)
+			states = append(states, i)
+		default:
+			spec += ":" + zshMessage(p.help) + ":" + zshAction(p)
+		}
+		out.WriteString(" \\\n\t\t" + quote(spec))
+		if i == subIndex {
+			out.WriteString(" \\\n\t\t'*:: :->args'")
+			break
+		}
+		if p.repeat {
+			break
+		}
+	}
+	out.WriteString("\n")
+
+	if len(states) > 0 || subIndex >= 0 {
+		out.WriteString("\tcase $state in\n")
+		for _, i := range states {
+			fmt.Fprintf(out, "\targ%d)\n", i+1)
+			writeZshDescribe(out, ctx.positions[i])
+			out.WriteString("\t\t;;\n")
+		}
+		if subIndex >= 0 {
+			out.WriteString("\tsubcommands)\n")
+			writeZshDescribe(out, ctx.positions[subIndex])
+			out.WriteString("\t\t;;\n")
+			out.WriteString("\targs)\n")
+			if subIndex > 0 {
+				// Make the subcommand the first word, as the command name.
+				fmt.Fprintf(out, "\t\tshift %d words\n", subIndex)
+				fmt.Fprintf(out, "\t\t(( CURRENT -= %d ))\n", subIndex)
+			}
+			fmt.Fprintf(out, "\t\tcase $line[%d] in\n", subIndex+1)
+			ctx.eachSub(func(names []string, _ *context) {
+				quoted := make([]string, 0, len(names))
+				for _, n := range names {
+					quoted = append(quoted, quote(n))
+				}
+				fmt.Fprintf(out, "\t\t%s)\n\t\t\t%s\n\t\t\t;;\n", strings.Join(quoted, "|"), funcName(command, append(path, names[0])...))
+			})
+			out.WriteString("\t\tesac\n")
+			out.WriteString("\t\t;;\n")
+		}
+		out.WriteString("\tesac\n")
+	}
+	out.WriteString("}\n\n")
+
+	ctx.eachSub(func(names []string, sub *context) {
+		writeZshContext(out, command, append(path[:len(path):len(path)], names[0]), sub)
+	})
+}
+
+// writeZshDescribe writes commands to complete the candidates of a position with the help.
+func writeZshDescribe(out *bytes.Buffer, p *position) {
+	out.WriteString("\t\tlocal -a candidates\n")
+	out.WriteString("\t\tcandidates=(\n")
+	for _, c := range p.candidates {
+		v := strings.Replace(c.value, ":", `\:`, -1)
+		if c.help != "" {
+			v += ":" + c.help
+		}
+		out.WriteString("\t\t\t" + quote(v) + "\n")
+	}
+	out.WriteString("\t\t)\n")
+	fmt.Fprintf(out, "\t\t_describe %s candidates\n", quote(describeMessage(p.help)))
+	switch p.action {
+	case actionFile:
+		out.WriteString("\t\t_files\n")
+	case actionDir:
+		out.WriteString("\t\t_files -/\n")
+	}
+}
+
+func describeMessage(help string) string {
+	if help == "" {
+		return "argument"
+	}
+	return help
+}
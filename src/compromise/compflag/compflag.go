@@ -0,0 +1,99 @@
+// Package compflag generates a spec from flags defined with the standard flag package.
+package compflag
+
+import (
+	"flag"
+	"github.com/omakoto/compromise/src/compromise/internal/specgen"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Spec builds a spec from a flag.FlagSet, which has an @switchloop with all the flags, followed by
+// the positional arguments, if any.
+type Spec struct {
+	fs       *flag.FlagSet
+	commands []string
+
+	// Spec for the value of each flag, which overrides the inferred one.
+	values map[string]string
+
+	// Spec for the positional arguments, after the flags.
+	args []string
+}
+
+// NewSpec creates a Spec for the flags in a FlagSet. The spec is for the given commands, or the
+// name of the FlagSet if none is given, e.g. the base name of the program for flag.CommandLine.
+func NewSpec(fs *flag.FlagSet, commands ...string) *Spec {
+	if len(commands) == 0 && fs.Name() != "" {
+		commands = []string{filepath.Base(fs.Name())}
+	}
+	return &Spec{fs: fs, commands: commands, values: make(map[string]string)}
+}
+
+// SetValue sets the spec for the value of a flag, e.g. "@cand takeDir", instead of the inferred
+// one. It may have multiple lines, which are indented as the children of the flag.
+func (s *Spec) SetValue(name, spec string) *Spec {
+	s.values[name] = spec
+	return s
+}
+
+// AddArgs adds a spec for positional arguments after the flags, e.g. "@loop\n\t@cand takeFile".
+func (s *Spec) AddArgs(spec string) *Spec {
+	s.args = append(s.args, spec)
+	return s
+}
+
+// String returns the spec text.
+func (s *Spec) String() string {
+	b := strings.Builder{}
+	for _, c := range s.commands {
+		b.WriteString("@command " + strconv.Quote(c) + "\n")
+	}
+
+	b.WriteString("\n@switchloop \"^-\"\n")
+	s.fs.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		b.WriteString("\t" + strconv.Quote("-"+f.Name) + specgen.HelpComment(usage) + "\n")
+
+		if !isBoolFlag(f) && len(f.Name) > 1 {
+			// The flag package takes "-flag=VALUE" too. ("-fVALUE" isn't supported, so not for
+			// single letter flags, which @joined would split that way.)
+			b.WriteString("\t\t@joined\n")
+		}
+		value, ok := s.values[f.Name]
+		if !ok {
+			value = inferValue(f, name)
+		}
+		writeIndented(&b, value, "\t\t")
+	})
+
+	for _, a := range s.args {
+		b.WriteString("\n")
+		writeIndented(&b, a, "")
+	}
+	return b.String()
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// inferValue returns the spec for the value of a flag from its type, or from the name in the
+// usage, e.g. "file" in "-o `file`: output file".
+func inferValue(f *flag.Flag, name string) string {
+	if isBoolFlag(f) {
+		return ""
+	}
+	return specgen.ValueSpec(name)
+}
+
+func writeIndented(b *strings.Builder, spec, indent string) {
+	if spec == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(spec, "\n"), "\n") {
+		b.WriteString(indent + line + "\n")
+	}
+}
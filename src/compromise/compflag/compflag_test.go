@@ -0,0 +1,89 @@
+package compflag
+
+import (
+	"bytes"
+	"flag"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/compmain"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("/path/to/mytool", flag.ContinueOnError)
+	fs.Bool("v", false, "Verbose\noutput")
+	fs.String("o", "", "Write to `file`")
+	fs.String("C", "", "Change to `dir`")
+	fs.Int("n", 0, "Number of items")
+	fs.String("format", "", "Output format")
+	fs.String("direction", "", "Sort `direction`")
+	fs.String("profile", "", "Use `profile`")
+	return fs
+}
+
+func TestSpec(t *testing.T) {
+	spec := NewSpec(newFlagSet()).
+		SetValue("format", "@switch\n\tjson\n\ttext").
+		AddArgs("@loop\n\t@cand takeFile").
+		String()
+	assert.Equal(t, `@command "mytool"
+
+@switchloop "^-"
+	"-C" # Change to dir
+		@cand takeDir
+	"-direction" # Sort direction
+		@joined
+		@any # <direction>
+	"-format" # Output format
+		@joined
+		@switch
+			json
+			text
+	"-n" # Number of items
+		@any # <int>
+	"-o" # Write to file
+		@cand takeFile
+	"-profile" # Use profile
+		@joined
+		@any # <profile>
+	"-v" # Verbose output
+
+@loop
+	@cand takeFile
+`, spec)
+
+	assert.Equal(t, "@command \"a\"\n@command \"b\"\n\n@switchloop \"^-\"\n", NewSpec(flag.NewFlagSet("", flag.ContinueOnError), "a", "b").String())
+}
+
+func TestComplete(t *testing.T) {
+	prevShell := os.Getenv("COMPROMISE_SHELL")
+	os.Setenv("COMPROMISE_SHELL", "tester")
+	defer os.Setenv("COMPROMISE_SHELL", prevShell)
+
+	// Don't reuse candidates of completions in other tests.
+	prevTimeout := compenv.CacheTimeout
+	compenv.CacheTimeout = -1
+	defer func() { compenv.CacheTimeout = prevTimeout }()
+
+	spec := NewSpec(newFlagSet()).SetValue("format", "@switch\n\tjson\n\ttext").String()
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"mytool", "-"}, "-C #\"Change to dir\"\n-direction=+ #\"Sort direction\"\n-format=+ #\"Output format\"\n-n #\"Number of items\"\n-o #\"Write to file\"\n-profile=+ #\"Use profile\"\n-v #\"Verbose output\"\n"},
+		{[]string{"mytool", "-v", "-f"}, "-format=+ #\"Output format\"\n"},
+		{[]string{"mytool", "-direction", ""}, "! #\"<direction>\"\n"},
+		{[]string{"mytool", "-n", ""}, "! #\"<int>\"\n"},
+		{[]string{"mytool", "-format=j"}, "-format=json\n"},
+		{[]string{"mytool", "-format="}, "-format=json\n-format=text\n"},
+		{[]string{"mytool", "-direction=asc"}, "! #\"<direction>\"\n"},
+	}
+	for _, v := range tests {
+		buf := &bytes.Buffer{}
+		compmain.HandleCompletionRaw(func() string {
+			return spec
+		}, v.args, nil, buf)
+		assert.Equal(t, v.expected, buf.String(), "%q", v.args)
+	}
+}
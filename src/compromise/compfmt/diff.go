@@ -0,0 +1,132 @@
+package compfmt
+
+import (
+	"fmt"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// diffLine is a line in a diff, with a prefix of ' ', '-' or '+'.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// Diff returns a unified diff between two strings, or "" if they're the same.
+func Diff(name string, before, after string) string {
+	if before == after {
+		return ""
+	}
+	// Convert each line into a rune, and diff them.
+	lineArray := make([]string, 0)
+	lineIndexes := make(map[string]rune)
+	toRunes := func(text string) []rune {
+		ret := make([]rune, 0)
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if len(line) == 0 {
+				continue
+			}
+			r, ok := lineIndexes[line]
+			if !ok {
+				// Use the supplementary planes to avoid invalid runes, e.g. surrogates.
+				r = rune(0x10000 + len(lineArray))
+				lineIndexes[line] = r
+				lineArray = append(lineArray, line)
+			}
+			ret = append(ret, r)
+		}
+		return ret
+	}
+	diffs := diffmatchpatch.New().DiffMainRunes(toRunes(before), toRunes(after), false)
+
+	lines := make([]diffLine, 0)
+	for _, d := range diffs {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, r := range d.Text {
+			lines = append(lines, diffLine{op, lineArray[r-0x10000]})
+		}
+	}
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s.orig\n+++ %s\n", name, name)
+
+	// Split into hunks, each of which has changed lines with up to diffContextLines lines around.
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// Found a change; start a hunk.
+		start := i
+		for k := 0; k < diffContextLines && start > 0 && lines[start-1].op == ' '; k++ {
+			start--
+		}
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+
+		// Extend the hunk until there are more than 2*diffContextLines unchanged lines.
+		end := i
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			same := 0
+			for end+same < len(lines) && lines[end+same].op == ' ' {
+				same++
+			}
+			if end+same == len(lines) || same > 2*diffContextLines {
+				end += minInt(same, diffContextLines)
+				break
+			}
+			end += same
+		}
+
+		oldCount, newCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", hunkOld, oldCount, hunkNew, newCount)
+		for _, l := range lines[start:end] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		// Advance the line numbers past the hunk.
+		for _, l := range lines[i:end] {
+			if l.op != '+' {
+				oldLine++
+			}
+			if l.op != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,292 @@
+package compfmt
+
+// Formatter for completion specs.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/omakoto/compromise/src/compromise/internal/parser/tokenizer"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// line is a formatted line.
+type line struct {
+	blank bool
+	depth int
+
+	// Formatted tokens, except for the trailing help or comment.
+	body string
+
+	// Trailing help or comment, which will be aligned with the ones on the sibling lines.
+	// It has more than one element when a help string continues to the following lines.
+	tail []string
+
+	// Whether the line only has comments.
+	commentOnly bool
+}
+
+// Format formats a spec: indents are normalized to a tab per depth (tabs in the source are
+// assumed to be d.TabWidth wide), help strings and trailing comments of sibling lines are
+// aligned, and literals are quoted only when needed, which is when they contain spaces,
+// '@' or ':', etc. Candidates with '|' are kept as is, because quoting changes their meaning.
+// Structured specs, i.e. JSON and YAML, are returned as they are.
+func Format(spec string, d *compromise.Directives) (ret string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(compromise.SpecError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	if parser.StructuredFormat(d) != "" {
+		return spec, nil
+	}
+
+	lines := toLines(spec, d)
+	alignTails(lines)
+
+	b := &strings.Builder{}
+	for _, l := range lines {
+		if l.blank {
+			b.WriteString("\n")
+			continue
+		}
+		indent := strings.Repeat("\t", l.depth)
+		b.WriteString(indent)
+		b.WriteString(l.body)
+		for i, t := range l.tail {
+			if i == 0 {
+				if len(l.body) > 0 {
+					b.WriteString(" ")
+				}
+			} else {
+				b.WriteString("\n")
+				b.WriteString(indent)
+				b.WriteString(strings.Repeat(" ", utf8.RuneCountInString(l.body)+1))
+			}
+			b.WriteString(t)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// toLines tokenizes a spec and converts it into lines.
+func toLines(spec string, d *compromise.Directives) []*line {
+	t := tokenizer.NewTokenizer(spec, d).KeepComments()
+
+	ret := make([]*line, 0)
+
+	// Same as the parser, used to detect the depth.
+	lastLineStartColumn := 1
+	columns := make([]int, 0)
+	depth := 0
+
+	// Comment lines get the depth of the next line.
+	pendingComments := make([]*line, 0)
+
+	nextLine := d.StartLine
+	for {
+		tok := t.NextToken()
+		if tok == nil {
+			break
+		}
+
+		// Collect the tokens in the line.
+		tokens := []*compast.Token{tok}
+		endLine := tokenEndLine(tok)
+		for {
+			next := t.NextToken()
+			if next == nil {
+				break
+			}
+			if next.Line > endLine {
+				t.PushBack(next)
+				break
+			}
+			tokens = append(tokens, next)
+			endLine = tokenEndLine(next)
+		}
+
+		// Blank lines in between are collapsed into one.
+		if tok.Line > nextLine {
+			ret = append(ret, &line{blank: true})
+		}
+		nextLine = endLine + 1
+
+		l := formatLine(tokens)
+		ret = append(ret, l)
+		if l.commentOnly {
+			pendingComments = append(pendingComments, l)
+			continue
+		}
+
+		// Detect the depth.
+		lead := tokens[0]
+		for _, tok := range tokens {
+			if tok.TokenType != compast.TokenComment {
+				lead = tok
+				break
+			}
+		}
+		if lead.Column > lastLineStartColumn {
+			columns = append(columns, lastLineStartColumn)
+			depth++
+		} else if lead.Column < lastLineStartColumn {
+			for {
+				if len(columns) == 0 {
+					panic(compromise.NewSpecErrorf(lead, "inconsistent indent for token %s", lead))
+				}
+				prevColumn := columns[len(columns)-1]
+				columns = columns[:len(columns)-1]
+				if lead.Column > prevColumn {
+					panic(compromise.NewSpecErrorf(lead, "inconsistent indent for token %s, expected column is %d", lead, prevColumn))
+				}
+				depth--
+				if lead.Column == prevColumn {
+					break
+				}
+			}
+		}
+		lastLineStartColumn = lead.Column
+
+		l.depth = depth
+		for _, c := range pendingComments {
+			c.depth = depth
+		}
+		pendingComments = pendingComments[:0]
+	}
+	return ret
+}
+
+func tokenEndLine(tok *compast.Token) int {
+	return tok.Line + strings.Count(tok.RawWord, "\n")
+}
+
+// formatLine formats tokens in a line.
+func formatLine(tokens []*compast.Token) *line {
+	l := &line{commentOnly: true}
+
+	b := &strings.Builder{}
+	for i, tok := range tokens {
+		if tok.TokenType != compast.TokenComment {
+			l.commentOnly = false
+		}
+		// A help string is always the last token in a line.
+		if tok.TokenType == compast.TokenHelp || (tok.TokenType == compast.TokenComment && i > 0 && i == len(tokens)-1) {
+			l.tail = formatTail(tok)
+			break
+		}
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(formatToken(tok, i == 0))
+	}
+	l.body = b.String()
+	return l
+}
+
+// formatTail formats a help string, or a comment.
+func formatTail(tok *compast.Token) []string {
+	if tok.TokenType == compast.TokenComment {
+		return []string{strings.TrimRightFunc(tok.RawWord, unicode.IsSpace)}
+	}
+	ret := make([]string, 0)
+	for _, s := range strings.Split(tok.RawWord, "\n") {
+		s = strings.TrimSpace(s)
+		s = strings.TrimSpace(strings.TrimPrefix(s, "#"))
+		if len(s) == 0 {
+			ret = append(ret, "#")
+		} else {
+			ret = append(ret, "# "+s)
+		}
+	}
+	return ret
+}
+
+func formatToken(tok *compast.Token, first bool) string {
+	switch tok.TokenType {
+	case compast.TokenCommand:
+		return "@" + tok.Word
+	case compast.TokenLabel:
+		return ":" + tok.Word
+	case compast.TokenComment:
+		return strings.TrimRightFunc(tok.RawWord, unicode.IsSpace)
+	}
+	quoted := tok.RawWord[0] == '"' || tok.RawWord[0] == '`'
+	if first && strings.ContainsRune(tok.Word, '|') {
+		// Unquoted candidates with '|' are split into multiple candidates, but quoted ones are
+		// not, so keep them as is.
+		if quoted {
+			return strconv.Quote(tok.Word)
+		}
+		return tok.Word
+	}
+	if tokenizer.NeedsQuote(tok.Word) {
+		return strconv.Quote(tok.Word)
+	}
+	// Candidates are quoted only when needed, but arguments to commands, e.g. patterns,
+	// are kept quoted.
+	if !first && quoted {
+		return strconv.Quote(tok.Word)
+	}
+	return tok.Word
+}
+
+// Literal returns a word as a literal in a spec, which is quoted only when needed.
+func Literal(word string) string {
+	if tokenizer.NeedsQuote(word) {
+		return strconv.Quote(word)
+	}
+	return word
+}
+
+// alignTails aligns trailing help strings and comments of sibling lines, until a blank line or
+// a line without them.
+func alignTails(lines []*line) {
+	// Lines in the current run for each depth.
+	runs := make(map[int][]*line)
+
+	flush := func(depth int) {
+		run := runs[depth]
+		delete(runs, depth)
+
+		width := 0
+		for _, l := range run {
+			if w := utf8.RuneCountInString(l.body); w > width {
+				width = w
+			}
+		}
+		for _, l := range run {
+			l.body += strings.Repeat(" ", width-utf8.RuneCountInString(l.body))
+		}
+	}
+	flushDeeper := func(depth int) {
+		for d := range runs {
+			if d > depth {
+				flush(d)
+			}
+		}
+	}
+
+	for _, l := range lines {
+		switch {
+		case l.blank:
+			flushDeeper(-1)
+		case l.commentOnly:
+			// Doesn't affect alignment.
+		case len(l.tail) == 0 || len(l.body) == 0:
+			flushDeeper(l.depth - 1)
+		default:
+			flushDeeper(l.depth)
+			runs[l.depth] = append(runs[l.depth], l)
+		}
+	}
+	flushDeeper(-1)
+}
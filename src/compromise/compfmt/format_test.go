@@ -0,0 +1,96 @@
+package compfmt
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		tabWidth int
+		spec     string
+		expected string
+	}{
+		// Indents.
+		{8, "@switch\n  a\n    b\n  c\n", "@switch\n\ta\n\t\tb\n\tc\n"},
+		{4, "@switch\n\ta\n    \t b\n    c\n", "@switch\n\ta\n\t\tb\n\tc\n"},
+
+		// Blank lines are collapsed.
+		{8, "\n\n@switch\n\n\n  a\n", "\n@switch\n\n\ta\n"},
+
+		// Help strings are aligned among siblings.
+		{8, "@switch\n  a #A\n  bbb    #  B\n    @any # X\n  cc # C\n\n  d # D\n",
+			"@switch\n\ta   # A\n\tbbb # B\n\t\t@any # X\n\tcc  # C\n\n\td # D\n"},
+		{8, "@switch\n  a #A\n  bbb\n  cc # C\n", "@switch\n\ta # A\n\tbbb\n\tcc # C\n"},
+
+		// Help continuation.
+		{8, "@switch\n  a # A \\\n     #more\n  bb # B\n", "@switch\n\ta  # A \\\n\t   # more\n\tbb # B\n"},
+
+		// Quoting.
+		{8, "@switch \"^-\"\n  \"a\"\n  `b`\n  \"x|y\"\n  \"c:d\"\n  \"e f\"\n  @cand takeFile `.*`\n",
+			"@switch \"^-\"\n\ta\n\tb\n\t\"x|y\"\n\t\"c:d\"\n\t\"e f\"\n\t@cand takeFile \".*\"\n"},
+		{8, "@switch ^a|b\n  x|y\n", "@switch \"^a|b\"\n\tx|y\n"},
+
+		// Comments.
+		{8, "//{\"tab\":8}\n@switch\n    // comment\n  a // trailing\n  bb  // trailing\n/* block */\n@label :x\n",
+			"//{\"tab\":8}\n@switch\n\t// comment\n\ta  // trailing\n\tbb // trailing\n/* block */\n@label :x\n"},
+
+		// Labels and commands.
+		{8, "@command   adb   :adb\n@label :adb\n  @call   :x\n", "@command adb :adb\n@label :adb\n\t@call :x\n"},
+	}
+	for _, v := range tests {
+		actual, err := Format(v.spec, compromise.NewDirectives().Tab(v.tabWidth))
+		assert.NoError(t, err, "%q", v.spec)
+		assert.Equal(t, v.expected, actual, "%q", v.spec)
+
+		// Formatting is idempotent.
+		again, err := Format(actual, compromise.NewDirectives())
+		assert.NoError(t, err, "%q", v.spec)
+		assert.Equal(t, actual, again, "%q", v.spec)
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	_, err := Format("@switch\n    a\n  b\n", compromise.NewDirectives().SetFilename("x.txt"))
+	assert.EqualError(t, err, `inconsistent indent for token "b", expected column is 1 at x.txt:3:3`)
+
+	_, err = Format("@switch\n  a@b\n", compromise.NewDirectives())
+	assert.Error(t, err)
+}
+
+func TestFormatGoSource(t *testing.T) {
+	src := "package main\n\n" +
+		"var spec = \"//\" + compromise.NewDirectives().SetSourceLocation().Tab(4).JSON() + `\n" +
+		"@switch\n" +
+		"    a  # A\n" +
+		"\tbb # B\n" +
+		"`\n\n" +
+		"var other = `\n" +
+		"@switch\n" +
+		"    a\n" +
+		"`\n"
+	expected := "package main\n\n" +
+		"var spec = \"//\" + compromise.NewDirectives().SetSourceLocation().Tab(4).JSON() + `\n" +
+		"@switch\n" +
+		"\ta  # A\n" +
+		"\tbb # B\n" +
+		"`\n\n" +
+		"var other = `\n" +
+		"@switch\n" +
+		"    a\n" +
+		"`\n"
+
+	actual, err := FormatGoSource("x.go", []byte(src))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(actual))
+
+	_, err = FormatGoSource("x.go", []byte("package main\n\nvar spec = `\n@switch\n    a\n  b\n`\n"))
+	assert.EqualError(t, err, `unable to format spec: inconsistent indent for token "b", expected column is 1 at x.go:6:3`)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "", Diff("x", "a\nb\n", "a\nb\n"))
+	assert.Equal(t, "--- x.orig\n+++ x\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -9,3 +9,4 @@\n i\n j\n k\n+l\n",
+		Diff("x", "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n", "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"))
+}
@@ -0,0 +1,113 @@
+package compfmt
+
+// Formats specs embedded in Go source files.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+// SpecVarName is the name of variables that hold specs in Go source files.
+const SpecVarName = "spec"
+
+// GoSpec is a spec in Go source.
+type GoSpec struct {
+	// Start and End are the byte offsets of the spec in the source, excluding the backquotes.
+	Start, End int
+
+	// Directives has the filename, the line number of the opening backquote and the tab width.
+	Directives *compromise.Directives
+}
+
+// FindGoSpecs returns the specs in Go source, which are raw string literals assigned to variables
+// named "spec", such as:
+//
+//	var spec = "//" + compromise.NewDirectives().SetSourceLocation().Tab(4).JSON() + `
+//	...
+//	`
+//
+// The tab width is taken from a Tab() call in the same expression, if any.
+func FindGoSpecs(filename string, src []byte) ([]GoSpec, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]GoSpec, 0)
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		vs, ok := n.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range vs.Names {
+			if name.Name != SpecVarName || i >= len(vs.Values) {
+				continue
+			}
+			d := compromise.NewDirectives()
+			var lit *ast.BasicLit
+			ast.Inspect(vs.Values[i], func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.BasicLit:
+					if n.Kind == token.STRING && n.Value[0] == '`' {
+						lit = n
+					}
+				case *ast.CallExpr:
+					if tabWidth, ok := getTabWidth(n); ok {
+						d.Tab(tabWidth)
+					}
+				}
+				return true
+			})
+			if lit != nil {
+				d.SetFilename(filename).SetStartLine(fset.Position(lit.Pos()).Line)
+				specs = append(specs, GoSpec{
+					Start:      fset.Position(lit.Pos()).Offset + 1, // Skip the backquote.
+					End:        fset.Position(lit.End()).Offset - 1,
+					Directives: d,
+				})
+			}
+		}
+		return false
+	})
+	return specs, nil
+}
+
+// FormatGoSource formats specs in Go source. See FindGoSpecs for what specs are formatted.
+func FormatGoSource(filename string, src []byte) ([]byte, error) {
+	specs, err := FindGoSpecs(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace from the last one, so the offsets of the earlier ones don't change.
+	ret := append([]byte(nil), src...)
+	for i := len(specs) - 1; i >= 0; i-- {
+		s := specs[i]
+		formatted, err := Format(string(src[s.Start:s.End]), s.Directives)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to format %s", SpecVarName)
+		}
+		ret = append(ret[:s.Start:s.Start], append([]byte(formatted), ret[s.End:]...)...)
+	}
+	return ret, nil
+}
+
+// getTabWidth returns N if a call is "X.Tab(N)".
+func getTabWidth(call *ast.CallExpr) (int, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Tab" || len(call.Args) != 1 {
+		return 0, false
+	}
+	arg, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || arg.Kind != token.INT {
+		return 0, false
+	}
+	tabWidth, err := strconv.Atoi(arg.Value)
+	return tabWidth, err == nil
+}
@@ -0,0 +1,112 @@
+package compfunc
+
+// Functions to cache results of slow candidate generators on disk.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/internal/compstore"
+	"os"
+	"strings"
+	"time"
+)
+
+// openListProbe is a word that no CandidateList would contain, used to tell whether
+// a CandidateList is "open" (i.e. it accepts any words) or "strict".
+const openListProbe = "\x00compromise-probe"
+
+func expandDependencies(env *compromise.Environment, dependencies []string) []string {
+	ret := make([]string, 0, len(dependencies))
+	for _, d := range dependencies {
+		ret = append(ret, env.Path(os.Expand(d, env.Getenv)))
+	}
+	return ret
+}
+
+func cacheKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// Cached returns candidates generated by generate, which are cached on disk for ttl with a given
+// key. The cache is also invalidated when any of the dependency files is modified.
+// Dependencies may contain environmental variables, e.g. "$OUT/module-info.json".
+// Empty results are never cached.
+func Cached(key string, ttl time.Duration, generate func() []compromise.Candidate, dependencies ...string) []compromise.Candidate {
+	return CachedEnv(compromise.CurrentEnvironment(), key, ttl, generate, dependencies...)
+}
+
+// CachedEnv is the same as Cached, but expands the dependencies with the environmental variables
+// and the current directory of an environment, e.g. CompleteContext.Environment().
+func CachedEnv(env *compromise.Environment, key string, ttl time.Duration, generate func() []compromise.Candidate, dependencies ...string) []compromise.Candidate {
+	deps := expandDependencies(env, dependencies)
+	fullKey := cacheKey(append([]string{key}, deps...)...)
+
+	if candidates, _, ok := compstore.LoadFuncCache(fullKey, ttl, deps); ok {
+		return candidates
+	}
+	ret := generate()
+	if len(ret) > 0 {
+		compstore.SaveFuncCache(fullKey, ret, false)
+	}
+	return ret
+}
+
+// CachedBytes is the same as Cached, but caches raw bytes, e.g. output of a slow command that
+// is parsed differently each time.
+func CachedBytes(key string, ttl time.Duration, generate func() []byte, dependencies ...string) []byte {
+	return CachedBytesEnv(compromise.CurrentEnvironment(), key, ttl, generate, dependencies...)
+}
+
+// CachedBytesEnv is the same as CachedBytes, but expands the dependencies in an environment.
+func CachedBytesEnv(env *compromise.Environment, key string, ttl time.Duration, generate func() []byte, dependencies ...string) []byte {
+	deps := expandDependencies(env, dependencies)
+	fullKey := cacheKey(append([]string{key}, deps...)...)
+
+	if data, ok := compstore.LoadFuncCacheBytes(fullKey, ttl, deps); ok {
+		return data
+	}
+	ret := generate()
+	if len(ret) > 0 {
+		compstore.SaveFuncCacheBytes(fullKey, ret)
+	}
+	return ret
+}
+
+// RegisterCached registers a candidate generator function just like Register, but its results are
+// cached on disk for ttl. The cache key consists of the function name, the arguments, the result of
+// keyFunc (which may be nil; e.g. return a device serial number) and the dependency files.
+// The cache is also invalidated when any of the dependency files is modified.
+// Dependencies may contain environmental variables, e.g. "$OUT/module-info.json".
+//
+// The function must generate the same candidates regardless of the word at cursor, because all of
+// the candidates are stored.
+func RegisterCached(name string, ttl time.Duration, keyFunc func(context compromise.CompleteContext) string, function interface{}, dependencies ...string) {
+	adapter := mustGetFunctionAdapter(function, name)
+
+	register(name, func(context compromise.CompleteContext, args []string) compromise.CandidateList {
+		deps := expandDependencies(context.Environment(), dependencies)
+		key := ""
+		if keyFunc != nil {
+			key = keyFunc(context)
+		}
+		fullKey := cacheKey(append([]string{strings.ToLower(name), strings.Join(args, "\x00"), key}, deps...)...)
+
+		candidates, open, ok := compstore.LoadFuncCache(fullKey, ttl, deps)
+		if !ok {
+			list := adapter(context, args)
+			if list == nil {
+				return nil
+			}
+			candidates = list.GetCandidate("")
+			open = list.MatchesFully(openListProbe)
+			if len(candidates) > 0 {
+				compstore.SaveFuncCache(fullKey, candidates, open)
+			}
+		}
+		if open {
+			return compromise.LazyCandidates(func(_ string) []compromise.Candidate {
+				return candidates
+			})
+		}
+		return compromise.StrictCandidates(candidates...)
+	})
+}
@@ -0,0 +1,138 @@
+package compfunc
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/internal/compstore"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testContext is a CompleteContext that only has an Environment.
+type testContext struct {
+	compromise.CompleteContext
+	env *compromise.Environment
+}
+
+func (c *testContext) Environment() *compromise.Environment {
+	return c.env
+}
+
+func TestRegisterCached(t *testing.T) {
+	dir := t.TempDir()
+	compenv.FuncCacheDir = filepath.Join(dir, "funccache")
+	dep := filepath.Join(dir, "dep.txt")
+	os.WriteFile(dep, []byte("x"), 0600)
+	os.Setenv("COMPROMISE_TEST_DIR", dir)
+
+	calls := 0
+	key := "a"
+	RegisterCached("testCachedStrict", time.Hour, func(_ compromise.CompleteContext) string { return key }, func(args []string) compromise.CandidateList {
+		calls++
+		return compromise.StrictCandidates(compromise.NewCandidate().SetValue("v1").SetHelp("h"), compromise.NewCandidate().SetValue("v2"))
+	}, "$COMPROMISE_TEST_DIR/dep.txt")
+
+	invoke := func(args ...string) compromise.CandidateList {
+		return Invoke("testCachedStrict", &testContext{env: compromise.CurrentEnvironment()}, args)
+	}
+
+	l := invoke()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, len(l.GetCandidate("")))
+	assert.True(t, l.MatchesFully("v1"))
+	assert.False(t, l.MatchesFully("x"))
+
+	l = invoke()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 1, len(l.GetCandidate("v1")))
+	assert.Equal(t, "h", l.GetCandidate("v1")[0].Help())
+	assert.True(t, l.MatchesFully("v1"))
+	assert.False(t, l.MatchesFully("x"))
+
+	// Different args or key.
+	invoke("arg")
+	assert.Equal(t, 2, calls)
+	key = "b"
+	invoke()
+	assert.Equal(t, 3, calls)
+	invoke()
+	assert.Equal(t, 3, calls)
+
+	// Dependency modified.
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(dep, future, future)
+	invoke()
+	assert.Equal(t, 4, calls)
+
+	// Cleared.
+	assert.Nil(t, compstore.ClearFuncCache())
+	invoke()
+	assert.Equal(t, 5, calls)
+}
+
+func TestRegisterCachedOpen(t *testing.T) {
+	compenv.FuncCacheDir = filepath.Join(t.TempDir(), "funccache")
+
+	calls := 0
+	RegisterCached("testCachedOpen", -1, nil, func() compromise.CandidateList {
+		calls++
+		return compromise.OpenCandidates(compromise.NewCandidate().SetValue("v1"))
+	})
+	ctx := &testContext{env: compromise.CurrentEnvironment()}
+	l := Invoke("testCachedOpen", ctx, nil)
+	assert.Equal(t, 1, calls)
+	assert.True(t, l.MatchesFully("x"))
+
+	// Always expired.
+	l = Invoke("testCachedOpen", ctx, nil)
+	assert.Equal(t, 2, calls)
+	assert.True(t, l.MatchesFully("x"))
+}
+
+func TestCached(t *testing.T) {
+	compenv.FuncCacheDir = filepath.Join(t.TempDir(), "funccache")
+
+	calls := 0
+	gen := func() []compromise.Candidate {
+		calls++
+		return []compromise.Candidate{compromise.NewCandidate().SetValue("v")}
+	}
+	assert.Equal(t, "v", Cached("k", time.Hour, gen)[0].Value())
+	assert.Equal(t, "v", Cached("k", time.Hour, gen)[0].Value())
+	assert.Equal(t, 1, calls)
+	Cached("k2", time.Hour, gen)
+	assert.Equal(t, 2, calls)
+
+	// Dependencies are relative to the environment.
+	dir := t.TempDir()
+	dep := filepath.Join(dir, "dep.txt")
+	os.WriteFile(dep, []byte("x"), 0600)
+	env := &compromise.Environment{Vars: []string{"COMPROMISE_TEST_DIR=" + dir}, Dir: "/"}
+	CachedEnv(env, "k", time.Hour, gen, "$COMPROMISE_TEST_DIR/dep.txt")
+	assert.Equal(t, 3, calls)
+	CachedEnv(&compromise.Environment{Dir: dir}, "k", time.Hour, gen, "dep.txt")
+	assert.Equal(t, 3, calls)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(dep, future, future)
+	CachedEnv(env, "k", time.Hour, gen, "$COMPROMISE_TEST_DIR/dep.txt")
+	assert.Equal(t, 4, calls)
+}
+
+func TestCachedBytes(t *testing.T) {
+	compenv.FuncCacheDir = filepath.Join(t.TempDir(), "funccache")
+
+	calls := 0
+	gen := func() []byte {
+		calls++
+		return []byte("line1\nline2\x00\n")
+	}
+	assert.Equal(t, "line1\nline2\x00\n", string(CachedBytes("k", time.Hour, gen)))
+	assert.Equal(t, "line1\nline2\x00\n", string(CachedBytes("k", time.Hour, gen)))
+	assert.Equal(t, 1, calls)
+
+	// Candidates and bytes with the same key don't mix.
+	assert.Equal(t, 0, len(Cached("k", time.Hour, func() []compromise.Candidate { return nil })))
+}
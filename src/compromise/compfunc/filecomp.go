@@ -12,35 +12,80 @@ import (
 )
 
 func init() {
-	Register("TakeFile", TakeFile)
-	Register("TakeDir", TakeDir)
+	Register("TakeFile", func(ctx compromise.CompleteContext, reFilenameMatcher string) compromise.CandidateList {
+		return TakeFileEnv(ctx.Environment(), reFilenameMatcher)
+	})
+	Register("TakeDir", func(ctx compromise.CompleteContext) compromise.CandidateList {
+		return TakeDirEnv(ctx.Environment())
+	})
 }
 
 func TakeFile(reFilenameMatcher string) compromise.CandidateList {
-	return compromise.LazyCandidates(func(prefix string) []compromise.Candidate {
-		return fileCompFunc(prefix, reFilenameMatcher, true, nil)
-	})
+	return TakeFileEnv(compromise.CurrentEnvironment(), reFilenameMatcher)
+}
+
+// TakeFileEnv is the same as TakeFile, but takes filenames relative to the current directory of
+// an environment, e.g. CompleteContext.Environment().
+func TakeFileEnv(env *compromise.Environment, reFilenameMatcher string) compromise.CandidateList {
+	return &fileCandidates{env, reFilenameMatcher, true, nil}
 }
 
 func TakeFileWithMapper(reFilenameMatcher string, mapper func(builder compromise.Candidate)) compromise.CandidateList {
-	return compromise.LazyCandidates(func(prefix string) []compromise.Candidate {
-		return fileCompFunc(prefix, reFilenameMatcher, true, mapper)
-	})
+	return TakeFileWithMapperEnv(compromise.CurrentEnvironment(), reFilenameMatcher, mapper)
+}
+
+// TakeFileWithMapperEnv is the same as TakeFileWithMapper, but takes filenames relative to the
+// current directory of an environment.
+func TakeFileWithMapperEnv(env *compromise.Environment, reFilenameMatcher string, mapper func(builder compromise.Candidate)) compromise.CandidateList {
+	return &fileCandidates{env, reFilenameMatcher, true, mapper}
 }
 
 func TakeDir() compromise.CandidateList {
-	return compromise.LazyCandidates(func(prefix string) []compromise.Candidate {
-		return fileCompFunc(prefix, "", false, nil)
-	})
+	return TakeDirEnv(compromise.CurrentEnvironment())
+}
+
+// TakeDirEnv is the same as TakeDir, but takes directories relative to the current directory of
+// an environment.
+func TakeDirEnv(env *compromise.Environment) compromise.CandidateList {
+	return &fileCandidates{env, "", false, nil}
+}
+
+// fileCandidates is a lazy CandidateList of files, which matches the filenames before checking
+// the files, so it needs the Matcher.
+type fileCandidates struct {
+	env               *compromise.Environment
+	reFilenameMatcher string
+	includeFiles      bool
+	mapper            func(builder compromise.Candidate)
+}
+
+var _ compromise.MatcherCandidateList = (*fileCandidates)(nil)
+
+func (f *fileCandidates) GetCandidate(prefix string) []compromise.Candidate {
+	return f.GetCandidateWithMatcher(compromise.DefaultMatcher, prefix)
+}
+
+func (f *fileCandidates) GetCandidateWithMatcher(m compromise.Matcher, prefix string) []compromise.Candidate {
+	return fileCompFunc(f.env, m, prefix, f.reFilenameMatcher, f.includeFiles, f.mapper)
+}
+
+func (f *fileCandidates) Matches(word string) bool {
+	// As lazy candidates, any non-empty string may match one of the files.
+	return len(word) > 0
+}
+
+func (f *fileCandidates) MatchesFully(word string) bool {
+	return len(word) > 0
 }
 
-func fileCompFunc(prefix, reFilenameMatcher string, includeFiles bool, mapper func(builder compromise.Candidate)) []compromise.Candidate {
+func fileCompFunc(env *compromise.Environment, m compromise.Matcher, prefix, reFilenameMatcher string, includeFiles bool, mapper func(builder compromise.Candidate)) []compromise.Candidate {
 	prefixDir, prefixFile := path.Split(prefix)
 	filenameRegexp := regexp.MustCompile(reFilenameMatcher)
 
 	compdebug.Debugf("fileCompFunc: %q (%q + %q), %q, %v\n", prefix, prefixDir, prefixFile, reFilenameMatcher, includeFiles)
 
-	files, err := os.ReadDir(utils.FirstNonEmpty(prefixDir, "."))
+	// Filenames are relative to the shell's current directory, not ours.
+	files, err := os.ReadDir(env.Path(utils.FirstNonEmpty(prefixDir, ".")))
 	if err != nil {
 		compdebug.Debugf("Unable to read directory \"%s\": %s\n", prefixDir, err)
 		return nil
@@ -58,21 +103,21 @@ func fileCompFunc(prefix, reFilenameMatcher string, includeFiles bool, mapper fu
 	for _, file := range files {
 		baseName := file.Name()
 		relPath := prefixDir + baseName
-		isDir := dry.FileIsDir(relPath)
+		isDir := dry.FileIsDir(env.Path(relPath))
 
 		compdebug.Debugf("  - %s [isdir=%v]\n", relPath, isDir)
 
-		if !compromise.StringMatches(baseName, prefixFile) {
+		if _, ok := m.Match(baseName, prefixFile); !ok {
 			continue
 		}
 		compdebug.Debug("      [prefix match]\n")
 
 		if isDir {
-			ret = append(ret, conv(compromise.NewCandidate().SetValue(relPath+"/").SetContinues(!comptest.IsEmptyDir(relPath))))
+			ret = append(ret, conv(compromise.NewCandidate().SetValue(relPath+"/").SetContinues(!comptest.IsEmptyDir(env.Path(relPath))).SetFile(true)))
 			continue
 		}
 		if includeFiles && len(filenameRegexp.FindStringIndex(baseName)) > 0 {
-			ret = append(ret, conv(compromise.NewCandidate().SetValue(relPath)))
+			ret = append(ret, conv(compromise.NewCandidate().SetValue(relPath).SetFile(true)))
 		}
 	}
 	compdebug.Dump("Filecopletion result=", ret)
@@ -1,8 +1,8 @@
 package compfunc
 
 import (
+	"github.com/omakoto/compromise/src/compromise"
 	"github.com/stretchr/testify/assert"
-	"os"
 	"testing"
 )
 
@@ -46,8 +46,8 @@ func TestFileCompFunc(t *testing.T) {
 		{"/proc/1/", "../self/", `s$`, false, []string{"../self/cwd/", "../self/fd/", "../self/fdinfo/"}, []string{"../self/limits ", "../self/maps ", "../self/exe "}},
 	}
 	for i, v := range tests {
-		assert.NoError(t, os.Chdir(v.cwd), "chdir")
-		res := toStrings(fileCompFunc(v.prefix, v.mask, v.includeFiles, nil))
+		env := &compromise.Environment{Dir: v.cwd}
+		res := toStrings(fileCompFunc(env, compromise.DefaultMatcher, v.prefix, v.mask, v.includeFiles, nil))
 
 		for _, e := range v.expectedFiles {
 			assert.Contains(t, res, e, "#%d %q vs %q", i, e, res)
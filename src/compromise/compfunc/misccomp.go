@@ -5,6 +5,7 @@ import (
 	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compdebug"
 	"github.com/omakoto/compromise/src/compromise/comptest"
+	"github.com/omakoto/go-common/src/shell"
 	"os"
 	"strings"
 )
@@ -47,16 +48,65 @@ func ReadCandidateListFromFile(filename string) compromise.CandidateList {
 	})
 }
 
+// ReadCandidateListFromFileWithHelp is similar to ReadCandidateListFromFile, but a line may have a
+// help after a tab, as in "value<TAB>help". help is used for lines without one.
+func ReadCandidateListFromFileWithHelp(filename, help string) compromise.CandidateList {
+	return compromise.LazyCandidates(func(_ string) []compromise.Candidate {
+		return StringsToCandidates(ReadLinesFromFile(filename), valueAndHelpBuilder(help))
+	})
+}
+
+// BuildCandidateListFromExec executes a command with /bin/sh, with a given word as $1, and builds
+// a CandidateList from the output. Each line is a candidate, which may have a help after a tab, as
+// in "value<TAB>help". help is used for lines without one.
+func BuildCandidateListFromExec(env *compromise.Environment, command, word, help string) compromise.CandidateList {
+	return BuildCandidateListFromCommandWithBuilderEnv(env, "set -- "+shell.Escape(word)+"; "+command, valueAndHelpBuilder(help))
+}
+
+func valueAndHelpBuilder(help string) func(line int, s string, c compromise.Candidate) {
+	return func(line int, s string, c compromise.Candidate) {
+		value, h, found := strings.Cut(strings.TrimRight(s, "\r"), "\t")
+		if !found {
+			h = help
+		}
+		c.SetValue(value).SetHelp(h)
+	}
+}
+
+// ExpandPath expands environment variables and a leading ~ in a path, and resolves it against the
+// current directory of an environment.
+func ExpandPath(env *compromise.Environment, path string) string {
+	path = os.Expand(path, env.Getenv)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home := env.Getenv("HOME"); home != "" {
+			path = home + path[1:]
+		}
+	}
+	return env.Path(path)
+}
+
 // BuildCandidateListFromCommand executes a command wih /bin/sh and build a CandidateList from the output,
 // using each line as a single Candidate.
 func BuildCandidateListFromCommand(command string) compromise.CandidateList {
-	return BuildCandidateListFromCommandWithMap(command, nil)
+	return BuildCandidateListFromCommandEnv(compromise.CurrentEnvironment(), command)
+}
+
+// BuildCandidateListFromCommandEnv is the same as BuildCandidateListFromCommand, but executes the
+// command in an environment, e.g. CompleteContext.Environment().
+func BuildCandidateListFromCommandEnv(env *compromise.Environment, command string) compromise.CandidateList {
+	return BuildCandidateListFromCommandWithMapEnv(env, command, nil)
 }
 
 // BuildCandidateListFromCommandWithMap executes a command wih /bin/sh and build a CandidateList from the output,
 // using each line as a single Candidate. If mapFunc is given, it'll be applied to each line.
 func BuildCandidateListFromCommandWithMap(command string, mapFunc func(line int, s string) string) compromise.CandidateList {
-	return BuildCandidateListFromCommandWithBuilder(command, func(line int, s string, c compromise.Candidate) {
+	return BuildCandidateListFromCommandWithMapEnv(compromise.CurrentEnvironment(), command, mapFunc)
+}
+
+// BuildCandidateListFromCommandWithMapEnv is the same as BuildCandidateListFromCommandWithMap, but
+// executes the command in an environment.
+func BuildCandidateListFromCommandWithMapEnv(env *compromise.Environment, command string, mapFunc func(line int, s string) string) compromise.CandidateList {
+	return BuildCandidateListFromCommandWithBuilderEnv(env, command, func(line int, s string, c compromise.Candidate) {
 		if mapFunc != nil {
 			s = mapFunc(line, s)
 		}
@@ -69,13 +119,19 @@ func BuildCandidateListFromCommandWithMap(command string, mapFunc func(line int,
 // BuildCandidateListFromCommandWithBuilder executes a command wih /bin/sh and build a CandidateList from the output,
 // converting using each line into a single Candidate with mapFunc.
 func BuildCandidateListFromCommandWithBuilder(command string, mapFunc func(line int, s string, c compromise.Candidate)) compromise.CandidateList {
+	return BuildCandidateListFromCommandWithBuilderEnv(compromise.CurrentEnvironment(), command, mapFunc)
+}
+
+// BuildCandidateListFromCommandWithBuilderEnv is the same as
+// BuildCandidateListFromCommandWithBuilder, but executes the command in an environment.
+func BuildCandidateListFromCommandWithBuilderEnv(env *compromise.Environment, command string, mapFunc func(line int, s string, c compromise.Candidate)) compromise.CandidateList {
 	return compromise.LazyCandidates(func(_ string) []compromise.Candidate {
 		if mapFunc == nil {
 			mapFunc = func(line int, s string, c compromise.Candidate) {
 				c.SetValue(s)
 			}
 		}
-		output, _ := ExecAndGetStdout(command)
+		output, _ := ExecAndGetStdoutEnv(env, command)
 
 		return StringsToCandidates(strings.Split(string(output), "\n"), mapFunc)
 	})
@@ -111,3 +167,8 @@ func TakeInteger() compromise.CandidateList {
 func ExecAndGetStdout(command string) ([]byte, error) {
 	return comptest.ExecAndGetStdout(command)
 }
+
+// ExecAndGetStdoutEnv is the same as ExecAndGetStdout, but executes the command in an environment.
+func ExecAndGetStdoutEnv(env *compromise.Environment, command string) ([]byte, error) {
+	return comptest.ExecAndGetStdoutEnv(env, command)
+}
@@ -0,0 +1,28 @@
+package compfunc
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	env := &compromise.Environment{Vars: []string{"HOME=/home/x", "COMPROMISE_TEST_DIR=/tmp/x"}, Dir: "/work"}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"a/b", "/work/a/b"},
+		{"/a/b", "/a/b"},
+		{"~", "/home/x"},
+		{"~/a", "/home/x/a"},
+		{"~a", "/work/~a"},
+		{"a/~/b", "/work/a/~/b"},
+		{"$COMPROMISE_TEST_DIR/a", "/tmp/x/a"},
+		{"${COMPROMISE_TEST_DIR}/a", "/tmp/x/a"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, ExpandPath(env, v.path), v.path)
+	}
+}
@@ -0,0 +1,105 @@
+package compfunc
+
+// Predicates, which are registered Go functions used by "@if go".
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/go-common/src/common"
+	"reflect"
+	"strings"
+)
+
+// These are the predicate types that are allowed to be registered.
+type (
+	simplePredicate            = func() bool
+	oneArgPredicate            = func(arg string) bool
+	varArgPredicate            = func(args []string) bool
+	simplePredicateWithContext = func(context compromise.CompleteContext) bool
+	oneArgPredicateWithContext = func(context compromise.CompleteContext, arg string) bool
+	varArgPredicateWithContext = func(context compromise.CompleteContext, args []string) bool
+)
+
+func getPredicateAdapter(predicate interface{}, name string) (varArgPredicateWithContext, error) {
+	firstArg := func(args []string) string {
+		if len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	}
+
+	switch f := predicate.(type) {
+	case simplePredicate:
+		return func(context compromise.CompleteContext, args []string) bool {
+			return f()
+		}, nil
+	case oneArgPredicate:
+		return func(context compromise.CompleteContext, args []string) bool {
+			return f(firstArg(args))
+		}, nil
+	case varArgPredicate:
+		return func(context compromise.CompleteContext, args []string) bool {
+			return f(args)
+		}, nil
+	case simplePredicateWithContext:
+		return func(context compromise.CompleteContext, args []string) bool {
+			return f(context)
+		}, nil
+	case oneArgPredicateWithContext:
+		return func(context compromise.CompleteContext, args []string) bool {
+			return f(context, firstArg(args))
+		}, nil
+	case varArgPredicateWithContext:
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid signature of predicate %s: %v", name, reflect.TypeOf(predicate))
+}
+
+// All registered predicates.
+var predicates = make(map[string]varArgPredicateWithContext)
+
+// RegisterPredicate registers a function that returns a bool, which can be used as a condition
+// with "@if go NAME [ARGS...]". Only predicate types defined in this file are allowed.
+func RegisterPredicate(name string, predicate interface{}) {
+	if common.DebugEnabled {
+		common.Debugf("Registering predicate: name=%s value=%v type=%v", name, predicate, reflect.TypeOf(predicate))
+	}
+	if predicate == nil {
+		panic("predicate cannot be nil")
+	}
+	adapter, err := getPredicateAdapter(predicate, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	if len(name) == 0 {
+		panic("predicate name must not be empty")
+	}
+	lname := strings.ToLower(name)
+	if _, ok := predicates[lname]; ok {
+		panic(fmt.Sprintf("predicate \"%s\" already defined", name))
+	}
+	predicates[lname] = adapter
+}
+
+// PredicateDefined returns whether a predicate with a given name is registered.
+func PredicateDefined(name string) error {
+	if _, ok := predicates[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("predicate \"%s\" not defined", name)
+	}
+	return nil
+}
+
+// InvokePredicate invokes a registered predicate.
+func InvokePredicate(name string, context compromise.CompleteContext, args []string) (ret bool) {
+	predicate, ok := predicates[strings.ToLower(name)]
+	if !ok {
+		panic(fmt.Sprintf("predicate \"%s\" not defined", name)) // Must have been verified already.
+	}
+
+	compdebug.Time("Call go predicate: "+name, func() {
+		compdebug.Debugf("Calling %s with args %v\n", name, args)
+		ret = predicate(context, args)
+	})
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/omakoto/compromise/src/compromise/compdebug"
 	"github.com/omakoto/go-common/src/common"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -105,6 +106,9 @@ func getFunctionAdapter(function interface{}, name string) (varArgCandidateGener
 var (
 	// All registered functions.
 	funcs = make(map[string]varArgCandidateGeneratorWithContext)
+
+	// Names of the registered functions, as they're registered.
+	funcNames = make([]string, 0)
 )
 
 // Register registers a new callback function associated with a given name.
@@ -113,13 +117,10 @@ func Register(name string, function interface{}) {
 	if common.DebugEnabled {
 		common.Debugf("Registering function: name=%s value=%v type=%v", name, function, reflect.TypeOf(function))
 	}
-	if len(name) == 0 {
-		panic("function name must not be empty")
-	}
-	lname := strings.ToLower(name)
-	if _, ok := funcs[lname]; ok {
-		panic(fmt.Sprintf("function \"%s\" already defined", name))
-	}
+	register(name, mustGetFunctionAdapter(function, name))
+}
+
+func mustGetFunctionAdapter(function interface{}, name string) varArgCandidateGeneratorWithContext {
 	if function == nil {
 		panic("function cannot be nil")
 	}
@@ -127,7 +128,26 @@ func Register(name string, function interface{}) {
 	if err != nil {
 		panic(err.Error())
 	}
+	return adapter
+}
+
+func register(name string, adapter varArgCandidateGeneratorWithContext) {
+	if len(name) == 0 {
+		panic("function name must not be empty")
+	}
+	lname := strings.ToLower(name)
+	if _, ok := funcs[lname]; ok {
+		panic(fmt.Sprintf("function \"%s\" already defined", name))
+	}
 	funcs[lname] = adapter
+	funcNames = append(funcNames, name)
+}
+
+// Names returns the names of all the registered functions, sorted.
+func Names() []string {
+	ret := append([]string(nil), funcNames...)
+	sort.Strings(ret)
+	return ret
 }
 
 // Defined returns whether a function with a given name is registered.
@@ -5,21 +5,71 @@ import (
 	"github.com/omakoto/compromise/src/compromise/compdebug"
 )
 
+var (
+	resetHooks []func()
+)
+
+// AddResetHook registers a function that resets states that functions set during completion, e.g.
+// global variables. Hooks are called before each completion in a long-lived process, so that
+// completion always starts with the initial states, just like in a new process.
+func AddResetHook(hook func()) {
+	resetHooks = append(resetHooks, hook)
+}
+
+// Reset calls all the registered reset hooks.
+func Reset() {
+	for _, hook := range resetHooks {
+		hook()
+	}
+}
+
+func resetStringOnReset(target *string) {
+	initial := *target
+	AddResetHook(func() {
+		*target = initial
+	})
+}
+
+// SetState returns a function that stores a value in the state of the completion, which other
+// functions read with CompleteContext.Get.
+func SetState(key, value string) func(context compromise.CompleteContext) {
+	return func(context compromise.CompleteContext) {
+		context.Set(key, value)
+	}
+}
+
+// CaptureState returns a function that stores the last matched word in the state of the
+// completion, which other functions read with CompleteContext.Get.
+func CaptureState(key string) func(context compromise.CompleteContext) {
+	return func(context compromise.CompleteContext) {
+		context.Set(key, context.WordAt(-1))
+	}
+}
+
+// Deprecated: Use SetState, which is scoped to a single completion.
 func SetBool(target *bool, value bool) func() {
+	initial := *target
+	AddResetHook(func() {
+		*target = initial
+	})
 	return func() {
 		*target = value
 		compdebug.Debugf("  SetBool set %v to true\n", target)
 	}
 }
 
+// Deprecated: Use SetState, which is scoped to a single completion.
 func SetString(target *string, value string) func() {
+	resetStringOnReset(target)
 	return func() {
 		*target = value
 		compdebug.Debugf("  SetString set %v to %q\n", target, value)
 	}
 }
 
+// Deprecated: Use CaptureState, which is scoped to a single completion.
 func SetLastSeenString(target *string) func(context compromise.CompleteContext) {
+	resetStringOnReset(target)
 	return func(context compromise.CompleteContext) {
 		s := context.WordAt(-1)
 		*target = s
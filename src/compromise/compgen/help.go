@@ -0,0 +1,158 @@
+// Package compgen generates a starting spec from the --help output of a command.
+package compgen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Option is a flag found in a help text, e.g. "-o, --output=FILE  Write to FILE".
+type Option struct {
+	Names []string // e.g. "-o" and "--output"
+	Arg   string   // e.g. "FILE", or "" if it takes no value
+	Help  string
+
+	// Joined is set when the value may be in the same word, e.g. "--output=FILE".
+	Joined bool
+
+	// Optional is set when the value is optional, e.g. "--color[=WHEN]".
+	Optional bool
+}
+
+// Subcommand is a subcommand found in a help text, e.g. "build  Build the packages".
+type Subcommand struct {
+	Names []string // e.g. "build", and aliases if any
+	Help  string
+}
+
+// Help is what's found in a help text.
+type Help struct {
+	Options     []*Option
+	Subcommands []*Subcommand
+}
+
+var (
+	// A flag name, optionally followed by a value, e.g. "--color[=WHEN]".
+	flagRe = regexp.MustCompile(`^(--?[A-Za-z0-9?][A-Za-z0-9_.+?-]*)(.*)$`)
+
+	// A line in a subcommand list, e.g. "build, b    Build the packages".
+	subcommandRe = regexp.MustCompile(`^([a-z][\w:.-]*(?:,\s*[a-z][\w:.-]*)*)(?:\s{2,}(.*))?$`)
+
+	// A header of a subcommand list, e.g. "Available Commands:" or "COMMANDS".
+	subcommandHeaderRe = regexp.MustCompile(`(?i)^[\w ]*commands:?$`)
+
+	// Two or more spaces between a flag or a subcommand and its help.
+	gapRe = regexp.MustCompile(`\s{2,}`)
+)
+
+// line is a line in a help text.
+type line struct {
+	indent int
+	text   string // Without the indent.
+}
+
+func splitLines(text string) []line {
+	ret := make([]line, 0)
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimRight(strings.ReplaceAll(l, "\t", "        "), " \r")
+		t := strings.TrimLeft(l, " ")
+		ret = append(ret, line{len(l) - len(t), t})
+	}
+	return ret
+}
+
+// ParseHelp finds options in GNU/getopt style layouts, and subcommands in lists under a header
+// such as "Commands:", in a help text.
+func ParseHelp(text string) *Help {
+	h := &Help{}
+	seen := make(map[string]bool)
+	lines := splitLines(text)
+	inSubcommands := false
+
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		if l.text == "" {
+			continue
+		}
+		if l.indent == 0 {
+			// A header starts or ends a subcommand list.
+			inSubcommands = subcommandHeaderRe.MatchString(l.text)
+			continue
+		}
+
+		var help *string
+		switch {
+		case strings.HasPrefix(l.text, "-"):
+			o := parseOption(l.text)
+			if o == nil || seen[o.Names[0]] {
+				continue
+			}
+			seen[o.Names[0]] = true
+			h.Options = append(h.Options, o)
+			help = &o.Help
+		case inSubcommands:
+			m := subcommandRe.FindStringSubmatch(l.text)
+			if m == nil {
+				continue
+			}
+			s := &Subcommand{Names: regexp.MustCompile(`,\s*`).Split(m[1], -1), Help: m[2]}
+			if seen[s.Names[0]] {
+				continue
+			}
+			seen[s.Names[0]] = true
+			h.Subcommands = append(h.Subcommands, s)
+			help = &s.Help
+		default:
+			continue
+		}
+
+		// Following lines with a deeper indent continue the help.
+		for ; i+1 < len(lines); i++ {
+			next := lines[i+1]
+			if next.text == "" || next.indent <= l.indent || strings.HasPrefix(next.text, "-") {
+				break
+			}
+			*help = strings.TrimSpace(*help + " " + next.text)
+		}
+	}
+	return h
+}
+
+// parseOption parses a line starting with a flag, e.g. "-o, --output=FILE  Write to FILE".
+func parseOption(text string) *Option {
+	spec, help := text, ""
+	if loc := gapRe.FindStringIndex(text); loc != nil {
+		spec, help = text[:loc[0]], text[loc[1]:]
+	}
+
+	o := &Option{Help: help}
+	for _, f := range strings.Fields(strings.ReplaceAll(spec, ",", " ")) {
+		m := flagRe.FindStringSubmatch(f)
+		if m == nil {
+			if len(o.Names) == 0 {
+				return nil
+			}
+			// A value after a space, e.g. "-o FILE".
+			setArg(o, f)
+			continue
+		}
+		o.Names = append(o.Names, m[1])
+		if strings.HasPrefix(m[2], "=") || strings.HasPrefix(m[2], "[=") {
+			o.Joined = true
+		}
+		setArg(o, m[2])
+	}
+	if len(o.Names) == 0 {
+		return nil
+	}
+	return o
+}
+
+func setArg(o *Option, arg string) {
+	optional := strings.HasPrefix(arg, "[")
+	arg = strings.Trim(arg, "=[]<>")
+	if arg != "" && o.Arg == "" {
+		o.Arg = arg
+		o.Optional = optional
+	}
+}
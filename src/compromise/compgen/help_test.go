@@ -0,0 +1,85 @@
+package compgen
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/compmain"
+	"github.com/omakoto/compromise/src/compromise/comptest"
+	"github.com/omakoto/compromise/src/compromise/internal/golden"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFixtures generates a spec from each testdata/*.help, and compares it with the .spec file.
+func TestFixtures(t *testing.T) {
+	golden.ForEach(t, "testdata/*.help", func(t *testing.T, file, help string) {
+		base := strings.TrimSuffix(file, ".help")
+		spec := ParseHelp(help).Spec(filepath.Base(base))
+		golden.Assert(t, base+".spec", spec)
+		assert.Empty(t, parser.Lint(spec, compromise.NewDirectives()), file)
+	})
+}
+
+func TestParseOption(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected *Option
+	}{
+		{"-a, --all  All", &Option{[]string{"-a", "--all"}, "", "All", false, false}},
+		{"-o FILE, --output=FILE  Output", &Option{[]string{"-o", "--output"}, "FILE", "Output", true, false}},
+		{"--color[=WHEN]", &Option{[]string{"--color"}, "WHEN", "", true, true}},
+		{"-I <dir>   Include", &Option{[]string{"-I"}, "dir", "Include", false, false}},
+		{"-d [LEVEL]  Debug", &Option{[]string{"-d"}, "LEVEL", "Debug", false, true}},
+		{"-v --verbose", &Option{[]string{"-v", "--verbose"}, "", "", false, false}},
+		{"- read from stdin", nil},
+		{"-", nil},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseOption(v.text), v.text)
+	}
+}
+
+func TestFromCommand(t *testing.T) {
+	comptest.InjectCommandOutput(`^/usr/bin/fake-tool --help$`, "  -x, --extra  Extra\n")
+	assert.Equal(t, `@command "fake-tool"
+
+@switchloop "^-"
+	-x|--extra # Extra
+`, FromCommand("", []string{"/usr/bin/fake-tool", "--help"}))
+	assert.Equal(t, "@command \"tool\"\n\n@switchloop \"^-\"\n\t-x|--extra # Extra\n", FromCommand("tool", []string{"/usr/bin/fake-tool", "--help"}))
+}
+
+func TestComplete(t *testing.T) {
+	prevShell := os.Getenv("COMPROMISE_SHELL")
+	os.Setenv("COMPROMISE_SHELL", "tester")
+	defer os.Setenv("COMPROMISE_SHELL", prevShell)
+
+	// Don't reuse candidates of completions in other tests.
+	prevTimeout := compenv.CacheTimeout
+	compenv.CacheTimeout = -1
+	defer func() { compenv.CacheTimeout = prevTimeout }()
+
+	spec := ParseHelp(golden.Read(t, "testdata/gnu.help")).Spec("gnu")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"gnu", "--bl"}, "--block-size=+ #\"with -l, scale sizes by SIZE when printing them; e.g., '--block-size=M'; see SIZE format below\"\n"},
+		{[]string{"gnu", "--block-size=1"}, "! #\"<SIZE>\"\n"},
+		{[]string{"gnu", "--ignore=*.o"}, "! #\"<PATTERN>\"\n"},
+		{[]string{"gnu", "-I*.o"}, "! #\"<PATTERN>\"\n"},
+		{[]string{"gnu", "--color=al"}, ""},
+	}
+	for _, v := range tests {
+		buf := &bytes.Buffer{}
+		compmain.HandleCompletionRaw(func() string {
+			return spec
+		}, v.args, nil, buf)
+		assert.Equal(t, v.expected, buf.String(), "%q", v.args)
+	}
+}
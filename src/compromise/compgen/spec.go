@@ -0,0 +1,64 @@
+package compgen
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfmt"
+	"github.com/omakoto/compromise/src/compromise/comptest"
+	"github.com/omakoto/compromise/src/compromise/internal/specgen"
+	"github.com/omakoto/go-common/src/shell"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Spec returns a spec for a command, with the options in an @switchloop, followed by the
+// subcommands in a @switch, if any.
+func (h *Help) Spec(command string) string {
+	b := strings.Builder{}
+	b.WriteString("@command " + strconv.Quote(command) + "\n")
+
+	if len(h.Options) > 0 {
+		b.WriteString("\n@switchloop \"^-\"\n")
+		for _, o := range h.Options {
+			b.WriteString("\t" + strings.Join(o.Names, "|") + specgen.HelpComment(o.Help) + "\n")
+			if o.Arg == "" {
+				continue
+			}
+			if o.Joined {
+				b.WriteString("\t\t@joined\n")
+			}
+			// Without children, @joined takes an optional value only in the same word.
+			if !o.Optional {
+				b.WriteString("\t\t" + specgen.ValueSpec(o.Arg) + "\n")
+			}
+		}
+	}
+	if len(h.Subcommands) > 0 {
+		b.WriteString("\n@switch\n")
+		for _, s := range h.Subcommands {
+			b.WriteString("\t" + strings.Join(s.Names, "|") + specgen.HelpComment(s.Help) + "\n")
+		}
+	}
+
+	// Align the help strings.
+	spec := b.String()
+	if formatted, err := compfmt.Format(spec, compromise.NewDirectives()); err == nil {
+		spec = formatted
+	}
+	return spec
+}
+
+// FromCommand runs a command, e.g. "git --help", and returns a spec from the output.
+// The spec is for a given command name, or the base name of the first argument if it's empty.
+func FromCommand(name string, args []string) string {
+	escaped := make([]string, 0, len(args))
+	for _, a := range args {
+		escaped = append(escaped, shell.Escape(a))
+	}
+	// Some commands exit with a non-zero status after printing the help, so ignore errors.
+	out, _ := comptest.ExecAndGetStdout(strings.Join(escaped, " "))
+	if name == "" {
+		name = filepath.Base(args[0])
+	}
+	return ParseHelp(string(out)).Spec(name)
+}
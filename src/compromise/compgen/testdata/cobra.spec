@@ -0,0 +1,15 @@
+@command "cobra"
+
+@switchloop "^-"
+	--config     # config file (default is $HOME/.mytool.yaml)
+		@any # <string>
+	-C|--dir     # Change to the directory
+		@any # <string>
+	-h|--help    # help for mytool
+	-v|--verbose # Verbose output
+
+@switch
+	build|b    # Build the packages
+	completion # Generate the autocompletion script for the specified shell
+	help       # Help about any command
+	run        # Run a package, after building it
@@ -0,0 +1,18 @@
+@command "gnu"
+
+@switchloop "^-"
+	-a|--all        # do not ignore entries starting with .
+	-A|--almost-all # do not list implied . and ..
+	--block-size    # with -l, scale sizes by SIZE when printing them; e.g., '--block-size=M'; see SIZE format below
+		@joined
+		@any # <SIZE>
+	--color         # color the output WHEN; more info below
+		@joined
+	-I|--ignore     # do not list implied entries matching shell PATTERN
+		@joined
+		@any # <PATTERN>
+	-T|--tabsize    # assume tab stops at each COLS instead of 8
+		@joined
+		@any # <COLS>
+	-1              # list one file per line
+	--help          # display this help and exit
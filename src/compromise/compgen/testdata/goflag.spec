@@ -0,0 +1,8 @@
+@command "goflag"
+
+@switchloop "^-"
+	-n # Number of items (default 10)
+		@any # <int>
+	-o # Write to file
+		@cand takeFile
+	-v # Verbose output
@@ -0,0 +1,207 @@
+package compimport
+
+import (
+	"github.com/omakoto/go-common/src/shell"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Start of a function, e.g. "_mytool() {", whose brace may be in the next line.
+	bashFuncRe = regexp.MustCompile(`^\s*(?:function\s+([\w:-]+)\s*(?:\(\s*\))?|([\w:-]+)\s*\(\s*\))\s*\{?\s*$`)
+
+	// Start of a "case" on the previous word, e.g. `case "$prev" in`.
+	bashCasePrevRe = regexp.MustCompile(`^case\s+"?\$\{?(?:prev|COMP_WORDS\[COMP_CWORD-1\])\}?"?\s+in\b`)
+
+	// A pattern of a branch in a "case", e.g. "-o|--output)", followed by the body, if any.
+	bashBranchRe = regexp.MustCompile(`^\(?([^()]+)\)\s*(.*)$`)
+
+	// Words given to compgen, e.g. `compgen -W "a b c"`.
+	bashCompgenWordsRe = regexp.MustCompile(`compgen\s+-W\s+(?:"([^"]*)"|'([^']*)'|(\S+))`)
+
+	bashDirRe  = regexp.MustCompile(`compgen\s+-d\b|_filedir\s+-d\b|-A\s+directory\b`)
+	bashFileRe = regexp.MustCompile(`compgen\s+-f\b|_filedir\b|-A\s+file\b`)
+)
+
+// FromBash converts a simple bash completion script into a spec. It supports
+// "complete -W WORDS CMD", and "complete -F FUNC CMD" with a function that uses compgen and
+// "case $prev in" for the values of options.
+func FromBash(script string) string {
+	funcs := bashFunctions(script)
+
+	cs := &commands{}
+	for _, line := range joinContinuedLines(script) {
+		words := shell.Split(strings.TrimSpace(line))
+		if len(words) == 0 || words[0] != "complete" {
+			continue
+		}
+		var wordList, funcName string
+		var files, dirs bool
+		var names []string
+		for i := 1; i < len(words); i++ {
+			next := func() string {
+				if i+1 < len(words) {
+					i++
+					return words[i]
+				}
+				return ""
+			}
+			switch w := words[i]; w {
+			case "-W":
+				wordList = shell.Unescape(next())
+			case "-F":
+				funcName = next()
+			case "-f":
+				files = true
+			case "-d":
+				dirs = true
+			case "-A":
+				switch next() {
+				case "file":
+					files = true
+				case "directory":
+					dirs = true
+				}
+			case "-o", "-G", "-X", "-P", "-S", "-C":
+				next()
+			default:
+				if strings.HasPrefix(w, "#") {
+					i = len(words)
+				} else if !strings.HasPrefix(w, "-") {
+					names = append(names, shell.Unescape(w))
+				}
+			}
+		}
+
+		for _, name := range names {
+			c := cs.get(name)
+			if wordList != "" {
+				addBashWords(c, wordList)
+			}
+			if funcName != "" {
+				if body, ok := funcs[funcName]; ok {
+					addBashFunction(c, body)
+				} else {
+					c.args = append(c.args, lostAny("complete -F "+funcName))
+				}
+			}
+			if dirs {
+				c.args = append(c.args, "@cand takeDir")
+			} else if files {
+				c.args = append(c.args, "@cand takeFile")
+			}
+		}
+	}
+	return cs.spec()
+}
+
+// bashFunctions returns the bodies of the functions in a script, whose closing brace is at the
+// start of a line.
+func bashFunctions(script string) map[string][]string {
+	ret := make(map[string][]string)
+	lines := joinContinuedLines(script)
+	for i := 0; i < len(lines); i++ {
+		m := bashFuncRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		body := make([]string, 0)
+		for i++; i < len(lines) && !strings.HasPrefix(lines[i], "}"); i++ {
+			if l := strings.TrimSpace(lines[i]); l != "{" {
+				body = append(body, l)
+			}
+		}
+		ret[m[1]+m[2]] = body
+	}
+	return ret
+}
+
+// addBashWords adds words, e.g. from "complete -W", either as options or arguments.
+func addBashWords(c *command, raw string) {
+	if strings.ContainsAny(raw, "$`") {
+		c.args = append(c.args, lostAny(raw))
+		return
+	}
+	for _, w := range strings.Fields(raw) {
+		if strings.HasPrefix(w, "-") {
+			c.option([]string{w})
+		} else {
+			c.addArg(w, "")
+		}
+	}
+}
+
+// addBashFunction adds what's found in a completion function.
+func addBashFunction(c *command, body []string) {
+	rest := make([]string, 0)
+	var branches [][2]string
+	for i := 0; i < len(body); i++ {
+		if !bashCasePrevRe.MatchString(body[i]) {
+			rest = append(rest, body[i])
+			continue
+		}
+		// Each branch of the case gives the value of the options in the pattern.
+		for i++; i < len(body) && body[i] != "esac"; i++ {
+			m := bashBranchRe.FindStringSubmatch(body[i])
+			if m == nil {
+				continue
+			}
+			branch := []string{m[2]}
+			for ; !strings.Contains(branch[len(branch)-1], ";;") && i+1 < len(body) && body[i+1] != "esac"; i++ {
+				branch = append(branch, body[i+1])
+			}
+			branches = append(branches, [2]string{m[1], strings.TrimSpace(strings.ReplaceAll(strings.Join(branch, " "), ";;", ""))})
+		}
+	}
+
+	// Outside of the case, compgen gives the options and the arguments.
+	for _, line := range rest {
+		for _, m := range bashCompgenWordsRe.FindAllStringSubmatch(line, -1) {
+			addBashWords(c, m[1]+m[2]+m[3])
+		}
+		if bashDirRe.MatchString(line) {
+			c.args = append(c.args, "@cand takeDir")
+		} else if bashFileRe.MatchString(line) {
+			c.args = append(c.args, "@cand takeFile")
+		}
+	}
+	for _, b := range branches {
+		addBashBranch(c, b[0], b[1])
+	}
+}
+
+// addBashBranch adds the value for the words in the pattern of a branch in "case $prev in".
+func addBashBranch(c *command, pattern, body string) {
+	words := make([]string, 0)
+	for _, p := range strings.Split(pattern, "|") {
+		p = shell.Unescape(strings.TrimSpace(p))
+		if p == "*" {
+			// The default branch, for the other words.
+			return
+		}
+		words = append(words, p)
+	}
+
+	var value string
+	switch m := bashCompgenWordsRe.FindStringSubmatch(body); {
+	case m != nil && !strings.ContainsAny(m[1]+m[2]+m[3], "$`"):
+		value = strings.Join(wordsLiterals(strings.Fields(m[1]+m[2]+m[3])), "\n")
+	case bashDirRe.MatchString(body):
+		value = "@cand takeDir"
+	case bashFileRe.MatchString(body):
+		value = "@cand takeFile"
+	case body == "" || body == "return" || body == "return 0":
+		// Takes a value, but nothing to complete.
+		value = "@any"
+	default:
+		value = lostAny(body)
+	}
+
+	if strings.HasPrefix(words[0], "-") {
+		o := c.option(words)
+		o.value = strings.Split(value, "\n")
+		return
+	}
+	// Otherwise, it's a subcommand that takes a value.
+	c.setArg(words[0], strings.Join(words, "|")+"\n\t"+strings.ReplaceAll(value, "\n", "\n\t"))
+}
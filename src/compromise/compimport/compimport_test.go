@@ -0,0 +1,46 @@
+package compimport
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/internal/golden"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// TestFixtures converts each script in testdata, and compares the spec with the .spec file.
+func TestFixtures(t *testing.T) {
+	golden.ForEach(t, "testdata/*.*sh", func(t *testing.T, file, script string) {
+		var spec string
+		if filepath.Ext(file) == ".fish" {
+			spec = FromFish(script)
+		} else {
+			spec = FromBash(script)
+		}
+		golden.Assert(t, file+".spec", spec)
+
+		for _, p := range parser.Lint(spec, compromise.NewDirectives()) {
+			assert.NotEqual(t, parser.SeverityError, p.Severity, "%s: %s", file, p)
+		}
+	})
+}
+
+func TestOptionMerge(t *testing.T) {
+	c := &command{}
+	c.option([]string{"-o"}).help = "Output"
+	c.option([]string{"--output"}).value = []string{"@any"}
+	c.option([]string{"-v"})
+
+	o := c.option([]string{"-o", "--output"})
+	assert.Equal(t, []string{"-o", "--output"}, o.names)
+	assert.Equal(t, "Output", o.help)
+	assert.Equal(t, []string{"@any"}, o.value)
+	assert.Equal(t, 2, len(c.options))
+}
+
+func TestLiteral(t *testing.T) {
+	assert.Equal(t, "--color=auto", literal("--color=auto"))
+	assert.Equal(t, `"a|b"`, literal("a|b"))
+	assert.Equal(t, `"a b"`, literal("a b"))
+}
@@ -0,0 +1,151 @@
+package compimport
+
+import (
+	"github.com/omakoto/go-common/src/shell"
+	"strings"
+)
+
+// fishEntry is a fish "complete" command.
+type fishEntry struct {
+	command   string
+	names     []string
+	help      string
+	args      string // Raw, as in the script.
+	condition string
+	lost      []string
+
+	requiresValue bool
+	noFiles       bool
+	forceFiles    bool
+}
+
+// FromFish converts the "complete" commands in a fish script, e.g.
+// "complete -c cmd -s x -l long -d desc -a 'a b'", into a spec.
+func FromFish(script string) string {
+	cs := &commands{}
+	for _, line := range joinContinuedLines(script) {
+		words := shell.Split(strings.TrimSpace(line))
+		if len(words) == 0 || words[0] != "complete" {
+			continue
+		}
+		e := parseFishComplete(words[1:])
+		if e.command == "" {
+			continue
+		}
+		e.addTo(cs.get(e.command))
+	}
+	return cs.spec()
+}
+
+// joinContinuedLines splits a script into lines, joining lines ending with a backslash.
+func joinContinuedLines(script string) []string {
+	return strings.Split(strings.ReplaceAll(script, "\\\n", " "), "\n")
+}
+
+func parseFishComplete(words []string) *fishEntry {
+	e := &fishEntry{}
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if strings.HasPrefix(w, "#") {
+			break
+		}
+		// Take the value of an option, either in the same word as "--long=value", or in the next.
+		value := func() string {
+			if p := strings.IndexByte(w, '='); p >= 0 && strings.HasPrefix(w, "--") {
+				return w[p+1:]
+			}
+			if i+1 < len(words) {
+				i++
+				return words[i]
+			}
+			return ""
+		}
+		name := w
+		if p := strings.IndexByte(w, '='); p >= 0 && strings.HasPrefix(w, "--") {
+			name = w[:p]
+		}
+		switch name {
+		case "-c", "--command":
+			e.command = shell.Unescape(value())
+		case "-s", "--short-option", "-o", "--old-option":
+			e.names = append(e.names, "-"+shell.Unescape(value()))
+		case "-l", "--long-option":
+			e.names = append(e.names, "--"+shell.Unescape(value()))
+		case "-d", "--description":
+			e.help = shell.Unescape(value())
+		case "-a", "--arguments":
+			e.args = value()
+		case "-n", "--condition":
+			e.condition = value()
+		case "-r", "--require-parameter":
+			e.requiresValue = true
+		case "-x", "--exclusive":
+			e.requiresValue = true
+			e.noFiles = true
+		case "-f", "--no-files":
+			e.noFiles = true
+		case "-F", "--force-files":
+			e.forceFiles = true
+		case "-k", "--keep-order":
+			// Nothing to do.
+		default:
+			e.lost = append(e.lost, w)
+		}
+	}
+	if e.condition != "" && !strings.Contains(e.condition, "__fish_use_subcommand") {
+		e.lost = append(e.lost, "-n "+e.condition)
+	}
+	return e
+}
+
+// argWords returns the words in the arguments, or false if they need a command substitution or
+// a variable, which can't be translated.
+func (e *fishEntry) argWords() ([]string, bool) {
+	if strings.ContainsAny(e.args, "($") {
+		return nil, false
+	}
+	return strings.Fields(shell.Unescape(e.args)), true
+}
+
+func (e *fishEntry) addTo(c *command) {
+	if len(e.names) == 0 {
+		// Arguments.
+		if e.args != "" {
+			words, ok := e.argWords()
+			if !ok {
+				c.args = append(c.args, lostAny("-a "+e.args))
+				return
+			}
+			for _, w := range words {
+				c.addArg(w, e.help)
+			}
+		}
+		if e.forceFiles {
+			c.args = append(c.args, "@cand takeFile")
+		}
+		return
+	}
+
+	o := c.option(e.names)
+	if o.help == "" {
+		o.help = e.help
+	}
+	if len(e.lost) > 0 {
+		o.lost = strings.Join(e.lost, " ")
+	}
+	if o.value != nil {
+		return
+	}
+	switch {
+	case e.args != "":
+		if words, ok := e.argWords(); ok {
+			o.value = wordsLiterals(words)
+		} else {
+			o.value = []string{lostAny("-a " + e.args)}
+		}
+	case e.requiresValue && e.noFiles:
+		o.value = []string{"@any"}
+	case e.requiresValue || e.forceFiles:
+		o.value = []string{"@cand takeFile"}
+	}
+}
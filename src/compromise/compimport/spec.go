@@ -0,0 +1,202 @@
+// Package compimport converts completion definitions for other shells, such as fish "complete"
+// commands and simple bash completion scripts, into specs.
+package compimport
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfmt"
+	"github.com/omakoto/compromise/src/compromise/internal/specgen"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// option is a flag of a command.
+type option struct {
+	names []string
+	help  string
+
+	// Spec lines for the value, or nil if it takes no value.
+	value []string
+
+	// What couldn't be translated, if any.
+	lost string
+}
+
+// command is a command to generate a spec for.
+type command struct {
+	name    string
+	options []*option
+
+	// Specs for the arguments after the options, which are the branches of a @switch. Each may
+	// have multiple lines.
+	args []string
+}
+
+// commands keeps commands in the order they're found.
+type commands struct {
+	list []*command
+}
+
+func (cs *commands) get(name string) *command {
+	for _, c := range cs.list {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &command{name: name}
+	cs.list = append(cs.list, c)
+	return c
+}
+
+// option returns the option that has any of the names, or adds a new one. Options that share
+// any of the names are merged into one.
+func (c *command) option(names []string) *option {
+	var ret *option
+	options := make([]*option, 0, len(c.options))
+	for _, o := range c.options {
+		if !hasAny(o.names, names) {
+			options = append(options, o)
+			continue
+		}
+		if ret == nil {
+			ret = o
+			options = append(options, o)
+			continue
+		}
+		// Merge into the first one.
+		ret.names = append(ret.names, o.names...)
+		if ret.help == "" {
+			ret.help = o.help
+		}
+		if ret.value == nil {
+			ret.value = o.value
+		}
+	}
+	if ret == nil {
+		ret = &option{}
+		options = append(options, ret)
+	}
+	for _, n := range names {
+		if !hasAny(ret.names, []string{n}) {
+			ret.names = append(ret.names, n)
+		}
+	}
+	c.options = options
+	return ret
+}
+
+func hasAny(list, values []string) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addArg adds a literal to the arguments, unless it's already there.
+func (c *command) addArg(word, help string) {
+	line := literal(word) + specgen.HelpComment(help)
+	for _, a := range c.args {
+		if a == line {
+			return
+		}
+	}
+	c.args = append(c.args, line)
+}
+
+// setArg replaces the argument that starts with a word, or adds a new one.
+func (c *command) setArg(word, spec string) {
+	prefix := literal(word)
+	for i, a := range c.args {
+		if a == prefix || strings.HasPrefix(a, prefix+" ") || strings.HasPrefix(a, prefix+"\n") {
+			c.args[i] = spec
+			return
+		}
+	}
+	c.args = append(c.args, spec)
+}
+
+var safeLiteralRe = regexp.MustCompile(`^[\w.,:/+=@%-]+$`)
+
+// literal returns a word as a spec literal, which is quoted if it has special characters.
+func literal(word string) string {
+	if safeLiteralRe.MatchString(word) {
+		return word
+	}
+	return strconv.Quote(word)
+}
+
+// lostAny returns a spec line that takes any word, with a comment on what was lost.
+func lostAny(what string) string {
+	return "@any // Not imported: " + strings.Join(strings.Fields(what), " ")
+}
+
+// wordsLiterals returns spec lines for words, e.g. from "complete -W", as branches of a @switch.
+func wordsLiterals(words []string) []string {
+	ret := []string{"@switch"}
+	for _, w := range words {
+		ret = append(ret, "\t"+literal(w))
+	}
+	return ret
+}
+
+var nonLabelCharRe = regexp.MustCompile(`\W`)
+
+// spec returns the spec for all the commands.
+func (cs *commands) spec() string {
+	b := strings.Builder{}
+	if len(cs.list) == 1 {
+		b.WriteString("@command " + strconv.Quote(cs.list[0].name) + "\n\n")
+		cs.list[0].writeBody(&b, "")
+	} else {
+		// Give each command a label.
+		for _, c := range cs.list {
+			b.WriteString("@command " + strconv.Quote(c.name) + " :" + label(c.name) + "\n")
+		}
+		for _, c := range cs.list {
+			b.WriteString("\n@label :" + label(c.name) + "\n")
+			c.writeBody(&b, "\t")
+		}
+	}
+
+	// Align the help strings.
+	spec := b.String()
+	if formatted, err := compfmt.Format(spec, compromise.NewDirectives()); err == nil {
+		spec = formatted
+	}
+	return spec
+}
+
+func label(command string) string {
+	return nonLabelCharRe.ReplaceAllString(command, "_")
+}
+
+func (c *command) writeBody(b *strings.Builder, indent string) {
+	if len(c.options) > 0 {
+		b.WriteString(indent + "@switchloop \"^-\"\n")
+		for _, o := range c.options {
+			if o.lost != "" {
+				b.WriteString(indent + "\t// Not imported: " + strings.Join(strings.Fields(o.lost), " ") + "\n")
+			}
+			b.WriteString(indent + "\t" + strings.Join(o.names, "|") + specgen.HelpComment(o.help) + "\n")
+			for _, v := range o.value {
+				b.WriteString(indent + "\t\t" + v + "\n")
+			}
+		}
+	}
+	if len(c.args) > 0 {
+		if len(c.options) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "@switch\n")
+		for _, a := range c.args {
+			for _, line := range strings.Split(a, "\n") {
+				b.WriteString(indent + "\t" + line + "\n")
+			}
+		}
+	}
+}
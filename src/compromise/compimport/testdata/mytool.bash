@@ -0,0 +1,35 @@
+# bash completion for mytool
+
+_mytool()
+{
+    local cur prev words cword
+    _init_completion || return
+
+    case "$prev" in
+        -o|--output)
+            _filedir
+            return
+            ;;
+        -C)
+            _filedir -d
+            return
+            ;;
+        --color)
+            COMPREPLY=( $(compgen -W "always never auto" -- "$cur") )
+            return
+            ;;
+        -n|--jobs)
+            return
+            ;;
+        --user)
+            COMPREPLY=( $(compgen -u -- "$cur") )
+            return
+            ;;
+        log)
+            COMPREPLY=( $(compgen -W "debug info" -- "$cur") )
+            return ;;
+    esac
+
+    COMPREPLY=( $(compgen -W "-v --verbose -o --output -C --color -n --jobs --user build log run" -- "$cur") )
+} &&
+complete -F _mytool mytool
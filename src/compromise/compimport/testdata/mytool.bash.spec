@@ -0,0 +1,26 @@
+@command "mytool"
+
+@switchloop "^-"
+	-v
+	--verbose
+	-o|--output
+		@cand takeFile
+	-C
+		@cand takeDir
+	--color
+		@switch
+			always
+			never
+			auto
+	-n|--jobs
+		@any
+	--user
+		@any // Not imported: COMPREPLY=( $(compgen -u -- "$cur") ) return
+
+@switch
+	build
+	log
+		@switch
+			debug
+			info
+	run
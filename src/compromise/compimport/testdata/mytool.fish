@@ -0,0 +1,14 @@
+# Completion for mytool.
+complete -c mytool -f
+complete -c mytool -n __fish_use_subcommand -a 'build run' -d 'Subcommand'
+complete -c mytool -n __fish_use_subcommand -a test -d 'Run the tests'
+complete -c mytool -s v -l verbose -d 'Verbose output'
+complete -c mytool -s o -l output -r -d 'Write to a file'
+complete -c mytool -l color -x -a 'always never auto' -d 'Colorize the output'
+complete -c mytool -s u -l user -x -a '(__fish_complete_users)' -d 'Run as a user'
+complete -c mytool -l jobs -x -d 'Number of jobs'
+complete -c mytool -n '__fish_seen_subcommand_from test' -l race -d 'Enable the race detector'
+complete -c mytool -a '(__fish_complete_pids)'
+complete -c other -o debug --description "Debug \
+   mode"
+complete -c other -F
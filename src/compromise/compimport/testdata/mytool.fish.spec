@@ -0,0 +1,32 @@
+@command "mytool" :mytool
+@command "other" :other
+
+@label :mytool
+	@switchloop "^-"
+		-v|--verbose # Verbose output
+		-o|--output  # Write to a file
+			@cand takeFile
+		--color      # Colorize the output
+			@switch
+				always
+				never
+				auto
+		-u|--user    # Run as a user
+			@any // Not imported: -a '(__fish_complete_users)'
+		--jobs       # Number of jobs
+			@any
+		// Not imported: -n '__fish_seen_subcommand_from test'
+		--race       # Enable the race detector
+
+	@switch
+		build # Subcommand
+		run   # Subcommand
+		test  # Run the tests
+		@any  // Not imported: -a '(__fish_complete_pids)'
+
+@label :other
+	@switchloop "^-"
+		-debug # Debug mode
+
+	@switch
+		@cand takeFile
@@ -0,0 +1,3 @@
+complete -W "start stop --force" svc
+complete -d -o nospace cdx
+complete -F _missing broken
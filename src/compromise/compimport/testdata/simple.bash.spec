@@ -0,0 +1,19 @@
+@command "svc" :svc
+@command "cdx" :cdx
+@command "broken" :broken
+
+@label :svc
+	@switchloop "^-"
+		--force
+
+	@switch
+		start
+		stop
+
+@label :cdx
+	@switch
+		@cand takeDir
+
+@label :broken
+	@switch
+		@any // Not imported: complete -F _missing
@@ -0,0 +1,298 @@
+package complsp
+
+// Open documents and their specs.
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compfmt"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// document is an open file, which is either a spec file, or a Go file that has specs in it.
+type document struct {
+	uri   string
+	specs []*spec
+}
+
+// spec is a spec in a document.
+type spec struct {
+	directives *compromise.Directives
+
+	// The document line where the spec starts, and the offset of the spec in the line in UTF-16
+	// code units. The offset is non-zero only for specs in Go files, which start after a backquote.
+	firstLine       int
+	firstLineOffset int
+
+	lines []string
+
+	// root is nil if the spec can't be parsed.
+	root     *compast.Node
+	problems []*parser.Problem
+}
+
+func uriToFilename(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+func newDocument(uri, text string) *document {
+	doc := &document{uri: uri}
+	filename := uriToFilename(uri)
+
+	if strings.HasSuffix(filename, ".go") {
+		// Go syntax errors are left to gopls; just don't report anything.
+		goSpecs, _ := compfmt.FindGoSpecs(filename, []byte(text))
+		for _, gs := range goSpecs {
+			lineStart := strings.LastIndexByte(text[:gs.Start], '\n') + 1
+			doc.specs = append(doc.specs, newSpec(text[gs.Start:gs.End], gs.Directives,
+				gs.Directives.StartLine-1, utf16Len(text[lineStart:gs.Start])))
+		}
+		return doc
+	}
+
+	var d *compromise.Directives
+	var problems []*parser.Problem
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				e, ok := r.(compromise.SpecError)
+				if !ok {
+					panic(r)
+				}
+				d = compromise.NewDirectives()
+				problems = []*parser.Problem{{SpecError: e, Severity: parser.SeverityError}}
+			}
+		}()
+		d = compromise.ExtractDirectives(text)
+	}()
+	d.SetFilename(filename).SetStartLine(1)
+
+	s := newSpec(text, d, 0, 0)
+	s.problems = append(problems, s.problems...)
+	doc.specs = append(doc.specs, s)
+	return doc
+}
+
+func newSpec(text string, d *compromise.Directives, firstLine, firstLineOffset int) *spec {
+	s := &spec{
+		directives:      d,
+		firstLine:       firstLine,
+		firstLineOffset: firstLineOffset,
+		lines:           strings.Split(text, "\n"),
+	}
+	s.root, s.problems = parser.Analyze(text, d)
+	return s
+}
+
+// specAt returns the spec that contains a given document line, or nil if none.
+func (doc *document) specAt(line int) *spec {
+	for _, s := range doc.specs {
+		if s.firstLine <= line && line < s.firstLine+len(s.lines) {
+			return s
+		}
+	}
+	return nil
+}
+
+// lineAt returns the part of a document line that belongs to the spec, and its offset in the
+// document line in UTF-16 code units.
+func (s *spec) lineAt(line int) (text string, offset int) {
+	text = s.lines[line-s.firstLine]
+	if line == s.firstLine {
+		offset = s.firstLineOffset
+	}
+	return text, offset
+}
+
+// position converts a token location into an LSP position. Token columns are in tab-expanded
+// lines, so this needs to reverse it.
+func (s *spec) position(line, column int) position {
+	docLine := line - 1
+	if docLine < s.firstLine || docLine >= s.firstLine+len(s.lines) {
+		return position{Line: s.firstLine}
+	}
+	text, offset := s.lineAt(docLine)
+
+	tabWidth := s.directives.TabWidth
+	expandedBytes, expandedColumn := 0, 1
+	char := 0
+	for _, r := range text {
+		if expandedColumn >= column {
+			break
+		}
+		if r == '\t' {
+			fill := tabWidth - expandedBytes%tabWidth
+			expandedBytes += fill
+			expandedColumn += fill
+		} else {
+			expandedBytes += utf8.RuneLen(r)
+			expandedColumn++
+		}
+		char += len(utf16.Encode([]rune{r}))
+	}
+	return position{Line: docLine, Character: offset + char}
+}
+
+func (s *spec) tokenRange(tok *compast.Token) textRange {
+	start := s.position(tok.Line, tok.Column)
+	word := tok.RawWord
+	if i := strings.IndexByte(word, '\n'); i >= 0 {
+		word = word[:i]
+	}
+	end := start
+	end.Character += utf16Len(word)
+	return textRange{Start: start, End: end}
+}
+
+func (s *spec) diagnostics() []diagnostic {
+	ret := make([]diagnostic, 0, len(s.problems))
+	for _, p := range s.problems {
+		message := p.Message
+		r := textRange{Start: position{Line: s.firstLine}, End: position{Line: s.firstLine}}
+		if p.Location != nil {
+			if file, line, column := p.Location.SourceLocation(); file != s.directives.Filename {
+				// In an included file. Only show errors, at the top of the spec.
+				if p.Severity != parser.SeverityError {
+					continue
+				}
+				ret = append(ret, diagnostic{Range: r, Severity: severityError, Source: "compromise",
+					Message: fmt.Sprintf("%s:%d:%d: %s", file, line, column, message)})
+				continue
+			}
+		}
+		switch loc := p.Location.(type) {
+		case *compast.Token:
+			if loc != nil {
+				r = s.tokenRange(loc)
+			}
+		case compromise.SourceLocation:
+			_, line, column := loc.SourceLocation()
+			r.Start = s.position(line, column)
+			r.End = r.Start
+		}
+		severity := severityError
+		if p.Severity == parser.SeverityWarning {
+			severity = severityWarning
+		}
+		ret = append(ret, diagnostic{Range: r, Severity: severity, Source: "compromise", Message: message})
+	}
+	return ret
+}
+
+// tokenLocation returns the location of a token, which may be in an included file.
+func (s *spec) tokenLocation(uri string, tok *compast.Token) *location {
+	if tok.SourceFile == s.directives.Filename {
+		return &location{URI: uri, Range: s.tokenRange(tok)}
+	}
+	data, err := os.ReadFile(tok.SourceFile)
+	if err != nil {
+		return nil
+	}
+	included := &spec{directives: compromise.ExtractDirectives(string(data)), lines: strings.Split(string(data), "\n")}
+	return &location{URI: (&url.URL{Scheme: "file", Path: tok.SourceFile}).String(), Range: included.tokenRange(tok)}
+}
+
+// nodeAt returns the node that starts at a given document line, or nil if none.
+func (s *spec) nodeAt(line int) *compast.Node {
+	if s.root == nil {
+		return nil
+	}
+	var find func(n *compast.Node) *compast.Node
+	find = func(n *compast.Node) *compast.Node {
+		for c := n.Child(); c != nil; c = c.Next() {
+			if c.SelfToken().Line-1 == line {
+				return c
+			}
+			if found := find(c); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return find(s.root)
+}
+
+// findLabelTarget returns the node that defines a label referred from a node.
+func findLabelTarget(n *compast.Node, label string) *compast.Node {
+	switch n.NodeType() {
+	case compast.NodeCall, compast.NodeCommand:
+		return n.FindLabeledNode(label)
+	case compast.NodeBreak, compast.NodeContinue:
+		for p := n.Parent(); p != nil && !p.IsRoot(); p = p.Parent() {
+			if p.LabelWord() == label {
+				return p
+			}
+		}
+		return nil
+	}
+	if n.LabelWord() == label {
+		return n
+	}
+	return nil
+}
+
+// wordAt returns the word at a position, and its range.
+func (s *spec) wordAt(pos position) (word string, r textRange) {
+	text, offset := s.lineAt(pos.Line)
+	cursor := utf16ToByteOffset(text, pos.Character-offset)
+
+	start, end := cursor, cursor
+	for start > 0 && !unicode.IsSpace(rune(text[start-1])) {
+		start--
+	}
+	for end < len(text) && !unicode.IsSpace(rune(text[end])) {
+		end++
+	}
+	r.Start = position{Line: pos.Line, Character: offset + utf16Len(text[:start])}
+	r.End = position{Line: pos.Line, Character: offset + utf16Len(text[:end])}
+	return text[start:end], r
+}
+
+// prefixAt returns the part of the word before a position, its range, and the index of the
+// word in the line.
+func (s *spec) prefixAt(pos position) (prefix string, r textRange, index int) {
+	text, offset := s.lineAt(pos.Line)
+	cursor := utf16ToByteOffset(text, pos.Character-offset)
+
+	start := cursor
+	for start > 0 && !unicode.IsSpace(rune(text[start-1])) {
+		start--
+	}
+	index = len(strings.Fields(text[:start]))
+	r.Start = position{Line: pos.Line, Character: offset + utf16Len(text[:start])}
+	r.End = pos
+	return text[start:cursor], r, index
+}
+
+// firstWordAt returns the first word in a document line.
+func (s *spec) firstWordAt(line int) string {
+	text, _ := s.lineAt(line)
+	if fields := strings.Fields(text); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func utf16ToByteOffset(s string, units int) int {
+	for i, r := range s {
+		if units <= 0 {
+			return i
+		}
+		units -= len(utf16.Encode([]rune{r}))
+	}
+	return len(s)
+}
@@ -0,0 +1,272 @@
+package complsp
+
+// Language server for completion specs, which works on spec files and on specs in Go files.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	docs map[string]*document
+}
+
+// Serve runs a language server over a given stream, until it gets the "exit" notification or
+// the input is closed.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			continue // Notifications have no responses.
+		}
+		if err := writeMessage(s.out, &response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *server) handle(req *request) (interface{}, *responseError) {
+	// unmarshal decodes the params, and the response is an error if it fails.
+	var perr *responseError
+	unmarshal := func(v interface{}) bool {
+		if err := json.Unmarshal(req.Params, v); err != nil {
+			perr = &responseError{Code: errorInvalidParams, Message: err.Error()}
+			return false
+		}
+		return true
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"@", ":"}},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]string{"name": "compromise"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if unmarshal(&p) {
+			s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+		return nil, perr
+	case "textDocument/didChange":
+		var p didChangeParams
+		if unmarshal(&p) && len(p.ContentChanges) > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+		return nil, perr
+	case "textDocument/didClose":
+		var p didCloseParams
+		if unmarshal(&p) {
+			delete(s.docs, p.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+		}
+		return nil, perr
+
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if !unmarshal(&p) {
+			return nil, perr
+		}
+		return s.completion(p), nil
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if !unmarshal(&p) {
+			return nil, perr
+		}
+		return s.definition(p), nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if !unmarshal(&p) {
+			return nil, perr
+		}
+		return s.hover(p), nil
+	}
+	if req.ID == nil {
+		return nil, nil // Ignore unknown notifications, such as "initialized".
+	}
+	return nil, &responseError{Code: errorMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func (s *server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+
+	diags := make([]diagnostic, 0)
+	for _, sp := range doc.specs {
+		diags = append(diags, sp.diagnostics()...)
+	}
+	s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// specAt returns the spec at a position, or nil if the position isn't in a spec.
+func (s *server) specAt(p textDocumentPositionParams) *spec {
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	return doc.specAt(p.Position.Line)
+}
+
+// directives are the commands that can be used in specs.
+var directives = []struct {
+	name, usage, description string
+}{
+	{"any", "@any [# HELP]", "Takes any word."},
+	{"break", "@break [:LABEL]", "Exits the innermost loop, or the loop with the label."},
+	{"bundle", "@bundle", "Under a literal short flag, allows combining it with other short flags, e.g. -la."},
+	{"call", "@call :LABEL [ARGS...]", "Runs the nodes under the label with the arguments, and comes back."},
+	{"cand", "@cand FUNCTION [ARGS...] [# HELP]", "Takes a word from the candidates that a registered function returns."},
+	{"capture", "@capture NAME", "Stores the word matched by the previous node as NAME, which functions read with CompleteContext.Get."},
+	{"command", "@command COMMAND [:LABEL]", "Starts completion for the command, from the label or the next node."},
+	{"continue", "@continue [:LABEL]", "Starts the next iteration of the innermost loop, or the loop with the label."},
+	{"exclusive", "@exclusive :GROUP", "Under a branch in a @switchloop, stops offering the branches in the group once any of them is used."},
+	{"exec", "@exec COMMAND [# HELP]", "Takes a word from the output lines of a shell command, which gets the current word as $1. A line may have a help after a tab."},
+	{"finish", "@finish", "Finishes completion."},
+	{"go_call", "@go_call FUNCTION [ARGS...]", "Calls a registered function, which always matches without taking a word."},
+	{"group", "@group NAME", "Sets the group of the following candidates."},
+	{"if", "@if [!]env NAME | [!]file PATH | [!]word PATTERN | [!]go PREDICATE [ARGS...]", "Runs the children only when the condition holds: an environment variable is set, a file exists, an earlier word matches, or a registered predicate returns true."},
+	{"include", "@include PATH [:NAMESPACE]", "Includes a spec file, whose labels can be used as :NAMESPACE.LABEL."},
+	{"joined", "@joined", "Under a literal flag, allows a value in the same word, e.g. --flag=VALUE or -fVALUE."},
+	{"label", "@label :LABEL [$PARAM...] [# HELP]", "Defines a label, which can be used by @call and @command. Parameters are replaced with the @call arguments."},
+	{"lines", "@lines PATH [# HELP]", "Takes a word from the lines in a file. A line may have a help after a tab."},
+	{"loop", "@loop [PATTERN] [:LABEL]", "Repeats the children, while the word matches the pattern, if any."},
+	{"once", "@once", "Under a branch in a @switchloop, stops offering the branch once it's used."},
+	{"set", "@set NAME VALUE", "Stores VALUE as NAME, which functions read with CompleteContext.Get."},
+	{"switch", "@switch [PATTERN] [:LABEL]", "Runs the first child that matches the word, if the word matches the pattern."},
+	{"switchloop", "@switchloop [PATTERN] [:LABEL]", "Repeats a @switch, while the word matches the pattern, if any."},
+}
+
+var labelDefinitionRe = regexp.MustCompile(`^\s*@(?:label|loop|switch|switchloop)\b.*?\s:(\S+)`)
+
+func (s *server) completion(p textDocumentPositionParams) []completionItem {
+	sp := s.specAt(p)
+	if sp == nil {
+		return []completionItem{}
+	}
+	prefix, r, index := sp.prefixAt(p.Position)
+
+	items := make([]completionItem, 0)
+	add := func(label string, kind int, detail string) {
+		if strings.HasPrefix(strings.ToLower(label), strings.ToLower(prefix)) {
+			items = append(items, completionItem{Label: label, Kind: kind, Detail: detail, TextEdit: &textEdit{Range: r, NewText: label}})
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(prefix, "@"):
+		for _, d := range directives {
+			add("@"+d.name, completionKindKeyword, d.usage)
+		}
+	case strings.HasPrefix(prefix, ":"):
+		// Use the text rather than the tree, because the spec is likely broken while typing.
+		seen := make(map[string]bool)
+		for _, line := range sp.lines {
+			if m := labelDefinitionRe.FindStringSubmatch(line); m != nil && !seen[m[1]] {
+				seen[m[1]] = true
+				add(":"+m[1], completionKindReference, "")
+			}
+		}
+	case index == 1:
+		switch sp.firstWordAt(p.Position.Line) {
+		case "@cand", "@go_call":
+			for _, name := range compfunc.Names() {
+				add(name, completionKindFunction, "")
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// labelTargetAt returns the node that defines the label at a position, and the range of the
+// label at the position.
+func (s *server) labelTargetAt(p textDocumentPositionParams) (*spec, *compast.Node, textRange) {
+	sp := s.specAt(p)
+	if sp == nil {
+		return nil, nil, textRange{}
+	}
+	word, r := sp.wordAt(p.Position)
+	if !strings.HasPrefix(word, ":") || len(word) < 2 {
+		return nil, nil, textRange{}
+	}
+	n := sp.nodeAt(p.Position.Line)
+	if n == nil {
+		return nil, nil, textRange{}
+	}
+	return sp, findLabelTarget(n, word[1:]), r
+}
+
+func (s *server) definition(p textDocumentPositionParams) interface{} {
+	sp, target, _ := s.labelTargetAt(p)
+	if target == nil {
+		return nil
+	}
+	return sp.tokenLocation(p.TextDocument.URI, target.Label())
+}
+
+func (s *server) hover(p textDocumentPositionParams) interface{} {
+	if _, target, r := s.labelTargetAt(p); target != nil {
+		text := fmt.Sprintf("`%s :%s", target.SelfToken().RawWord, target.LabelWord())
+		for _, param := range target.Params() {
+			text += " " + param.Word
+		}
+		text += "`"
+		if help := target.HelpText(); help != "" {
+			text += "\n\n" + help
+		}
+		return &hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}
+	}
+
+	// Directives.
+	sp := s.specAt(p)
+	if sp == nil {
+		return nil
+	}
+	word, r := sp.wordAt(p.Position)
+	for _, d := range directives {
+		if word == "@"+d.name {
+			text := fmt.Sprintf("`%s`\n\n%s", d.usage, d.description)
+			return &hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}
+		}
+	}
+	return nil
+}
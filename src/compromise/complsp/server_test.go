@@ -0,0 +1,176 @@
+package complsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	compfunc.Register("takeLspTest", func() {})
+}
+
+// serve runs the server with given requests, and returns all the messages it sent.
+func serve(t *testing.T, requests ...interface{}) []map[string]interface{} {
+	in := &bytes.Buffer{}
+	for i, r := range requests {
+		m := r.(map[string]interface{})
+		m["jsonrpc"] = "2.0"
+		if _, ok := m["id"]; ok {
+			m["id"] = i
+		}
+		assert.NoError(t, writeMessage(in, m))
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, Serve(in, out))
+
+	ret := make([]map[string]interface{}, 0)
+	reader := bufio.NewReader(out)
+	for {
+		body, err := readMessage(reader)
+		if err == io.EOF {
+			return ret
+		}
+		assert.NoError(t, err)
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal(body, &m))
+		ret = append(ret, m)
+	}
+}
+
+func toJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func open(uri, text string) map[string]interface{} {
+	return map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "text": text}}}
+}
+
+func at(method, uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{"id": nil, "method": method, "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": char}}}
+}
+
+func TestDiagnostics(t *testing.T) {
+	out := serve(t,
+		open("file:///x.spec", "//{\"tab\":4}\n@switch\n\t@call :x\n\t@cand noSuchFunc\n\ta\n\ta\n"),
+		open("file:///x.go", "package main\n\nvar spec = `\n@switch\n\t@call :x\n`\n\nvar other = `\n@call :y\n`\n"),
+		open("file:///y.spec", "@switch\n    a\n  b\n"),
+		map[string]interface{}{"method": "exit"},
+	)
+	assert.Equal(t, 3, len(out))
+
+	assert.Equal(t, `{"diagnostics":[`+
+		`{"message":"undefined label :x","range":{"end":{"character":9,"line":2},"start":{"character":7,"line":2}},"severity":1,"source":"compromise"},`+
+		`{"message":"function \"noSuchFunc\" not defined","range":{"end":{"character":17,"line":3},"start":{"character":7,"line":3}},"severity":1,"source":"compromise"},`+
+		`{"message":"duplicate literal \"a\" in the same switch","range":{"end":{"character":2,"line":5},"start":{"character":1,"line":5}},"severity":2,"source":"compromise"}`+
+		`],"uri":"file:///x.spec"}`, toJSON(out[0]["params"]))
+
+	// Only "spec" is checked in Go files.
+	assert.Equal(t, `{"diagnostics":[`+
+		`{"message":"undefined label :x","range":{"end":{"character":9,"line":4},"start":{"character":7,"line":4}},"severity":1,"source":"compromise"}`+
+		`],"uri":"file:///x.go"}`, toJSON(out[1]["params"]))
+
+	assert.Equal(t, `{"diagnostics":[`+
+		`{"message":"inconsistent indent for token \"b\", expected column is 1","range":{"end":{"character":3,"line":2},"start":{"character":2,"line":2}},"severity":1,"source":"compromise"}`+
+		`],"uri":"file:///y.spec"}`, toJSON(out[2]["params"]))
+}
+
+func TestFeatures(t *testing.T) {
+	const uri = "file:///x.spec"
+	spec := "@command adb :adb\n" +
+		"@label :adb # ADB commands\n" +
+		"\t@loop :args\n" +
+		"\t\t@switch\n" +
+		"\t\t\t@break :args\n" +
+		"\t\t\ta\n"
+
+	// Completion happens on broken specs.
+	const brokenURI = "file:///broken.spec"
+	broken := spec +
+		"\t\t\t@cand takeL\n" +
+		"\t\t\t@c\n" +
+		"\t\t\t@call :\n"
+	out := serve(t,
+		map[string]interface{}{"id": nil, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "initialized", "params": map[string]interface{}{}},
+		open(uri, spec),
+		at("textDocument/definition", uri, 0, 14),
+		at("textDocument/definition", uri, 4, 12),
+		at("textDocument/definition", uri, 5, 3),
+		at("textDocument/hover", uri, 0, 14),
+		at("textDocument/hover", uri, 3, 3),
+		open(brokenURI, broken),
+		at("textDocument/completion", brokenURI, 6, 14),
+		at("textDocument/completion", brokenURI, 7, 5),
+		at("textDocument/completion", brokenURI, 8, 10),
+		map[string]interface{}{"id": nil, "method": "noSuchMethod"},
+		map[string]interface{}{"id": nil, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	assert.Equal(t, 13, len(out))
+
+	assert.Equal(t, `{"capabilities":{"completionProvider":{"triggerCharacters":["@",":"]},"definitionProvider":true,"hoverProvider":true,"textDocumentSync":1},"serverInfo":{"name":"compromise"}}`,
+		toJSON(out[0]["result"]))
+	assert.Equal(t, "textDocument/publishDiagnostics", out[1]["method"])
+
+	// Definitions.
+	assert.Equal(t, `{"range":{"end":{"character":11,"line":1},"start":{"character":7,"line":1}},"uri":"file:///x.spec"}`, toJSON(out[2]["result"]))
+	assert.Equal(t, `{"range":{"end":{"character":12,"line":2},"start":{"character":7,"line":2}},"uri":"file:///x.spec"}`, toJSON(out[3]["result"]))
+	assert.Equal(t, `null`, toJSON(out[4]["result"]))
+
+	// Hovers.
+	assert.Equal(t, `{"contents":{"kind":"markdown","value":"`+"`@label :adb`"+`\n\nADB commands"},"range":{"end":{"character":17,"line":0},"start":{"character":13,"line":0}}}`,
+		toJSON(out[5]["result"]))
+	assert.Equal(t, `{"contents":{"kind":"markdown","value":"`+"`@switch [PATTERN] [:LABEL]`"+`\n\nRuns the first child that matches the word, if the word matches the pattern."},"range":{"end":{"character":9,"line":3},"start":{"character":2,"line":3}}}`,
+		toJSON(out[6]["result"]))
+
+	// Completions.
+	assert.Equal(t, `[{"kind":3,"label":"takeLspTest","textEdit":{"newText":"takeLspTest","range":{"end":{"character":14,"line":6},"start":{"character":9,"line":6}}}}]`,
+		toJSON(out[8]["result"]))
+	assert.Equal(t, `[`+
+		`{"detail":"@call :LABEL [ARGS...]","kind":14,"label":"@call","textEdit":{"newText":"@call","range":{"end":{"character":5,"line":7},"start":{"character":3,"line":7}}}},`+
+		`{"detail":"@cand FUNCTION [ARGS...] [# HELP]","kind":14,"label":"@cand","textEdit":{"newText":"@cand","range":{"end":{"character":5,"line":7},"start":{"character":3,"line":7}}}},`+
+		`{"detail":"@capture NAME","kind":14,"label":"@capture","textEdit":{"newText":"@capture","range":{"end":{"character":5,"line":7},"start":{"character":3,"line":7}}}},`+
+		`{"detail":"@command COMMAND [:LABEL]","kind":14,"label":"@command","textEdit":{"newText":"@command","range":{"end":{"character":5,"line":7},"start":{"character":3,"line":7}}}},`+
+		`{"detail":"@continue [:LABEL]","kind":14,"label":"@continue","textEdit":{"newText":"@continue","range":{"end":{"character":5,"line":7},"start":{"character":3,"line":7}}}}`+
+		`]`, toJSON(out[9]["result"]))
+	assert.Equal(t, `[`+
+		`{"kind":18,"label":":adb","textEdit":{"newText":":adb","range":{"end":{"character":10,"line":8},"start":{"character":9,"line":8}}}},`+
+		`{"kind":18,"label":":args","textEdit":{"newText":":args","range":{"end":{"character":10,"line":8},"start":{"character":9,"line":8}}}}`+
+		`]`, toJSON(out[10]["result"]))
+
+	assert.Equal(t, `{"code":-32601,"message":"method not found: noSuchMethod"}`, toJSON(out[11]["error"]))
+	assert.Equal(t, `null`, toJSON(out[12]["result"]))
+	assert.Contains(t, out[12], "result")
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.spec")
+	assert.NoError(t, os.WriteFile(lib, []byte("@label :x\n\t\t@call :missing\n"), 0600))
+
+	uri := "file://" + filepath.Join(dir, "main.spec")
+	out := serve(t,
+		open(uri, "@include \"lib.spec\"\n@call :lib.x\n"),
+		at("textDocument/definition", uri, 1, 8),
+		map[string]interface{}{"method": "exit"},
+	)
+	assert.Equal(t, 2, len(out))
+
+	// Errors in included files are shown at the top.
+	assert.Equal(t, `{"diagnostics":[`+
+		`{"message":"`+lib+`:2:23: undefined label :missing","range":{"end":{"character":0,"line":0},"start":{"character":0,"line":0}},"severity":1,"source":"compromise"}`+
+		`],"uri":"`+uri+`"}`, toJSON(out[0]["params"]))
+
+	assert.Equal(t, `{"range":{"end":{"character":9,"line":0},"start":{"character":7,"line":0}},"uri":"file://`+lib+`"}`, toJSON(out[1]["result"]))
+}
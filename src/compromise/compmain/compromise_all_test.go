@@ -44,10 +44,15 @@ func takeHeldValue() compromise.CandidateList {
 	return compromise.StrictCandidates(ret...)
 }
 
+func takeState(context compromise.CompleteContext, key string) compromise.CandidateList {
+	return compromise.StrictCandidates(compromise.NewCandidate().SetValue(context.Get(key)))
+}
+
 func init() {
 	compenv.DebugEnabled = true
 	compenv.LogFile = "/tmp/compromise-test.log"
 	compenv.CacheTimeout = -1
+	compenv.Frecency = false
 	compdebug.CloseLog()
 	os.Setenv("COMPROMISE_SHELL", "tester")
 
@@ -59,10 +64,93 @@ func init() {
 	compfunc.Register("setCurrent", compfunc.SetLastSeenString(&stringHolder))
 
 	compfunc.Register("takeHeldValue", takeHeldValue)
+	compfunc.Register("takeState", takeState)
+
+	compfunc.RegisterPredicate("isEqual", func(args []string) bool {
+		return len(args) == 2 && args[0] == args[1]
+	})
 }
 
 func TestFull(t *testing.T) {
-	testdir := "./tests"
+	runGoldenTests(t, "./tests", "tester")
+}
+
+func TestZsh(t *testing.T) {
+	runGoldenTests(t, "./tests-zsh", "zsh")
+}
+
+func TestFish(t *testing.T) {
+	runGoldenTests(t, "./tests-fish", "fish")
+}
+
+func TestNushell(t *testing.T) {
+	runGoldenTests(t, "./tests-nushell", "nu")
+}
+
+func TestMatcherDirective(t *testing.T) {
+	spec := `
+@switch
+	start-activity-dump
+	start-service
+	stop
+`
+	tests := []struct {
+		matcher  string
+		word     string
+		expected string
+	}{
+		{"", "s", "start-activity-dump\nstart-service\nstop\n"},
+		{"", "sad", ""},
+		{"initialism", "sad", "start-activity-dump\n"},
+		{"initialism", "sS", "start-service\n"},
+		{"substring", "service", "start-service\n"},
+		{"fuzzy", "sp", "start-activity-dump\nstop\n"},
+	}
+	for _, v := range tests {
+		buf := &bytes.Buffer{}
+		HandleCompletionRaw(func() string {
+			return "//" + compromise.NewDirectives().SetMatcher(v.matcher).JSON() + "\n" + spec
+		}, []string{"command", v.word}, nil, buf)
+		assert.Equal(t, v.expected, buf.String(), "%q %q", v.matcher, v.word)
+	}
+}
+
+func TestGroupOfSharedCandidates(t *testing.T) {
+	// A function may return the same candidates every time.
+	shared := compromise.StrictCandidates(compromise.NewCandidate().SetValue("x"))
+	compfunc.Register("takeShared", func() compromise.CandidateList {
+		return shared
+	})
+	spec := `
+@switch
+	a
+		@switch
+			@group "g"
+			@cand takeShared
+	b
+		@cand takeShared
+`
+	for _, v := range []struct {
+		word     string
+		expected string
+	}{
+		{"a", "x @\"g\"\n"},
+		{"b", "x\n"},
+	} {
+		buf := &bytes.Buffer{}
+		HandleCompletionRaw(func() string {
+			return spec
+		}, []string{"command", v.word, ""}, nil, buf)
+		assert.Equal(t, v.expected, buf.String(), v.word)
+	}
+}
+
+// runGoldenTests runs all the test files in testdir with a given shell adapter.
+func runGoldenTests(t *testing.T, testdir, shellName string) {
+	prevShell := os.Getenv("COMPROMISE_SHELL")
+	os.Setenv("COMPROMISE_SHELL", shellName)
+	defer os.Setenv("COMPROMISE_SHELL", prevShell)
+
 	files, err := os.ReadDir(testdir)
 	if err != nil {
 		t.Fatalf("can't open test file dir: %s", err)
@@ -97,17 +185,32 @@ func TestFull(t *testing.T) {
 		expected := splits[2]
 
 		buf := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
 
-		HandleCompletionRaw(func() string {
+		completeCatchingSpecError(func() string {
 			return "//" + compromise.NewDirectives().SetFilename(file).SetStartLine(0).JSON() + "\n" + spec
-		}, commandLine, nil, buf)
+		}, commandLine, buf, stderr)
 
-		result := buf.String()
+		result := buf.String() + stderr.String()
 
 		compare(t, file, expected, result)
 	}
 }
 
+// completeCatchingSpecError performs a completion, and if the spec is invalid, writes the error to
+// stderr instead of exiting.
+func completeCatchingSpecError(specProducer func() string, args []string, out, stderr *bytes.Buffer) {
+	env := compromise.CurrentEnvironment()
+	env.Stderr = stderr
+	defer func() {
+		// An invalid spec is reported to stderr before exiting, so anything else is a crash.
+		if r := recover(); r != nil && stderr.Len() == 0 {
+			panic(r)
+		}
+	}()
+	handleCompletion(specProducer, args, nil, out, env, completionOptions{})
+}
+
 func compare(t *testing.T, test, a, b string) {
 	if a == b {
 		return
@@ -0,0 +1,259 @@
+package compmain
+
+// Contains the completion daemon, which keeps parsed specs and caches in memory. See compclient for
+// the client side.
+
+import (
+	"container/list"
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compclient"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/omakoto/go-common/src/common"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	daemonRequestTimeout = 5 * time.Second
+
+	// Number of parsed specs that the daemon keeps.
+	daemonMaxSpecs = 16
+)
+
+// daemonExecutable returns the absolute path of the current executable, which identifies its daemon.
+func daemonExecutable() string {
+	path, err := filepath.Abs(common.MustGetExecutable())
+	common.Checkf(err, "Abs failed")
+	return path
+}
+
+// completeWithDaemon asks the daemon to perform a completion, and returns true if it did.
+// If the daemon isn't running, it starts one for later requests and returns false.
+func completeWithDaemon(spec string, args []string) bool {
+	res, err := compclient.Complete(daemonExecutable(), spec, args)
+	if err != nil {
+		compdebug.Debugf("Daemon request failed: %s\n", err)
+		startDaemon()
+		return false
+	}
+	if res.Declined {
+		compdebug.Debug("Daemon declined request\n")
+		return false
+	}
+	if res.Status != 0 {
+		common.ExitWithStatus(res.Status)
+	}
+	return true
+}
+
+// startDaemon starts the daemon in the background, without waiting for it.
+func startDaemon() {
+	cmd := exec.Command(common.MustGetExecutable(), "--"+compclient.DaemonOption)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		compdebug.Warnf("Unable to start daemon: %s\n", err)
+		return
+	}
+	cmd.Process.Release()
+}
+
+// daemon is the server side state.
+type daemon struct {
+	// Serializes requests, because functions may keep states in global variables, which are
+	// reset with compfunc.Reset before each request.
+	lock sync.Mutex
+
+	listener *net.UnixListener
+
+	executable        string
+	executableModTime time.Time
+
+	// Recently used parsed specs.
+	asts *specCache
+}
+
+// specCache keeps a limited number of parsed specs, evicting the least recently used one.
+type specCache struct {
+	max     int
+	order   *list.List // Of *specCacheEntry, most recently used first.
+	entries map[string]*list.Element
+}
+
+type specCacheEntry struct {
+	spec string
+	ast  *compast.Node
+}
+
+func newSpecCache(max int) *specCache {
+	return &specCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *specCache) get(spec string) (*compast.Node, bool) {
+	e, ok := c.entries[spec]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*specCacheEntry).ast, true
+}
+
+func (c *specCache) put(spec string, ast *compast.Node) {
+	c.entries[spec] = c.order.PushFront(&specCacheEntry{spec, ast})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*specCacheEntry).spec)
+	}
+}
+
+// RunDaemon runs the daemon until it's been idle for compenv.DaemonIdleTimeout, or the
+// executable is updated. It returns immediately if another daemon is already running.
+func RunDaemon() {
+	// Only the owner can access the socket.
+	syscall.Umask(0077)
+	common.Check(os.MkdirAll(compenv.CompDir, 0700), "unable to create directory")
+
+	executable := daemonExecutable()
+	lock, err := os.OpenFile(compclient.LockPath(executable), os.O_CREATE|os.O_RDWR, 0600)
+	common.Check(err, "unable to create lock file")
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		compdebug.Debug("Daemon already running\n")
+		return
+	}
+
+	path := compclient.SocketPath(executable)
+	os.Remove(path) // Remove a stale socket, if any.
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	common.Checkf(err, "unable to listen on %s", path)
+	defer listener.Close()
+
+	d := &daemon{listener: listener, asts: newSpecCache(daemonMaxSpecs)}
+	d.executable = common.MustGetExecutable()
+	if st, err := os.Stat(d.executable); err == nil {
+		d.executableModTime = st.ModTime()
+	}
+
+	compdebug.Debugf("Daemon started at %s\n", path)
+	d.run()
+	compdebug.Debug("Daemon finished\n")
+}
+
+func (d *daemon) run() {
+	for {
+		d.listener.SetDeadline(time.Now().Add(compenv.DaemonIdleTimeout))
+		conn, err := d.listener.AcceptUnix()
+		if err != nil {
+			// Idle timeout, or closed because the executable has been updated.
+			return
+		}
+		d.serve(conn)
+	}
+}
+
+func (d *daemon) serve(conn *net.UnixConn) {
+	defer conn.Close()
+
+	files, req, err := readDaemonRequest(conn)
+	for _, f := range files {
+		defer f.Close()
+	}
+	if err != nil {
+		compdebug.Warnf("Invalid daemon request: %s\n", err)
+		return
+	}
+
+	res := d.handle(req, files)
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		compdebug.Warnf("Unable to send daemon response: %s\n", err)
+	}
+}
+
+func readDaemonRequest(conn *net.UnixConn) (files []*os.File, req *compclient.Request, err error) {
+	conn.SetReadDeadline(time.Now().Add(daemonRequestTimeout))
+
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(3*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to receive file descriptors")
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to parse control message")
+	}
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "client"))
+		}
+	}
+	if len(files) != 3 {
+		return files, nil, errors.Errorf("expected 3 file descriptors, but received %d", len(files))
+	}
+
+	req = &compclient.Request{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		return files, nil, errors.Wrap(err, "unable to receive request")
+	}
+	return files, req, nil
+}
+
+// handle performs a completion on behalf of a client, using its stdin, stdout and stderr,
+// environmental variables and current directory.
+func (d *daemon) handle(req *compclient.Request, files []*os.File) (res *compclient.Response) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	res = &compclient.Response{}
+
+	// If the executable has been updated, let the client complete, and exit so that the next
+	// client starts a new daemon.
+	if st, err := os.Stat(d.executable); err != nil || !st.ModTime().Equal(d.executableModTime) {
+		compdebug.Debug("Executable updated; shutting down daemon\n")
+		res.Declined = true
+		d.listener.Close()
+		return
+	}
+
+	compfunc.Reset()
+
+	defer func() {
+		if r := recover(); r != nil {
+			// The error message, if any, has been written to the client's stderr already.
+			compdebug.Debugf("Completion failed in daemon: %v\n", r)
+			res.Status = 1
+		}
+	}()
+	env := &compromise.Environment{Vars: req.Env, Dir: req.Cwd, Stderr: files[2]}
+	done := handleCompletion(func() string {
+		return req.Spec
+	}, req.Args, files[0], files[1], env, completionOptions{parse: d.parse, nonInteractive: true})
+	res.Declined = !done
+	return
+}
+
+// parse returns a parsed spec, which is cached for later requests.
+func (d *daemon) parse(spec string, directives *compromise.Directives) *compast.Node {
+	if ast, ok := d.asts.get(spec); ok {
+		compdebug.Debug("Using cached spec\n")
+		return ast
+	}
+	ast := parser.Parse(spec, directives)
+	d.asts.put(spec, ast)
+	return ast
+}
@@ -0,0 +1,129 @@
+package compmain
+
+import (
+	"github.com/omakoto/compromise/src/compromise/compclient"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	origCompDir, origTimeout := compenv.CompDir, compenv.DaemonIdleTimeout
+	defer func() {
+		compenv.CompDir, compenv.DaemonIdleTimeout = origCompDir, origTimeout
+	}()
+	compenv.CompDir = t.TempDir()
+	compenv.DaemonIdleTimeout = 500 * time.Millisecond
+
+	finished := make(chan bool)
+	go func() {
+		RunDaemon()
+		finished <- true
+	}()
+
+	socket := compclient.SocketPath(daemonExecutable())
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	st, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0), st.Mode().Perm()&0077, "socket must be accessible only by the owner")
+
+	cwd, _ := os.Getwd()
+	completeIn := func(conn net.Conn, env []string, dir, spec string, args ...string) (*compclient.Response, string, string) {
+		defer conn.Close()
+		outDir := t.TempDir()
+		stdout, _ := os.Create(filepath.Join(outDir, "stdout"))
+		stderr, _ := os.Create(filepath.Join(outDir, "stderr"))
+		defer stdout.Close()
+		defer stderr.Close()
+
+		req := &compclient.Request{Spec: spec, Args: args, Env: env, Cwd: dir}
+		res, err := compclient.Send(conn.(*net.UnixConn), req, os.Stdin, stdout, stderr)
+		assert.NoError(t, err)
+
+		out, _ := os.ReadFile(stdout.Name())
+		errOut, _ := os.ReadFile(stderr.Name())
+		return res, string(out), string(errOut)
+	}
+	complete := func(conn net.Conn, spec string, args ...string) (*compclient.Response, string, string) {
+		return completeIn(conn, os.Environ(), cwd, spec, args...)
+	}
+	dial := func() net.Conn {
+		conn, err := net.Dial("unix", socket)
+		assert.NoError(t, err)
+		return conn
+	}
+
+	spec := `
+@switch
+	start
+	stop
+	restart
+`
+	res, out, _ := complete(conn, spec, "command", "st")
+	assert.Equal(t, &compclient.Response{}, res)
+	assert.Equal(t, "start\nstop\n", out)
+
+	// Same spec again, which is already parsed.
+	res, out, _ = complete(dial(), spec, "command", "r")
+	assert.Equal(t, &compclient.Response{}, res)
+	assert.Equal(t, "restart\n", out)
+
+	// The client's environmental variables and current directory are used, without changing
+	// the daemon's.
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0600)
+	env := append(os.Environ(), "COMPROMISE_TEST_DAEMON_VAR=1")
+	envSpec := `
+@switch
+	@if env COMPROMISE_TEST_DAEMON_VAR
+		var
+	@cand TakeFile
+`
+	res, out, _ = completeIn(dial(), env, dir, envSpec, "command", "")
+	assert.Equal(t, &compclient.Response{}, res)
+	assert.Equal(t, "file.txt\nvar\n", out)
+
+	res, out, _ = completeIn(dial(), os.Environ(), dir, envSpec, "command", "")
+	assert.Equal(t, &compclient.Response{}, res)
+	assert.Equal(t, "file.txt\n", out)
+
+	assert.Equal(t, "", os.Getenv("COMPROMISE_TEST_DAEMON_VAR"))
+	wd, _ := os.Getwd()
+	assert.Equal(t, cwd, wd)
+
+	res, _, errOut := complete(dial(), "@switch\n\t@bad\n", "command", "")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, errOut, "invalid spec")
+
+	// Warnings go to the client too.
+	res, _, errOut = complete(dial(), "@exec \"exit 3\"\n", "command", "")
+	assert.Equal(t, &compclient.Response{}, res)
+	assert.Contains(t, errOut, "Command execution error")
+
+	res, _, errOut = completeIn(dial(), append(os.Environ(), "COMPROMISE_SHELL=no-such-shell"), cwd, spec, "command", "")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, errOut, "Unknown shell no-such-shell")
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon didn't finish after idle timeout")
+	}
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -5,7 +5,13 @@ package compmain
 import (
 	"fmt"
 	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compclient"
 	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compdoc"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/compexport"
+	"github.com/omakoto/compromise/src/compromise/complsp"
 	"github.com/omakoto/compromise/src/compromise/internal/adapters"
 	"github.com/omakoto/compromise/src/compromise/internal/completer"
 	"github.com/omakoto/compromise/src/compromise/internal/compstore"
@@ -40,14 +46,16 @@ func MaybeHandleCompletion() {
 	}
 }
 
-// Call this from main() with a spec.
-func Main(spec string) {
+// Call this from main() with a spec, optionally followed by spec fragments, whose labels can be
+// used as ":namespace.label". See parser.JoinFragments for the namespaces.
+func Main(specs ...string) {
 	RunWithFatalCatcher(func() {
-		MainRaw(spec)
+		MainRaw(specs...)
 	})
 }
 
-func MainRaw(spec string) {
+func MainRaw(specs ...string) {
+	spec := parser.JoinFragments(specs...)
 	if MaybeHandleCompletionRaw() {
 		common.ExitSuccess()
 	}
@@ -55,6 +63,33 @@ func MainRaw(spec string) {
 	opts := InstallOptions{In: os.Stdin, Out: os.Stdout}
 
 	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "--compromise-clear-history" {
+		common.Check(compstore.ClearHistory(), "unable to clear history")
+		return
+	}
+	if len(args) > 0 && args[0] == "--compromise-clear-cache" {
+		common.Check(compstore.ClearFuncCache(), "unable to clear cache")
+		return
+	}
+	if len(args) > 0 && args[0] == "--compromise-lint" {
+		if !LintSpec(spec, os.Stdout) {
+			common.ExitFailure()
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "--compromise-lsp" {
+		// Functions registered by the command are available for diagnostics and completion.
+		common.Check(complsp.Serve(os.Stdin, os.Stdout), "language server failed")
+		return
+	}
+	if len(args) > 1 && args[0] == "--compromise-export" {
+		ExportSpec(spec, args[1], os.Stdout, os.Stderr, args[2:]...)
+		return
+	}
+	if len(args) > 1 && args[0] == "--compromise-doc" {
+		WriteDoc(spec, args[1], os.Stdout, args[2:]...)
+		return
+	}
 	if len(args) > 0 && args[0] == "--compromise-list-commands" {
 		args = args[1:]
 		opts.ListCommandsOnly = true
@@ -63,7 +98,57 @@ func MainRaw(spec string) {
 	PrintInstallScriptRaw(spec, opts, args...)
 }
 
-func runWithSpecCatcher(f func()) {
+// LintSpec prints all the errors and warnings in a spec in the "file:line:col: message" form,
+// and returns false if there's any error.
+func LintSpec(spec string, out io.Writer) (ok bool) {
+	runWithSpecCatcher(os.Stderr, func() {
+		ok = true
+		for _, p := range parser.Lint(spec, compromise.ExtractDirectives(spec)) {
+			fmt.Fprintln(out, p.String())
+			if p.Severity == parser.SeverityError {
+				ok = false
+			}
+		}
+	})
+	return
+}
+
+// ExportSpec writes a standalone completion script for a shell, and prints the nodes that can't be
+// exported to report.
+func ExportSpec(spec, shell string, out, report io.Writer, commandsOverride ...string) {
+	runWithSpecCatcher(os.Stderr, func() {
+		root := parser.Parse(spec, compromise.ExtractDirectives(spec))
+
+		commands := getTargetCommands(root.TargetCommands(), commandsOverride)
+		if len(commands) == 0 {
+			common.Fatal("spec doesn't contain any @commands; target commands must be passed as arguments")
+		}
+
+		lost, err := compexport.Export(root, shell, commands, out)
+		common.Check(err, "unable to export")
+		for _, l := range lost {
+			fmt.Fprintln(report, l)
+		}
+	})
+}
+
+// WriteDoc writes a reference of the commands in a spec, in "markdown" or "man" format.
+func WriteDoc(spec, format string, out io.Writer, commandsOverride ...string) {
+	runWithSpecCatcher(os.Stderr, func() {
+		root := parser.Parse(spec, compromise.ExtractDirectives(spec))
+
+		commands := getTargetCommands(root.TargetCommands(), commandsOverride)
+		if len(commands) == 0 {
+			common.Fatal("spec doesn't contain any @commands; target commands must be passed as arguments")
+		}
+
+		common.Check(compdoc.Write(root, format, commands, out), "unable to write doc")
+	})
+}
+
+// runWithSpecCatcher runs f, and if it panics with a SpecError, writes the error to stderr and
+// exits with a failure.
+func runWithSpecCatcher(stderr io.Writer, f func()) {
 	// Detect a SpecError panic and convert it to an error
 	defer func() {
 		if r := recover(); r != nil {
@@ -74,7 +159,10 @@ func runWithSpecCatcher(f func()) {
 					file, line, column := e.Location.SourceLocation()
 					msg += fmt.Sprintf(" at %s:%d:%d", file, line, column)
 				}
-				common.Fatal(msg)
+				if !common.Quiet {
+					fmt.Fprintf(stderr, "%s: %s\n", common.MustGetBinName(), msg)
+				}
+				common.ExitFailure()
 			} else {
 				panic(r)
 			}
@@ -111,7 +199,7 @@ type InstallOptions struct {
 }
 
 func PrintInstallScriptRaw(spec string, opts InstallOptions, commandsOverride ...string) {
-	runWithSpecCatcher(func() {
+	runWithSpecCatcher(os.Stderr, func() {
 		// Parse the spec.
 		directives := compromise.ExtractDirectives(spec)
 		root := parser.Parse(spec, directives)
@@ -130,14 +218,19 @@ func PrintInstallScriptRaw(spec string, opts InstallOptions, commandsOverride ..
 			return
 		}
 
-		adapter := adapters.GetShellAdapter(opts.In, opts.Out)
+		adapter := adapters.GetShellAdapter(opts.In, opts.Out, compromise.CurrentEnvironment())
 		defer adapter.Finish()
 
-		adapter.Install(commands, spec)
+		// Embed the included files too, so they won't be needed at completion time.
+		adapter.Install(commands, parser.Bundle(spec, directives))
 	})
 }
 
 func MaybeHandleCompletionRaw() (ret bool) {
+	if len(os.Args) >= 2 && os.Args[1] == "--"+compclient.DaemonOption {
+		RunDaemon()
+		return true
+	}
 	if len(os.Args) < 2 || os.Args[1] != "--"+adapters.InvokeOption {
 		return false
 	}
@@ -145,38 +238,78 @@ func MaybeHandleCompletionRaw() (ret bool) {
 	if len(os.Args) < 5 {
 		common.Fatalf("not enough arguments. %d given", len(os.Args))
 	}
-	HandleCompletionRaw(func() string {
+	specProducer := func() string {
 		return loadFile(os.Args[2])
-	}, os.Args[3:], os.Stdin, os.Stdout)
+	}
+	if compenv.UseDaemon {
+		spec := specProducer()
+		if completeWithDaemon(spec, os.Args[3:]) {
+			return
+		}
+		specProducer = func() string {
+			return spec
+		}
+	}
+	HandleCompletionRaw(specProducer, os.Args[3:], os.Stdin, os.Stdout)
 	return
 }
 
 func HandleCompletionRaw(specProducer func() string, args []string, in io.Reader, out io.Writer) {
+	handleCompletion(specProducer, args, in, out, compromise.CurrentEnvironment(), completionOptions{})
+}
+
+// completionOptions holds options for handleCompletion.
+type completionOptions struct {
+	// If set, used to get a parsed spec instead of parsing it every time.
+	parse func(spec string, directives *compromise.Directives) *compast.Node
+
+	// If set, don't perform a completion that needs the terminal, and return false instead.
+	nonInteractive bool
+}
+
+// handleCompletion performs a completion for a shell whose environment is env.
+func handleCompletion(specProducer func() string, args []string, in io.Reader, out io.Writer, env *compromise.Environment, opts completionOptions) (done bool) {
 	compdebug.Time("Total", func() {
-		runWithSpecCatcher(func() {
+		runWithSpecCatcher(env.Stderr, func() {
 			// Prepare shell adapter.
-			adapter := adapters.GetShellAdapter(in, out)
+			adapter := adapters.GetShellAdapter(in, out, env)
 			defer adapter.Finish()
 
 			spec := specProducer()
 			directives := compromise.ExtractDirectives(spec)
 
 			cl := adapter.GetCommandLine(args)
-			compstore.UpdateForInvocation(cl.RawWords(), cl.CursorIndex())
+			compstore.UpdateForInvocation(cl.RawWords(), cl.Words(), cl.CursorIndex(), cl.Environment())
 
 			// Run.
 			e := compengine.NewEngine(adapter, cl, directives)
+			if opts.nonInteractive && e.NeedsInteractive() {
+				return
+			}
 			compdebug.Time("Parse spec", func() {
-				e.ParseSpec(spec)
+				if opts.parse != nil {
+					e.SetAST(opts.parse(spec, directives))
+				} else {
+					e.ParseSpec(spec)
+				}
 			})
 			e.Run()
+			done = true
 		})
 	})
+	return
 }
 
+// loadFile reads a spec from a file, or from stdin if path is "-".
 func loadFile(path string) (ret string) {
 	compdebug.Time("Load spec file", func() {
-		data, err := os.ReadFile(path)
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
 		common.Checkf(err, "unable to read from %s", path)
 		ret = string(data)
 	})
@@ -0,0 +1,6 @@
+@label :intent # Intent flags
+    @call :flags
+@label :flags
+    @switch
+        -a
+        -d
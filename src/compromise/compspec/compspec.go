@@ -0,0 +1,324 @@
+// Package compspec builds specs in Go code, as an alternative to text specs.
+//
+//	s := compspec.Command("adb").
+//		SwitchLoop("^-",
+//			compspec.Flag("-d", "Use USB device"),
+//			compspec.Flag("-s", "Use device with given serial").Cand("takeDeviceSerial")).
+//		Switch("",
+//			compspec.Literal("devices").Help("List connected devices"))
+//	root, err := s.Build()
+package compspec
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compstruct"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"runtime"
+	"strings"
+)
+
+// location is where a node is created in Go code, which is used as the location of the node
+// in errors.
+type location struct {
+	file string
+	line int
+}
+
+func (at location) SourceLocation() (string, int, int) {
+	return at.file, at.line, 1
+}
+
+func caller() location {
+	// The caller of the exported function that calls caller().
+	_, file, line, _ := runtime.Caller(2)
+	return location{file, line}
+}
+
+// option is a directive that applies to a branch, e.g. @once.
+type option struct {
+	location
+	name  string
+	group string // For @exclusive.
+}
+
+// Node is a node of a spec, which is either a spec itself returned by New or Command, a
+// directive, or a literal. Methods named after directives, e.g. Cand, add a node to the children
+// of the receiver and return the receiver, so they can be chained.
+type Node struct {
+	location
+	directive string // e.g. "switch", "literal", or "root" for a spec.
+
+	words []string // Alternatives of a literal, or operands of a directive.
+	label string   // Label of @command, @label and @call, without ":".
+	help  string
+
+	children []*Node
+	options  []*option
+}
+
+func newNode(at location, directive string, words ...string) *Node {
+	return &Node{location: at, directive: directive, words: words}
+}
+
+// New returns an empty spec, which doesn't define target commands.
+func New() *Node {
+	return newNode(caller(), "root")
+}
+
+// Command returns a spec for commands, whose children are the nodes that complete them.
+func Command(commands ...string) *Node {
+	n := newNode(caller(), "root")
+	for _, c := range commands {
+		n.children = append(n.children, newNode(n.location, "command", c))
+	}
+	return n
+}
+
+// Command adds a target command to a spec, which starts at a label if it's not empty.
+func (n *Node) Command(command, label string) *Node {
+	c := newNode(caller(), "command", command)
+	c.label = strings.TrimPrefix(label, ":")
+	return n.Add(c)
+}
+
+// Label returns a label, which can be added to a spec. Parameters must be $name, and are
+// replaced with the arguments of @call.
+func Label(label string, params ...string) *Node {
+	n := newNode(caller(), "label", params...)
+	n.label = strings.TrimPrefix(label, ":")
+	return n
+}
+
+// Literal returns a literal that matches any of the words.
+func Literal(words ...string) *Node {
+	return newNode(caller(), "literal", words...)
+}
+
+// Flag returns a literal for a flag with a help. Aliases are separated with '|', as in
+// "-v|--verbose".
+func Flag(names, help string) *Node {
+	n := newNode(caller(), "literal", strings.Split(names, "|")...)
+	n.help = help
+	return n
+}
+
+// Switch returns a @switch, which runs the first branch that matches the word. If pattern isn't
+// empty, the switch only runs when the word matches it.
+func Switch(pattern string, branches ...*Node) *Node {
+	return newBlock(caller(), "switch", pattern, branches)
+}
+
+// SwitchLoop returns a @switchloop, which runs the switch as long as a branch matches.
+func SwitchLoop(pattern string, branches ...*Node) *Node {
+	return newBlock(caller(), "switchloop", pattern, branches)
+}
+
+// Loop returns a @loop, which runs the children repeatedly.
+func Loop(pattern string, children ...*Node) *Node {
+	return newBlock(caller(), "loop", pattern, children)
+}
+
+func newBlock(at location, directive, pattern string, children []*Node) *Node {
+	n := newNode(at, directive)
+	if pattern != "" {
+		n.words = []string{pattern}
+	}
+	n.children = children
+	return n
+}
+
+// Any returns an @any, which matches any word.
+func Any(help string) *Node {
+	n := newNode(caller(), "any")
+	n.help = help
+	return n
+}
+
+// Cand returns a @cand, which takes candidates from a registered function.
+func Cand(funcName string, args ...string) *Node {
+	return newNode(caller(), "cand", append([]string{funcName}, args...)...)
+}
+
+// GoCall returns a @go_call, which calls a registered function.
+func GoCall(funcName string, args ...string) *Node {
+	return newNode(caller(), "go_call", append([]string{funcName}, args...)...)
+}
+
+// Exec returns an @exec, which takes candidates from the output of a shell command.
+func Exec(command, help string) *Node {
+	n := newNode(caller(), "exec", command)
+	n.help = help
+	return n
+}
+
+// Lines returns a @lines, which takes candidates from the lines in a file.
+func Lines(path, help string) *Node {
+	n := newNode(caller(), "lines", path)
+	n.help = help
+	return n
+}
+
+// Call returns a @call, which runs the nodes under a label.
+func Call(label string, args ...string) *Node {
+	n := newNode(caller(), "call", args...)
+	n.label = strings.TrimPrefix(label, ":")
+	return n
+}
+
+// If returns an @if, whose children run only when a condition holds, e.g. If("env", "NAME").
+func If(condition string, args ...string) *Node {
+	return newNode(caller(), "if", append([]string{condition}, args...)...)
+}
+
+// Set returns a @set, which stores a value for functions.
+func Set(name, value string) *Node {
+	return newNode(caller(), "set", name, value)
+}
+
+// Capture returns a @capture, which stores the word matched by the previous node.
+func Capture(name string) *Node {
+	return newNode(caller(), "capture", name)
+}
+
+// Finish returns a @finish, which stops completion.
+func Finish() *Node {
+	return newNode(caller(), "finish")
+}
+
+// Break returns a @break, which exits the innermost loop.
+func Break() *Node {
+	return newNode(caller(), "break")
+}
+
+// Continue returns a @continue, which goes back to the start of the innermost loop.
+func Continue() *Node {
+	return newNode(caller(), "continue")
+}
+
+// Add adds nodes to the children.
+func (n *Node) Add(children ...*Node) *Node {
+	n.children = append(n.children, children...)
+	return n
+}
+
+// Help sets the help of a literal, @any, @exec, @lines or @label.
+func (n *Node) Help(help string) *Node {
+	n.help = help
+	return n
+}
+
+// Once makes a branch of a @switchloop offered only once.
+func (n *Node) Once() *Node {
+	n.options = append(n.options, &option{location: caller(), name: "once"})
+	return n
+}
+
+// Exclusive puts a branch of a @switchloop in a group, whose branches can be used only once.
+func (n *Node) Exclusive(group string) *Node {
+	n.options = append(n.options, &option{location: caller(), name: "exclusive", group: strings.TrimPrefix(group, ":")})
+	return n
+}
+
+// Joined makes a flag take a value in the same word too.
+func (n *Node) Joined() *Node {
+	n.options = append(n.options, &option{location: caller(), name: "joined"})
+	return n
+}
+
+// Bundle allows a short flag to be combined with other short flags in a word.
+func (n *Node) Bundle() *Node {
+	n.options = append(n.options, &option{location: caller(), name: "bundle"})
+	return n
+}
+
+// Literal adds a literal that matches any of the words.
+func (n *Node) Literal(words ...string) *Node {
+	return n.Add(newNode(caller(), "literal", words...))
+}
+
+// Switch adds a @switch. See Switch.
+func (n *Node) Switch(pattern string, branches ...*Node) *Node {
+	return n.Add(newBlock(caller(), "switch", pattern, branches))
+}
+
+// SwitchLoop adds a @switchloop. See SwitchLoop.
+func (n *Node) SwitchLoop(pattern string, branches ...*Node) *Node {
+	return n.Add(newBlock(caller(), "switchloop", pattern, branches))
+}
+
+// Loop adds a @loop. See Loop.
+func (n *Node) Loop(pattern string, children ...*Node) *Node {
+	return n.Add(newBlock(caller(), "loop", pattern, children))
+}
+
+// Any adds an @any. See Any.
+func (n *Node) Any(help string) *Node {
+	c := newNode(caller(), "any")
+	c.help = help
+	return n.Add(c)
+}
+
+// Cand adds a @cand. See Cand.
+func (n *Node) Cand(funcName string, args ...string) *Node {
+	return n.Add(newNode(caller(), "cand", append([]string{funcName}, args...)...))
+}
+
+// Call adds a @call. See Call.
+func (n *Node) Call(label string, args ...string) *Node {
+	c := newNode(caller(), "call", args...)
+	c.label = strings.TrimPrefix(label, ":")
+	return n.Add(c)
+}
+
+// Build returns a tree of a spec, which the engine can run, or an error if the spec is invalid.
+// It's checked the same way as text specs are parsed.
+func (n *Node) Build() (root *compast.Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(compromise.SpecError); ok {
+				root, err = nil, e
+				return
+			}
+			panic(r)
+		}
+	}()
+	if n.directive != "root" {
+		panic(compromise.NewSpecError(n.location, "only a spec from New or Command can be built"))
+	}
+	return parser.BuildStructured(n.structured()), nil
+}
+
+// structured returns the structured nodes of a spec, or of a node.
+func (n *Node) structured() []*parser.StructuredNode {
+	if n.directive == "root" {
+		ret := make([]*parser.StructuredNode, 0, len(n.children))
+		for _, c := range n.children {
+			ret = append(ret, c.structured()...)
+		}
+		return ret
+	}
+	s := &parser.StructuredNode{
+		Location: parser.Location{File: n.file, Line: n.line, Column: 1},
+		Type:     n.directive,
+		Words:    n.words,
+		Label:    n.label,
+		Help:     n.help,
+	}
+	for _, o := range n.options {
+		s.Options = append(s.Options, &parser.StructuredOption{
+			Location: parser.Location{File: o.file, Line: o.line, Column: 1},
+			Name:     o.name,
+			Group:    o.group,
+		})
+	}
+	for _, c := range n.children {
+		s.Children = append(s.Children, c.structured()...)
+	}
+	return []*parser.StructuredNode{s}
+}
+
+// String returns the spec in the text form, e.g. for debugging, or for compmain.Main().
+func (n *Node) String() string {
+	return compstruct.Text(n.structured())
+}
@@ -0,0 +1,120 @@
+package compspec
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/compromise/src/compromise/internal/adapters"
+	compengine "github.com/omakoto/compromise/src/compromise/internal/completer"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func init() {
+	compenv.CacheTimeout = -1
+	compenv.Frecency = false
+	compdebug.CloseLog()
+	os.Setenv("COMPROMISE_SHELL", "tester")
+}
+
+func adbSpec() *Node {
+	return Command("adb").
+		SwitchLoop("^-",
+			Flag("-d", "Use USB device").Once(),
+			Flag("-s", "Use device with given serial").Any("Serial"),
+			Flag("-l|--long", "Long output")).
+		Switch("",
+			Literal("devices").Help("List devices"),
+			Literal("shell").Call("shell", "am"),
+			Literal("push", "pull").Loop("", Cand("TakeFile")),
+			Literal("a b")).
+		Add(Label("shell", "$kind").Help("Shell commands").Add(
+			If("!env", "NO_SHELL").Literal("$kind")))
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, `@command adb
+@switchloop "^-"
+	-d        # Use USB device
+		@once
+	-s        # Use device with given serial
+		@any # Serial
+	-l|--long # Long output
+@switch
+	devices # List devices
+	shell
+		@call :shell am
+	push|pull
+		@loop
+			@cand TakeFile
+	"a b"
+
+@label :shell $kind # Shell commands
+	@if !env NO_SHELL
+		$kind
+`, adbSpec().String())
+}
+
+var idRe = regexp.MustCompile(`#\d+ `)
+
+// TestBuild checks that the tree is the same as the one parsed from the text form.
+func TestBuild(t *testing.T) {
+	s := adbSpec()
+	root, err := s.Build()
+	assert.NoError(t, err)
+
+	parsed := parser.Parse(s.String(), compromise.NewDirectives())
+	assert.Equal(t, idRe.ReplaceAllString(parsed.Dump(true), ""), idRe.ReplaceAllString(root.Dump(true), ""))
+}
+
+func complete(root *compast.Node, args ...string) string {
+	buf := &bytes.Buffer{}
+	adapter := adapters.GetShellAdapter(nil, buf, compromise.CurrentEnvironment())
+	e := compengine.NewEngine(adapter, adapter.GetCommandLine(args), compromise.NewDirectives())
+	e.SetAST(root)
+	e.Run()
+	adapter.Finish()
+	return buf.String()
+}
+
+func TestRun(t *testing.T) {
+	root, err := adbSpec().Build()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "--long #\"Long output\"\n-d #\"Use USB device\"\n-l #\"Long output\"\n-s #\"Use device with given serial\"\n",
+		complete(root, "adb", "-"))
+	assert.Equal(t, "--long #\"Long output\"\n-l #\"Long output\"\n-s #\"Use device with given serial\"\n",
+		complete(root, "adb", "-d", "-"))
+	assert.Equal(t, "am\n", complete(root, "adb", "shell", ""))
+	assert.Equal(t, "pull\npush\n", complete(root, "adb", "pu"))
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		spec     *Node
+		expected string
+	}{
+		{Command("cmd").Call("undefined"), `undefined label :undefined`},
+		{Command("cmd").Add(Label("x", "kind")), `invalid parameter "kind", which must be $name`},
+		{Command("cmd").Add(If("os", "linux")), `unknown condition "os", which must be env, file, word or go, optionally with !`},
+		{Command("cmd").Switch("", Literal("a").Bundle()), `@bundle only applies to short flags such as -a, but "a" isn't`},
+		{Command("cmd").Add(Label("x").Once()), `@once must be a child of a branch`},
+		{Command("cmd").Switch("", Literal("a b", "c")), `alternative "a b" of a literal has a special character`},
+		{Command("cmd").Switch("", Literal("a").Add(Label("x"))), `@label must be at the toplevel`},
+		{Command("cmd").Add(Label("x")).Literal("a"), `only @label can appear at the top level`},
+		{Literal("a"), `only a spec from New or Command can be built`},
+	}
+	locationRe := regexp.MustCompile(` at [^ ]*compspec_test\.go:\d+:1$`)
+	for _, v := range tests {
+		_, err := v.spec.Build()
+		if assert.Error(t, err, v.expected) {
+			assert.Regexp(t, locationRe, err.Error(), v.expected)
+			assert.Equal(t, v.expected, locationRe.ReplaceAllString(err.Error(), ""))
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package compstruct converts specs between the text form and the structured forms, JSON and
+// YAML, which other tools can generate without the indentation of text specs. Structured specs
+// can also be used as specs as they are, e.g.
+//
+//	[
+//	  {"type": "command", "name": "adb"},
+//	  {"type": "switch", "children": [
+//	    {"type": "literal", "words": "devices", "help": "List devices"},
+//	    "kill-server"
+//	  ]}
+//	]
+package compstruct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compfmt"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+)
+
+// Formats are the formats that specs can be converted to.
+var Formats = []string{"text", "json", "yaml"}
+
+// Convert converts a spec, which is either a text spec or a structured spec, into a format.
+// Comments in text specs are lost, but the directives in the first line are kept, with the format
+// directive for the new format. Included files are kept as @include's, so they have to be
+// converted separately.
+func Convert(spec string, d *compromise.Directives, format string) (ret string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(compromise.SpecError); ok {
+				ret, err = "", e
+				return
+			}
+			panic(r)
+		}
+	}()
+	nodes := parser.ToStructured(spec, d)
+
+	switch format {
+	case "text":
+		ret = Text(nodes)
+	case "json":
+		ret, err = JSON(nodes)
+	case "yaml":
+		ret, err = YAML(nodes)
+	default:
+		return "", fmt.Errorf("unsupported format %q; must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	if err == nil && strings.HasPrefix(spec, "//{") {
+		var line string
+		line, err = withFormat(spec[2:strings.IndexByte(spec+"\n", '\n')], format)
+		ret = "//" + line + "\n" + ret
+	}
+	return ret, err
+}
+
+// withFormat returns the directives in the first line of a spec with the format directive set to
+// a format, or removed for text.
+func withFormat(directives, format string) (string, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(directives), &m); err != nil {
+		return "", err
+	}
+	if _, ok := m["format"]; !ok && format == "text" {
+		return directives, nil
+	}
+	if format == "text" {
+		delete(m, "format")
+	} else {
+		m["format"] = format
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// JSON returns a structured spec in JSON.
+func JSON(nodes []*parser.StructuredNode) (string, error) {
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(nodes); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// YAML returns a structured spec in YAML.
+func YAML(nodes []*parser.StructuredNode) (string, error) {
+	b := &bytes.Buffer{}
+	enc := yaml.NewEncoder(b)
+	enc.SetIndent(2)
+	if err := enc.Encode(nodes); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Text returns a spec in the text form, which is formatted with compfmt.
+func Text(nodes []*parser.StructuredNode) string {
+	b := &strings.Builder{}
+	for i, n := range nodes {
+		if i > 0 && n.Type == "label" {
+			b.WriteString("\n")
+		}
+		write(b, n, 0)
+	}
+	ret, err := compfmt.Format(b.String(), compromise.NewDirectives())
+	if err != nil {
+		// Invalid specs can't be formatted, but are still useful for debugging.
+		return b.String()
+	}
+	return ret
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func write(b *strings.Builder, n *parser.StructuredNode, depth int) {
+	b.WriteString(strings.Repeat("\t", depth))
+	quoted := make([]string, 0, len(n.Words))
+	for _, w := range n.Words {
+		quoted = append(quoted, compfmt.Literal(w))
+	}
+	if len(quoted) > 0 && (n.Type == "switch" || n.Type == "switchloop" || n.Type == "loop") {
+		// Patterns are always quoted, as in most specs.
+		quoted[0] = strconv.Quote(n.Words[0])
+	}
+	label := ""
+	if n.Label != "" {
+		label = ":" + n.Label
+	}
+
+	var line []string
+	switch n.Type {
+	case "literal":
+		if len(n.Words) > 1 {
+			line = []string{strings.Join(n.Words, "|")}
+		} else {
+			line = quoted
+		}
+	case "label", "call":
+		line = append([]string{"@" + n.Type, label}, quoted...)
+	default:
+		line = append([]string{"@" + n.Type}, quoted...)
+		if label != "" {
+			line = append(line, label)
+		}
+	}
+	if n.Help != "" {
+		line = append(line, "# "+singleLine(n.Help))
+	}
+	b.WriteString(strings.Join(line, " "))
+	b.WriteString("\n")
+
+	for _, o := range n.Options {
+		b.WriteString(strings.Repeat("\t", depth+1) + "@" + o.Name)
+		if o.Group != "" {
+			b.WriteString(" :" + o.Group)
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range n.Children {
+		write(b, c, depth+1)
+	}
+}
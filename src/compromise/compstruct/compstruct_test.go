@@ -0,0 +1,67 @@
+package compstruct
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/internal/golden"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var idRe = regexp.MustCompile(`#\d+ `)
+
+// TestFixtures converts testdata/mytool.spec to each format and back, and checks that all of
+// them are parsed into the same tree.
+func TestFixtures(t *testing.T) {
+	text := golden.Read(t, "testdata/mytool.spec")
+	d := compromise.NewDirectives().SetFilename("mytool.spec")
+	expectedTree := idRe.ReplaceAllString(parser.Parse(text, d).Dump(true), "")
+
+	// A text spec is converted to itself.
+	filename := func(format string) string {
+		return "mytool." + strings.Replace(format, "text", "spec", 1)
+	}
+	golden.Formats(t, Formats, func(format string) string {
+		return "testdata/" + filename(format)
+	}, func(t *testing.T, format string) string {
+		converted, err := Convert(text, d, format)
+		assert.NoError(t, err)
+
+		// The extension tells the format.
+		cd := compromise.NewDirectives().SetFilename(filename(format))
+		back, err := Convert(converted, cd, "text")
+		assert.NoError(t, err)
+		assert.Equal(t, text, back)
+
+		tree := idRe.ReplaceAllString(parser.Parse(converted, cd).Dump(true), "")
+		assert.Equal(t, expectedTree, tree)
+		return converted
+	})
+}
+
+func TestDirectives(t *testing.T) {
+	spec := "//{\"matcher\":\"fuzzy\"}\n" +
+		"@command cmd\n" +
+		"a # Help\n"
+	converted, err := Convert(spec, compromise.ExtractDirectives(spec), "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "//{\"format\":\"yaml\",\"matcher\":\"fuzzy\"}\n"+
+		"- type: command\n"+
+		"  name: cmd\n"+
+		"- type: literal\n"+
+		"  words: a\n"+
+		"  help: Help\n", converted)
+
+	back, err := Convert(converted, compromise.ExtractDirectives(converted), "text")
+	assert.NoError(t, err)
+	assert.Equal(t, spec, back)
+}
+
+func TestErrors(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x.json")
+	_, err := Convert("[\n  {\"type\": \"swtch\"}\n]\n", d, "text")
+	assert.EqualError(t, err, `unknown type "swtch", which must be one of: any, break, call, cand, capture, command, `+
+		`continue, exec, finish, go_call, group, if, include, label, lines, literal, loop, set, switch, switchloop at x.json:2:3`)
+}
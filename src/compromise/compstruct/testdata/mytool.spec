@@ -0,0 +1,38 @@
+@command mytool
+@command mt :mytool
+
+@label :mytool
+	@switchloop "^-"
+		-v|--verbose # Show more output
+			@once
+		-q|--quiet   # Show less output
+			@once
+		-C           # <DIR> Run in a directory
+			@joined
+			@cand TakeDir
+		--color      # When to use colors
+			@exclusive :color
+			@switch
+				auto
+				always
+				never
+		--no-color   # Don't use colors
+			@exclusive :color
+	@switch
+		build|b # Build targets
+			@loop
+				@call :target build
+		run     # Run a program
+			@any # <PROGRAM>
+			@loop
+				@cand TakeFile
+		"a|b"   # A literal with '|'
+		version # Print the version
+			@finish
+
+@label :target $kind # Targets to $kind
+	@switch
+		all  # Everything
+		test # Tests only
+		@if env MYTOOL_EXTRA
+			extra # Extra targets
@@ -1,10 +1,8 @@
 package comptest
 
 import (
+	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compdebug"
-	"github.com/omakoto/go-common/src/common"
-	"os"
-	"os/exec"
 	"regexp"
 )
 
@@ -17,6 +15,11 @@ var injectedOutputs []injectedOutput
 
 // Execute a command and return the stdout.
 func ExecAndGetStdout(command string) ([]byte, error) {
+	return ExecAndGetStdoutEnv(compromise.CurrentEnvironment(), command)
+}
+
+// Execute a command in an environment and return the stdout.
+func ExecAndGetStdoutEnv(env *compromise.Environment, command string) ([]byte, error) {
 	compdebug.Debugf("Executing: %q\n", command)
 
 	for _, i := range injectedOutputs {
@@ -24,12 +27,10 @@ func ExecAndGetStdout(command string) ([]byte, error) {
 			return []byte(i.output), nil
 		}
 	}
-	cmd := exec.Command("/bin/sh", "-c", command)
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
+	output, err := env.Command(command).Output()
 
 	if err != nil {
-		common.Warnf("Command execution error: command=%q error=%s", command, err)
+		env.Warnf("Command execution error: command=%q error=%s", command, err)
 	}
 	return output, err
 }
@@ -23,4 +23,17 @@ type CompleteContext interface {
 	AfterCursor() bool
 	// AtCursor returns whether pc is equal to the cursor index.
 	AtCursor() bool
+
+	// Matcher returns the Matcher that candidates are matched with in the current completion.
+	Matcher() Matcher
+
+	// Environment returns the environmental variables and the current directory of the shell,
+	// which functions must use instead of the current process's.
+	Environment() *Environment
+
+	// Get returns a value stored with Set, or "" if not set.
+	Get(key string) string
+	// Set stores a value in the state of the current completion. Values set in a switch branch
+	// are discarded if the branch doesn't match.
+	Set(key, value string)
 }
@@ -9,9 +9,17 @@ import (
 )
 
 type Directives struct {
-	TabWidth  int    `json:"tab"`  // Tabs in a spec is assumed to be this many spaces.
-	StartLine int    `json:"line"` // USed to override the number of a spec string
-	Filename  string `json:"file"` // Filename where a spec is defined
+	TabWidth  int    `json:"tab"`               // Tabs in a spec is assumed to be this many spaces.
+	StartLine int    `json:"line"`              // USed to override the number of a spec string
+	Filename  string `json:"file"`              // Filename where a spec is defined
+	Matcher   string `json:"matcher,omitempty"` // Matcher name, e.g. "prefix", "fuzzy"
+
+	// Format of a spec, "text", "json" or "yaml". Defaults to the extension of Filename, e.g.
+	// ".json", or "text".
+	Format string `json:"format,omitempty"`
+
+	// Namespace of the labels in a spec fragment. Defaults to the base name of Filename.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 func NewDirectives() *Directives {
@@ -44,14 +52,38 @@ func (d *Directives) Tab(tabWidth int) *Directives {
 	return d
 }
 
+func (d *Directives) SetMatcher(matcher string) *Directives {
+	d.Matcher = matcher
+	return d
+}
+
+func (d *Directives) SetNamespace(namespace string) *Directives {
+	d.Namespace = namespace
+	return d
+}
+
+func (d *Directives) SetFormat(format string) *Directives {
+	d.Format = format
+	return d
+}
+
 func (d *Directives) JSON() string {
 	buffer, err := json.Marshal(d)
 	common.CheckPanic(err, "json.Marshal failed.")
 	return string(buffer)
 }
 
-func (d *Directives) UnmarshalJSON(jsonString string) error {
-	return json.Unmarshal([]byte(jsonString), d)
+// UnmarshalJSON sets the directives in JSON. It takes bytes to implement json.Unmarshaler; use
+// FromJSON for a string.
+func (d *Directives) UnmarshalJSON(data []byte) error {
+	// Unmarshal into a type without the method, which would call it again.
+	type plain Directives
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// FromJSON sets the directives in a JSON string.
+func (d *Directives) FromJSON(jsonString string) error {
+	return d.UnmarshalJSON([]byte(jsonString))
 }
 
 // ExtractDirectives options in a form of json from the first line of the spec string.
@@ -61,7 +93,7 @@ func ExtractDirectives(spec string) *Directives {
 		return ret
 	}
 	directiveJSON := spec[2:utils.IndexByteOrLen(spec, '\n')]
-	err := ret.UnmarshalJSON(directiveJSON)
+	err := ret.FromJSON(directiveJSON)
 	if err != nil {
 		panic(NewSpecErrorf(nil, "invalid parser directive in line 1 %s: %s", directiveJSON, err.Error()))
 	}
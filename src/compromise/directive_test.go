@@ -0,0 +1,20 @@
+package compromise
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDirectivesJSON(t *testing.T) {
+	d := NewDirectives()
+	assert.NoError(t, d.FromJSON(`{"file":"a.spec","matcher":"fuzzy"}`))
+	assert.Equal(t, "a.spec", d.Filename)
+	assert.Equal(t, "fuzzy", d.Matcher)
+	assert.Equal(t, 8, d.TabWidth)
+
+	// Directives can be a part of other JSON.
+	var v struct{ Directives *Directives }
+	assert.NoError(t, json.Unmarshal([]byte(`{"Directives":`+d.JSON()+`}`), &v))
+	assert.Equal(t, d, v.Directives)
+}
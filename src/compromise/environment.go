@@ -0,0 +1,68 @@
+package compromise
+
+import (
+	"fmt"
+	"github.com/omakoto/go-common/src/common"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Environment is what a completion sees from the process that requested it, i.e. the shell.
+// It's usually the same as the current process's, but the completion daemon performs completion
+// on behalf of other processes, so completion code must use it instead of the os package.
+type Environment struct {
+	// Vars are the environmental variables in the "key=value" form.
+	Vars []string
+
+	// Dir is the current directory.
+	Dir string
+
+	// Stderr receives messages to the user.
+	Stderr io.Writer
+}
+
+// CurrentEnvironment returns the Environment of the current process.
+func CurrentEnvironment() *Environment {
+	dir, _ := os.Getwd()
+	return &Environment{Vars: os.Environ(), Dir: dir, Stderr: os.Stderr}
+}
+
+// Getenv returns the value of an environmental variable, or "" if not set.
+func (e *Environment) Getenv(key string) string {
+	// Later ones take precedence, as in os/exec.
+	for i := len(e.Vars) - 1; i >= 0; i-- {
+		if v := e.Vars[i]; strings.HasPrefix(v, key) && len(v) > len(key) && v[len(key)] == '=' {
+			return v[len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// Path converts a path relative to Dir to one that the current process can use.
+func (e *Environment) Path(path string) string {
+	if path == "" || filepath.IsAbs(path) || e.Dir == "" {
+		return path
+	}
+	return filepath.Join(e.Dir, path)
+}
+
+// Warnf writes a warning to Stderr, as common.Warnf does to os.Stderr.
+func (e *Environment) Warnf(format string, args ...interface{}) {
+	if common.Quiet || e.Stderr == nil {
+		return
+	}
+	message := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	fmt.Fprintf(e.Stderr, "%s: %s\n", common.MustGetBinName(), message)
+}
+
+// Command returns a command that runs a command line with /bin/sh in the environment.
+func (e *Environment) Command(command string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = e.Vars
+	cmd.Dir = e.Dir
+	cmd.Stderr = e.Stderr
+	return cmd
+}
@@ -0,0 +1,26 @@
+package compromise
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	env := &Environment{Vars: []string{"A=1", "AB=2", "A=3", "EMPTY="}, Dir: "/work"}
+
+	assert.Equal(t, "3", env.Getenv("A"))
+	assert.Equal(t, "2", env.Getenv("AB"))
+	assert.Equal(t, "", env.Getenv("EMPTY"))
+	assert.Equal(t, "", env.Getenv("NONE"))
+
+	assert.Equal(t, "/work/a", env.Path("a"))
+	assert.Equal(t, "/a", env.Path("/a"))
+	assert.Equal(t, "", env.Path(""))
+	assert.Equal(t, "a", (&Environment{}).Path("a"))
+
+	dir := t.TempDir()
+	env.Dir = dir
+	out, err := env.Command(`echo "$AB"; pwd`).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "2\n"+dir+"\n", string(out))
+}
@@ -20,3 +20,11 @@ func NewSpecError(location SourceLocation, message string) SpecError {
 func NewSpecErrorf(location SourceLocation, format string, args ...interface{}) SpecError {
 	return SpecError{location, fmt.Sprintf(format, args...)}
 }
+
+func (e SpecError) Error() string {
+	if e.Location == nil {
+		return e.Message
+	}
+	file, line, column := e.Location.SourceLocation()
+	return fmt.Sprintf("%s at %s:%d:%d", e.Message, file, line, column)
+}
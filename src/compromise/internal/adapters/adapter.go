@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/go-common/src/common"
+	"github.com/omakoto/go-common/src/utils"
 	"io"
-	"os"
 	"path/filepath"
 )
 
@@ -49,19 +49,25 @@ func toShellSafeName(commandName string) string {
 	return ret.String()
 }
 
-func GetShellAdapter(rd io.Reader, wr io.Writer) ShellAdapter {
-	shell := os.Getenv("COMPROMISE_SHELL")
+func GetShellAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) ShellAdapter {
+	shell := utils.FirstNonEmpty(env.Getenv("COMPROMISE_SHELL"), env.Getenv("SHELL"))
 	if shell == "" {
-		shell = common.MustGetenv("SHELL")
+		env.Warnf("SHELL not set")
+		common.ExitFailure()
 	}
 	switch filepath.Base(shell) {
 	case "bash":
-		return newBashAdapter(rd, wr)
+		return newBashAdapter(rd, wr, env)
 	case "zsh":
-		return newZshAdapter(rd, wr)
+		return newZshAdapter(rd, wr, env)
+	case "fish":
+		return newFishAdapter(rd, wr, env)
+	case "nu", "nushell":
+		return newNushellAdapter(rd, wr, env)
 	case "tester":
-		return newTesterAdapter(rd, wr)
+		return newTesterAdapter(rd, wr, env)
 	}
-	common.Fatalf("Unknown shell %s", shell)
+	env.Warnf("Unknown shell %s", shell)
+	common.ExitFailure()
 	return nil
 }
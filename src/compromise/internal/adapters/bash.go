@@ -17,7 +17,6 @@ import (
 	"github.com/ungerik/go-dry"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -38,6 +37,7 @@ type bashAdapter struct {
 
 	in  io.Reader
 	out *bufio.Writer
+	env *compromise.Environment
 
 	candidates []compromise.Candidate
 
@@ -49,8 +49,8 @@ type bashAdapter struct {
 
 var _ ShellAdapter = ((*bashAdapter)(nil))
 
-func newBashAdapter(rd io.Reader, wr io.Writer) *bashAdapter {
-	a := &bashAdapter{in: rd, out: bufio.NewWriter(wr)}
+func newBashAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) *bashAdapter {
+	a := &bashAdapter{in: rd, out: bufio.NewWriter(wr), env: env}
 
 	return a
 }
@@ -58,7 +58,7 @@ func newBashAdapter(rd io.Reader, wr io.Writer) *bashAdapter {
 // bashParameters is a template parameter
 type bashParameters struct {
 	FuncName             string
-	ExecutableName       string
+	Invocation           []string
 	CommandNames         []string
 	SkipBashBind         string
 	CompletionIgnoreCase string
@@ -77,9 +77,7 @@ func (p *bashParameters) Unescape(arg string) string {
 func (a *bashAdapter) Install(targetCommandNames []string, spec string) {
 	p := bashParameters{}
 	p.FuncName = getFuncName(targetCommandNames[0])
-	path, err := filepath.Abs(common.MustGetExecutable())
-	common.Checkf(err, "Abs failed")
-	p.ExecutableName = path
+	p.Invocation = getInvocation()
 	p.CommandNames = targetCommandNames
 	p.SkipBashBind = "0"
 	if compenv.BashSkipBind {
@@ -135,12 +133,14 @@ function {{.FuncName}}() {
   export COMP_TYPE
   export COMP_WORDBREAKS
   . <( __compromise_context_dumper |
-      {{.Escape .ExecutableName}} --` + InvokeOption + ` <({{.FuncName}}_spec) \
+      {{range .Invocation}}{{$.Escape .}} {{end}}--` + InvokeOption + ` <({{.FuncName}}_spec) \
 	      "$COMP_CWORD" "${COMP_WORDS[@]}" 
   )
 }
 
-complete -o nospace -F {{$.FuncName}} --{{range $command := .CommandNames}} {{$.Escape $command}}{{end}}
+# Keep the order of the candidates (-o nosort), if supported. (bash 4.4+)
+complete -o nospace -o nosort -F {{$.FuncName}} --{{range $command := .CommandNames}} {{$.Escape $command}}{{end}} 2>/dev/null ||
+  complete -o nospace -F {{$.FuncName}} --{{range $command := .CommandNames}} {{$.Escape $command}}{{end}}
 
 if [[ "$COMPROMISE_QUIET" != 1 ]] ; then
   echo "Installed completion:"{{range $command := .CommandNames}} {{$.Escape $command}}{{end}} 1>&2
@@ -188,17 +188,17 @@ func (a *bashAdapter) GetCommandLine(args []string) *CommandLine {
 	common.CheckPanic(err, "Atoi failed") // This is an internal error, so use panic.
 	compWords := args[1:]
 
-	ret := newCommandLine(a.Unescape, cword, compWords)
+	ret := newCommandLine(a.env, a.Unescape, cword, compWords)
 
 	ret.bashCompCword = cword
 	ret.bashCompWords = compWords
 	if cword <= len(compWords) {
 		ret.bashCompCurrentWord = compWords[cword]
 	}
-	ret.bashCompPoint = int(utils.ParseInt(os.Getenv("COMP_POINT"), 10, -1))
-	ret.bashCompLine = os.Getenv("COMP_LINE")
-	ret.bashCompType = os.Getenv("COMP_TYPE")
-	ret.bashCompWordbreaks = os.Getenv("COMP_WORDBREAKS")
+	ret.bashCompPoint = int(utils.ParseInt(a.env.Getenv("COMP_POINT"), 10, -1))
+	ret.bashCompLine = a.env.Getenv("COMP_LINE")
+	ret.bashCompType = a.env.Getenv("COMP_TYPE")
+	ret.bashCompWordbreaks = a.env.Getenv("COMP_WORDBREAKS")
 	ret.bashParsedRawWords = shell.SplitToTokens(ret.bashCompLine)
 
 	// For compatibility with zsh, and also for simplicity, we ignore $COMP_CWORD and $COMP_WORDS
@@ -315,7 +315,7 @@ func (a *bashAdapter) MaybeOverrideCandidates(commandLine *CommandLine) []compro
 				// $NAM[TAB]
 				// Do a variable name expansion. e.g. $PAT -> $PATH
 				for key := range a.variables {
-					if compromise.StringMatches(key, m[1]) {
+					if _, ok := commandLine.Matcher().Match(key, m[1]); ok {
 						ret = append(ret, compromise.NewCandidate().SetValue("$"+key).SetContinues(true).SetForce(true))
 					}
 				}
@@ -348,7 +348,7 @@ func (a *bashAdapter) MaybeOverrideCandidates(commandLine *CommandLine) []compro
 		return nil
 	}
 	compdebug.Debugf("  Switching to file complete\n")
-	return compfunc.TakeFile("").GetCandidate(commandLine.WordAtCursor(0))
+	return compromise.GetCandidates(compfunc.TakeFileEnv(commandLine.Environment(), ""), commandLine.Matcher(), commandLine.WordAtCursor(0))
 }
 
 func (a *bashAdapter) AddCandidate(c compromise.Candidate) {
@@ -406,12 +406,12 @@ func (a *bashAdapter) DefaultMaxHelps() int {
 func (a *bashAdapter) EndCompletion() {
 	// Show candidates on stdout for eval by bash.
 
-	store := compstore.Load()
+	store := compstore.Load(a.commandLine.Environment())
 
 	omitted := false
 	candCount := 0
 	for _, c := range a.candidates {
-		if c.Matches(a.commandLine.WordAtCursor(0)) && a.printCandidate(c) {
+		if _, ok := c.MatchScore(a.commandLine.Matcher(), a.commandLine.WordAtCursor(0)); ok && a.printCandidate(c) {
 			candCount++
 			if !store.IsDoublePress {
 				if candCount >= a.DefaultMaxCandidates() {
@@ -432,12 +432,21 @@ func (a *bashAdapter) EndCompletion() {
 		buf := bytes.NewBuffer(nil)
 
 		helpCount := 0
+		lastGroup := ""
 		for _, c := range a.candidates {
 			if len(c.Help()) == 0 {
 				continue
 			}
 			helpCount++
 
+			if c.Group() != lastGroup {
+				lastGroup = c.Group()
+				if len(lastGroup) > 0 {
+					AddGroupString(lastGroup, buf)
+					buf.WriteString("\n")
+				}
+			}
+
 			buf.WriteString("  ")
 			AddDisplayString(c, buf)
 			buf.WriteString("\n")
@@ -467,8 +476,8 @@ func (a *bashAdapter) EndCompletion() {
 
 		content := buf.Bytes()
 		if len(content) > 0 {
-			os.Stderr.WriteString("\n")
-			os.Stderr.Write(content)
+			a.env.Stderr.Write([]byte("\n"))
+			a.env.Stderr.Write(content)
 		}
 	}
 
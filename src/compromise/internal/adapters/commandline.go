@@ -5,6 +5,7 @@ import (
 	"github.com/omakoto/go-common/src/shell"
 	"github.com/omakoto/go-common/src/utils"
 	"github.com/ungerik/go-dry"
+	"strings"
 )
 
 // CommandLine holds the words in the command line and other contextual information.
@@ -21,6 +22,15 @@ type CommandLine struct {
 	// when executing completion.
 	pc int
 
+	// Values set by functions and @set/@capture during completion.
+	state state
+
+	// Matcher that candidates are matched with, which is set by the engine.
+	matcher compromise.Matcher
+
+	// Environment of the shell.
+	env *compromise.Environment
+
 	// Bash specific variables. We keep them here mostly so they'll be dumped in the debug log.
 	bashCompCword         int      // Index given by readline as COMP_CWORD
 	bashCompWords         []string // Words given by readline as COMP_WORDS (split up with COMP_WORDBREAKS)
@@ -36,8 +46,8 @@ type CommandLine struct {
 
 var _ compromise.CompleteContext = (*CommandLine)(nil)
 
-func newCommandLine(unescape func(string) string, cursorIndex int, rawWords []string) *CommandLine {
-	return (&CommandLine{unescape: unescape}).Replace(cursorIndex, rawWords)
+func newCommandLine(env *compromise.Environment, unescape func(string) string, cursorIndex int, rawWords []string) *CommandLine {
+	return (&CommandLine{env: env, unescape: unescape}).Replace(cursorIndex, rawWords)
 }
 
 func (c *CommandLine) Replace(cursorIndex int, rawWords []string) *CommandLine {
@@ -47,6 +57,34 @@ func (c *CommandLine) Replace(cursorIndex int, rawWords []string) *CommandLine {
 	return c
 }
 
+// SplitWord splits the word at pc into two words, for flags that have a value or other flags in
+// the same word. The first word is the first headLen bytes, and the second word is tailPrefix
+// followed by the rest after skipping skip bytes, e.g. "--flag=VALUE" is split into "--flag" and
+// "VALUE" with (6, 1, ""), and "-la" is split into "-l" and "-a" with (2, 0, "-").
+func (c *CommandLine) SplitWord(headLen, skip int, tailPrefix string) {
+	word := c.words[c.pc]
+	head, tail := word[:headLen], tailPrefix+word[headLen+skip:]
+
+	// Split the raw word in the same way, unless the flag part is escaped.
+	raw := c.rawWords[c.pc]
+	rawHead, rawTail := head, tail
+	if strings.HasPrefix(raw, word[:headLen+skip]) {
+		rawHead, rawTail = raw[:headLen], tailPrefix+raw[headLen+skip:]
+	}
+
+	c.words = splice(c.words, c.pc, head, tail)
+	c.rawWords = splice(c.rawWords, c.pc, rawHead, rawTail)
+	c.cursorIndex++
+}
+
+// splice returns a copy of words with the word at index replaced with given words.
+func splice(words []string, index int, replacements ...string) []string {
+	ret := make([]string, 0, len(words)+len(replacements)-1)
+	ret = append(ret, words[:index]...)
+	ret = append(ret, replacements...)
+	return append(ret, words[index+1:]...)
+}
+
 // CursorIndex returns the index of the word at the cursor.
 func (c *CommandLine) CursorIndex() int {
 	return c.cursorIndex
@@ -57,6 +95,11 @@ func (c *CommandLine) RawWords() []string {
 	return c.rawWords
 }
 
+// Return unescaped words.
+func (c *CommandLine) Words() []string {
+	return c.words
+}
+
 // Pc returns the current pc (program counter).
 func (c *CommandLine) Pc() int {
 	return c.pc
@@ -77,6 +120,24 @@ func (c *CommandLine) AtCursor() bool {
 	return c.pc == c.cursorIndex
 }
 
+// Matcher returns the Matcher that candidates are matched with.
+func (c *CommandLine) Matcher() compromise.Matcher {
+	if c.matcher == nil {
+		return compromise.DefaultMatcher
+	}
+	return c.matcher
+}
+
+// SetMatcher sets the Matcher that candidates are matched with.
+func (c *CommandLine) SetMatcher(m compromise.Matcher) {
+	c.matcher = m
+}
+
+// Environment returns the environment of the shell.
+func (c *CommandLine) Environment() *compromise.Environment {
+	return c.env
+}
+
 // AfterCursor returns whether pc is after the cursor index.
 func (c *CommandLine) AfterCursor() bool {
 	return c.pc > c.cursorIndex
@@ -2,8 +2,11 @@ package adapters
 
 import (
 	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compclient"
 	"github.com/omakoto/compromise/src/compromise/compenv"
 	"github.com/omakoto/go-common/src/common"
+	"os/exec"
+	"path/filepath"
 )
 
 func getUniqueName(command string) string {
@@ -18,6 +21,22 @@ type stringWriter interface {
 	WriteString(s string) (n int, err error)
 }
 
+// AddGroupString writes a group label of a candidate, if any.
+func AddGroupString(group string, bwr stringWriter) {
+	if len(group) == 0 {
+		return
+	}
+	if compenv.UseColor {
+		bwr.WriteString(compenv.GroupStartEscape)
+	}
+	bwr.WriteString("[")
+	bwr.WriteString(group)
+	bwr.WriteString("]")
+	if compenv.UseColor {
+		bwr.WriteString(compenv.GroupEndEscape)
+	}
+}
+
 func AddDisplayString(c compromise.Candidate, bwr stringWriter) {
 	if len(c.Value()) == 0 {
 		bwr.WriteString("<ANY>")
@@ -35,3 +54,19 @@ func AddDisplayString(c compromise.Candidate, bwr stringWriter) {
 		}
 	}
 }
+
+// getInvocation returns the command that an install script runs to perform completion. It's
+// usually the current executable, but when the completion daemon is enabled and the client is
+// installed, the executable is passed to the client, which is faster to start.
+func getInvocation() []string {
+	path, err := filepath.Abs(common.MustGetExecutable())
+	common.Checkf(err, "Abs failed")
+	if compenv.UseDaemon {
+		if client, err := exec.LookPath(compclient.ClientName); err == nil {
+			if client, err = filepath.Abs(client); err == nil {
+				return []string{client, path}
+			}
+		}
+	}
+	return []string{path}
+}
@@ -0,0 +1,172 @@
+package adapters
+
+import (
+	"bufio"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/go-common/src/common"
+	"github.com/omakoto/go-common/src/shell"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+/*
+fishAdapter is an interface to Fish.
+
+See:
+https://fishshell.com/docs/current/cmds/complete.html
+https://fishshell.com/docs/current/cmds/commandline.html
+
+Fish escapes candidates by itself when inserting them, and decides whether to add a space
+after a candidate on its own (no space is added after a candidate ending with "/", "=", etc),
+so Raw() and Continues() are mostly up to fish.
+*/
+type fishAdapter struct {
+	in  io.Reader
+	out *bufio.Writer
+	env *compromise.Environment
+
+	candidates []compromise.Candidate
+}
+
+var _ ShellAdapter = ((*fishAdapter)(nil))
+
+func newFishAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) *fishAdapter {
+	a := &fishAdapter{in: rd, out: bufio.NewWriter(wr), env: env}
+
+	return a
+}
+
+// fishParameters is a template parameter
+type fishParameters struct {
+	FuncName     string
+	Invocation   []string
+	CommandNames []string
+	Spec         string
+}
+
+func (p *fishParameters) Escape(arg string) string {
+	return fishEscape(arg)
+}
+
+// fishEscape quotes a string with single quotes, in which only \ and ' need escaping in fish.
+func fishEscape(arg string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(arg) + "'"
+}
+
+func (a *fishAdapter) Install(targetCommandNames []string, spec string) {
+	p := fishParameters{}
+	p.FuncName = getFuncName(targetCommandNames[0])
+	p.Invocation = getInvocation()
+	p.CommandNames = targetCommandNames
+	p.Spec = spec
+
+	// Fish has no heredoc, so the spec is embedded as a single quoted string.
+	tmpl, err := template.New("t").Parse(`
+# Completion script generated by Compromise (https://github.com/omakoto/compromise)
+
+function {{.FuncName}}_spec
+  printf '%s\n' {{.Escape .Spec}}
+end
+
+# Actual completion function.
+function {{.FuncName}}
+  set -l tokens (commandline -opc)
+  set -l current (commandline -ct)
+  {{range .Invocation}}{{$.Escape .}} {{end}}--` + InvokeOption + ` ({{.FuncName}}_spec | psub) (count $tokens) $tokens "$current"
+end
+{{range $command := .CommandNames}}
+complete -c {{$.Escape $command}} -e
+complete -c {{$.Escape $command}} -f -a '({{$.FuncName}})'
+{{- end}}
+
+if test "$COMPROMISE_QUIET" != 1
+  echo "Installed completion:"{{range $command := .CommandNames}} {{$.Escape $command}}{{end}} 1>&2
+end
+`)
+
+	common.Check(err, "parse failed")
+	common.Check(tmpl.Execute(a.out, &p), "execute failed")
+}
+
+func (a *fishAdapter) HasMenuCompletion() bool {
+	return true
+}
+
+// Whether to use fzf.
+func (a *fishAdapter) UseFzf() bool {
+	return compenv.UseFzf == 1
+}
+
+func (a *fishAdapter) Escape(arg string) string {
+	return shell.Escape(arg)
+}
+
+func (a *fishAdapter) Unescape(arg string) string {
+	return shell.Unescape(arg)
+}
+
+func (a *fishAdapter) DefaultMaxCandidates() int {
+	return 10000
+}
+
+func (a *fishAdapter) DefaultMaxHelps() int {
+	return 0 // Fish shows help by itself.
+}
+
+func (a *fishAdapter) GetCommandLine(args []string) *CommandLine {
+	// args[0] is the number of tokens before the cursor (i.e. the cursor index), and
+	// the rest is the tokens followed by the current token.
+	cursorIndex, err := strconv.Atoi(args[0])
+	common.CheckPanic(err, "Atoi failed") // This is an internal error, so use panic.
+	rawWords := args[1:]
+
+	// "commandline -opc" already unescapes the tokens, so only the current token, which
+	// "commandline -ct" returns as typed, needs to be unescaped.
+	ret := newCommandLine(a.env, func(s string) string { return s }, cursorIndex, rawWords)
+	ret.words[cursorIndex] = a.Unescape(rawWords[cursorIndex])
+	return ret
+}
+
+func (a *fishAdapter) StartCompletion(commandLine *CommandLine) {
+	// fish doesn't need it
+}
+
+func (a *fishAdapter) MaybeOverrideCandidates(commandLine *CommandLine) []compromise.Candidate {
+	return nil // fish doesn't need it
+}
+
+func (a *fishAdapter) AddCandidate(c compromise.Candidate) {
+	if len(a.candidates) < compenv.MaxCandidates {
+		a.candidates = append(a.candidates, c)
+	}
+}
+
+var fishSanitizer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func (a *fishAdapter) printCandidate(c compromise.Candidate) bool {
+	// Dump a candidate to stdout in the "VALUE<TAB>DESCRIPTION" form.
+	val := c.Value()
+	if len(val) == 0 {
+		return false
+	}
+	a.out.WriteString(fishSanitizer.Replace(val))
+	if len(c.Help()) > 0 {
+		a.out.WriteByte('\t')
+		a.out.WriteString(fishSanitizer.Replace(c.Help()))
+	}
+	a.out.WriteByte('\n')
+	return true
+}
+
+func (a *fishAdapter) EndCompletion() {
+	for _, c := range a.candidates {
+		a.printCandidate(c)
+	}
+}
+
+func (a *fishAdapter) Finish() {
+	a.out.Flush()
+}
@@ -0,0 +1,206 @@
+package adapters
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/go-common/src/common"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+/*
+nushellAdapter is an interface to Nushell's external completer.
+
+See:
+https://www.nushell.sh/cookbook/external_completers.html
+
+Nushell has a single, global external completer, which receives all the words ("spans") on the
+command line and returns a JSON list of {value, description} records. The install script
+chains to the previously installed completer for commands that aren't ours.
+
+The spec is passed to the completer via stdin, because Nushell has no process substitution.
+*/
+type nushellAdapter struct {
+	in  io.Reader
+	out *bufio.Writer
+	env *compromise.Environment
+
+	candidates []compromise.Candidate
+}
+
+var _ ShellAdapter = ((*nushellAdapter)(nil))
+
+func newNushellAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) *nushellAdapter {
+	a := &nushellAdapter{in: rd, out: bufio.NewWriter(wr), env: env}
+
+	return a
+}
+
+// nushellParameters is a template parameter
+type nushellParameters struct {
+	VarName      string
+	Invocation   []string
+	CommandNames []string
+	Spec         string
+}
+
+func (p *nushellParameters) Escape(arg string) string {
+	return nushellQuote(arg)
+}
+
+// RawString returns arg as a Nushell raw string literal (r#'...'#).
+func (p *nushellParameters) RawString(arg string) string {
+	hashes := "#"
+	for strings.Contains(arg, "'"+hashes) {
+		hashes += "#"
+	}
+	return "r" + hashes + "'" + arg + "'" + hashes
+}
+
+// nushellQuote quotes a string with double quotes.
+func nushellQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func (a *nushellAdapter) Install(targetCommandNames []string, spec string) {
+	p := nushellParameters{}
+	// Nushell variable names can't contain "%".
+	p.VarName = strings.Replace("__compromise_"+getUniqueName(targetCommandNames[0]), "%", "_", -1)
+	p.Invocation = getInvocation()
+	p.CommandNames = targetCommandNames
+	p.Spec = spec
+
+	tmpl, err := template.New("t").Parse(`
+# Completion script generated by Compromise (https://github.com/omakoto/compromise)
+#
+# Nushell can only "source" a file, so save this script to a file and source it from config.nu.
+
+$env.config.completions.external.enable = true
+
+let {{.VarName}}_prev = $env.config.completions.external.completer?
+
+$env.config.completions.external.completer = {|spans|
+  if ($spans.0 in [{{range $command := .CommandNames}} {{$.Escape $command}}{{end}} ]) {
+    {{.RawString .Spec}} | ^{{range .Invocation}}{{$.Escape .}} {{end}}--` + InvokeOption + ` - (($spans | length) - 1) ...$spans | from json
+  } else if ${{.VarName}}_prev != null {
+    do ${{.VarName}}_prev $spans
+  }
+}
+
+if ($env.COMPROMISE_QUIET? | default "0") != "1" {
+  print -e ("Installed completion:"{{range $command := .CommandNames}} + " " + {{$.Escape $command}}{{end}})
+}
+`)
+
+	common.Check(err, "parse failed")
+	common.Check(tmpl.Execute(a.out, &p), "execute failed")
+}
+
+func (a *nushellAdapter) HasMenuCompletion() bool {
+	return true
+}
+
+// Whether to use fzf.
+func (a *nushellAdapter) UseFzf() bool {
+	return false // The completer's stdout is parsed as JSON, so we can't start fzf.
+}
+
+// Escape quotes arg in a way Nushell understands, only when necessary.
+func (a *nushellAdapter) Escape(arg string) string {
+	if !strings.ContainsAny(arg, " \t\r\n'\"`|;()[]{}$#") {
+		return arg
+	}
+	if !strings.ContainsRune(arg, '`') {
+		return "`" + arg + "`"
+	}
+	return nushellQuote(arg)
+}
+
+// Unescape removes quotes from a span.
+func (a *nushellAdapter) Unescape(arg string) string {
+	if len(arg) < 2 || arg[0] != arg[len(arg)-1] {
+		return arg
+	}
+	switch arg[0] {
+	case '\'', '`':
+		return arg[1 : len(arg)-1]
+	case '"':
+		if s, err := strconv.Unquote(arg); err == nil {
+			return s
+		}
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+func (a *nushellAdapter) DefaultMaxCandidates() int {
+	return 10000
+}
+
+func (a *nushellAdapter) DefaultMaxHelps() int {
+	return 0 // Nushell shows descriptions by itself.
+}
+
+func (a *nushellAdapter) GetCommandLine(args []string) *CommandLine {
+	cursorIndex, err := strconv.Atoi(args[0])
+	common.CheckPanic(err, "Atoi failed") // This is an internal error, so use panic.
+	rawWords := args[1:]
+
+	return newCommandLine(a.env, a.Unescape, cursorIndex, rawWords)
+}
+
+func (a *nushellAdapter) StartCompletion(commandLine *CommandLine) {
+	// nushell doesn't need it
+}
+
+func (a *nushellAdapter) MaybeOverrideCandidates(commandLine *CommandLine) []compromise.Candidate {
+	return nil // nushell doesn't need it
+}
+
+func (a *nushellAdapter) AddCandidate(c compromise.Candidate) {
+	if len(a.candidates) < compenv.MaxCandidates {
+		a.candidates = append(a.candidates, c)
+	}
+}
+
+// nushellSuggestion is a record returned to Nushell.
+type nushellSuggestion struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+func (a *nushellAdapter) EndCompletion() {
+	ret := make([]nushellSuggestion, 0, len(a.candidates))
+	for _, c := range a.candidates {
+		val := c.Value()
+		if len(val) == 0 {
+			continue
+		}
+		if !c.Raw() {
+			val = a.Escape(val)
+		}
+		// Nushell never appends a space after a candidate from an external completer.
+		if !c.Continues() {
+			val += " "
+		}
+		ret = append(ret, nushellSuggestion{val, c.Help()})
+	}
+	if len(ret) == 0 {
+		// An empty list would stop Nushell from falling back to its own file completion.
+		a.out.WriteString("null\n")
+		return
+	}
+	data, err := json.Marshal(ret)
+	common.CheckPanice(err)
+
+	a.out.Write(data)
+	a.out.WriteByte('\n')
+}
+
+func (a *nushellAdapter) Finish() {
+	a.out.Flush()
+}
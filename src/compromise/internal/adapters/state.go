@@ -0,0 +1,53 @@
+package adapters
+
+import "github.com/omakoto/compromise/src/compromise/compdebug"
+
+// state is a key/value store for a single completion, which can be rolled back to an earlier
+// point, e.g. when a switch branch doesn't match.
+type state struct {
+	values map[string]string
+
+	// Changes to undo, in the order they're made.
+	undo []stateChange
+}
+
+type stateChange struct {
+	key, value string
+	existed    bool
+}
+
+// Get returns a value stored with Set, or "" if not set.
+func (c *CommandLine) Get(key string) string {
+	return c.state.values[key]
+}
+
+// Set stores a value in the state of the current completion.
+func (c *CommandLine) Set(key, value string) {
+	s := &c.state
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	old, existed := s.values[key]
+	s.undo = append(s.undo, stateChange{key, old, existed})
+	s.values[key] = value
+	compdebug.Debugf("  Set %q to %q\n", key, value)
+}
+
+// StateMark returns the current point of the state, which RollbackState takes.
+func (c *CommandLine) StateMark() int {
+	return len(c.state.undo)
+}
+
+// RollbackState discards the changes to the state made after a point returned by StateMark.
+func (c *CommandLine) RollbackState(mark int) {
+	s := &c.state
+	for i := len(s.undo) - 1; i >= mark; i-- {
+		ch := s.undo[i]
+		if ch.existed {
+			s.values[ch.key] = ch.value
+		} else {
+			delete(s.values, ch.key)
+		}
+	}
+	s.undo = s.undo[:mark]
+}
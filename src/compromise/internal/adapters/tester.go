@@ -12,14 +12,15 @@ import (
 type testerAdapter struct {
 	in  io.Reader
 	out *bufio.Writer
+	env *compromise.Environment
 
 	candidates []compromise.Candidate
 }
 
 var _ ShellAdapter = ((*testerAdapter)(nil))
 
-func newTesterAdapter(rd io.Reader, wr io.Writer) *testerAdapter {
-	a := &testerAdapter{in: rd, out: bufio.NewWriter(wr)}
+func newTesterAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) *testerAdapter {
+	a := &testerAdapter{in: rd, out: bufio.NewWriter(wr), env: env}
 
 	return a
 }
@@ -54,7 +55,7 @@ func (a *testerAdapter) Unescape(arg string) string {
 }
 
 func (a *testerAdapter) GetCommandLine(args []string) *CommandLine {
-	return newCommandLine(a.Unescape, len(args)-1, args)
+	return newCommandLine(a.env, a.Unescape, len(args)-1, args)
 }
 
 func (a *testerAdapter) StartCompletion(commandLine *CommandLine) {
@@ -86,6 +87,10 @@ func (a *testerAdapter) EndCompletion() {
 		if v.Continues() {
 			a.out.WriteString("+")
 		}
+		if v.Group() != "" {
+			a.out.WriteString(" @")
+			a.out.WriteString(fmt.Sprintf("%q", v.Group()))
+		}
 		if v.Help() != "" {
 			a.out.WriteString(" #")
 			a.out.WriteString(fmt.Sprintf("%q", v.Help()))
@@ -6,10 +6,9 @@ import (
 	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compenv"
 	"github.com/omakoto/go-common/src/common"
-	"github.com/omakoto/go-common/src/fileutils"
 	"github.com/omakoto/go-common/src/shell"
+	"github.com/ungerik/go-dry"
 	"io"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
@@ -32,25 +31,26 @@ NOT FULLY TESTED YET.
 type zshAdapter struct {
 	in  io.Reader
 	out *bufio.Writer
+	env *compromise.Environment
 
 	candidates []compromise.Candidate
 }
 
 var _ ShellAdapter = ((*zshAdapter)(nil))
 
-func newZshAdapter(rd io.Reader, wr io.Writer) *zshAdapter {
-	a := &zshAdapter{in: rd, out: bufio.NewWriter(wr)}
+func newZshAdapter(rd io.Reader, wr io.Writer, env *compromise.Environment) *zshAdapter {
+	a := &zshAdapter{in: rd, out: bufio.NewWriter(wr), env: env}
 
 	return a
 }
 
 // zshParameters is a template parameter
 type zshParameters struct {
-	FuncName       string
-	ExecutableName string
-	CommandNames   []string
-	Spec           string
-	SkipZshBind    string
+	FuncName     string
+	Invocation   []string
+	CommandNames []string
+	Spec         string
+	SkipZshBind  string
 
 	EvalStr string
 }
@@ -66,9 +66,7 @@ func (p *zshParameters) Unescape(arg string) string {
 func (a *zshAdapter) Install(targetCommandNames []string, spec string) {
 	p := zshParameters{}
 	p.FuncName = getFuncName(targetCommandNames[0])
-	path, err := filepath.Abs(common.MustGetExecutable())
-	common.Checkf(err, "Abs failed")
-	p.ExecutableName = path
+	p.Invocation = getInvocation()
 	p.CommandNames = targetCommandNames
 	p.Spec = spec
 	p.SkipZshBind = "0"
@@ -76,13 +74,13 @@ func (a *zshAdapter) Install(targetCommandNames []string, spec string) {
 		p.SkipZshBind = "1"
 	}
 
-	command := []string{
-		shell.Escape(p.ExecutableName),
-		"--" + InvokeOption,
-		"<(" + p.FuncName + "_spec)",
+	command := dry.StringMap(shell.Escape, p.Invocation)
+	command = append(command,
+		"--"+InvokeOption,
+		"<("+p.FuncName+"_spec)",
 		`"$(( $CURRENT - 1 ))"`,
 		`"${words[@]}"`,
-	}
+	)
 	p.EvalStr = strings.Join(command, " ")
 
 	tmpl, err := template.New("t").Parse(`
@@ -155,7 +153,7 @@ func (a *zshAdapter) GetCommandLine(args []string) *CommandLine {
 	common.CheckPanic(err, "Atoi failed") // This is an internal error, so use panic.
 	rawWords := args[1:]
 
-	return newCommandLine(a.Unescape, cursorIndex, rawWords)
+	return newCommandLine(a.env, a.Unescape, cursorIndex, rawWords)
 }
 
 func (a *zshAdapter) StartCompletion(commandLine *CommandLine) {
@@ -172,52 +170,147 @@ func (a *zshAdapter) AddCandidate(c compromise.Candidate) {
 	}
 }
 
-func (a *zshAdapter) printCandidate(c compromise.Candidate) bool {
-	// Dump a candidate to stdout.
+// zshInsertString returns a string to be inserted to the command line for a candidate.
+func zshInsertString(c compromise.Candidate) string {
 	val := c.Value()
-	if len(val) == 0 {
-		return false
+	if !c.Raw() {
+		val = shell.EscapeNoQuotes(val)
 	}
-
-	val = shell.EscapeNoQuotes(val)
 	if !c.Continues() {
 		val += " "
 	}
-	if !c.Raw() {
-		val = shell.EscapeNoQuotes(val)
+	return val
+}
+
+// quote escapes arg as a single array element, which may be empty.
+func (a *zshAdapter) quote(arg string) string {
+	if len(arg) == 0 {
+		return "''"
+	}
+	return a.Escape(arg)
+}
+
+// printBatch prints a script to add a batch of candidates with a single compadd, with
+// descriptions and a group, which zsh renders with the "format", "list-colors",
+// "list-separator", etc, zstyles.
+func (a *zshAdapter) printBatch(tag, descr string, candidates []compromise.Candidate, files bool) {
+	if len(candidates) == 0 {
+		return
+	}
+
+	// Longest value, to align descriptions.
+	width := 0
+	hasHelp := false
+	for _, c := range candidates {
+		if len(c.Help()) > 0 {
+			hasHelp = true
+		}
+		if len(c.Value()) > width {
+			width = len(c.Value())
+		}
+	}
+	if !hasHelp {
+		width = 0
+	}
+
+	values := make([]string, 0, len(candidates))
+	displays := make([]string, 0, len(candidates))
+	helps := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		values = append(values, a.quote(zshInsertString(c)))
+		displays = append(displays, a.quote(fmt.Sprintf("%-*s", width, c.Value())))
+		helps = append(helps, a.quote(c.Help()))
 	}
 
 	// -S '' tells zsh not to add a space afterward. (because we do it by ourselves.)
 	// -Q prevents zsh from quoting metacharacters in the results, which we do too.
 	// -f treats the result as filenames.
 	// -U suppress filtering by zsh
+	// -l shows one candidate per line, so descriptions line up.
+	opts := "-S '' -Q -U"
+	if files {
+		opts += " -f"
+	}
+	if hasHelp {
+		opts += " -l"
+	}
 
-	fileopt := ""
-	if fileutils.FileExists(c.Value()) {
-		fileopt = "-f"
+	a.out.WriteString("() {\n")
+	a.out.WriteString("  local -a values displays helps expl\n")
+	a.out.WriteString("  local sep i\n")
+	a.out.WriteString("  values=(" + strings.Join(values, " ") + ")\n")
+	a.out.WriteString("  displays=(" + strings.Join(displays, " ") + ")\n")
+	if hasHelp {
+		a.out.WriteString("  helps=(" + strings.Join(helps, " ") + ")\n")
+		a.out.WriteString("  zstyle -s \":completion:${curcontext}:" + tag + "\" list-separator sep || sep=--\n")
+		a.out.WriteString("  for (( i = 1; i <= $#displays; i++ )); do\n")
+		a.out.WriteString("    [[ -n $helps[i] ]] && displays[i]=\"$displays[i] $sep $helps[i]\"\n")
+		a.out.WriteString("  done\n")
 	}
+	// -V: we've already sorted the candidates.
+	a.out.WriteString("  _description -V " + tag + " expl " + a.Escape(descr) + "\n")
+	a.out.WriteString("  compadd \"${expl[@]}\" " + opts + " -d displays -- \"${values[@]}\"\n")
+	a.out.WriteString("}\n")
+}
 
-	desc := c.Value()
-	if len(c.Help()) > 0 {
-		descPadLen := (len(desc)/10 + 1) * 10
-		if descPadLen < 20 {
-			descPadLen = 20
-		}
-		desc = desc + strings.Repeat(" ", (descPadLen-len(desc))) + ": " + c.Help()
+// printMessages prints a script to show help of candidates that have no values, e.g. "@any".
+func (a *zshAdapter) printMessages(candidates []compromise.Candidate) {
+	for _, c := range candidates {
+		a.out.WriteString("_message -e values " + a.Escape(c.Help()) + "\n")
 	}
+}
 
-	a.out.WriteString(fmt.Sprintf(`
-		COMPROMISE_D=(%s)
-		compadd -S '' -Q -U %s -d COMPROMISE_D -- %s
-	`, a.Escape(desc), fileopt, val))
+// zshTag converts a group name into a tag name, which is used in zstyle contexts.
+func zshTag(group string) string {
+	return strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, group)
+}
 
-	a.out.WriteByte('\n')
-	return true
+// zshBatch is a set of candidates that are added with a single compadd.
+type zshBatch struct {
+	group      string
+	files      bool
+	candidates []compromise.Candidate
 }
 
 func (a *zshAdapter) EndCompletion() {
+	// Split the candidates into batches, one for each group, in the order they first appear.
+	var batches []*zshBatch
+	var messages []compromise.Candidate
 	for _, c := range a.candidates {
-		a.printCandidate(c)
+		if len(c.Value()) == 0 {
+			if len(c.Help()) > 0 {
+				messages = append(messages, c)
+			}
+			continue
+		}
+		var batch *zshBatch
+		for _, b := range batches {
+			if b.group == c.Group() && b.files == c.File() {
+				batch = b
+				break
+			}
+		}
+		if batch == nil {
+			batch = &zshBatch{group: c.Group(), files: c.File()}
+			batches = append(batches, batch)
+		}
+		batch.candidates = append(batch.candidates, c)
+	}
+	a.printMessages(messages)
+	for _, b := range batches {
+		group := b.group
+		if len(group) == 0 {
+			group = "values"
+			if b.files {
+				group = "files"
+			}
+		}
+		a.printBatch(zshTag(group), group, b.candidates, b.files)
 	}
 }
 
@@ -29,15 +29,33 @@ type Engine struct {
 
 	candidates []compromise.Candidate
 
+	// Group set by the last @group, which will be set to collected candidates.
+	group string
+
+	// Branches matched in the running @switchloop's, innermost last.
+	loops []*loopState
+
+	// Parts split off from the word at the cursor by @joined and @bundle, outermost first.
+	cursorPrefixes []cursorPrefix
+
+	// Index of the last value split off by @joined, or -1.
+	joinedValuePc int
+
 	directives *compromise.Directives
+
+	// Matcher selected by the directives or $COMPROMISE_MATCHER.
+	matcher compromise.Matcher
 }
 
 func NewEngine(adapter adapters.ShellAdapter, commandLine *adapters.CommandLine, d *compromise.Directives) *Engine {
 	e := &Engine{
-		adapter:     adapter,
-		commandLine: commandLine,
-		directives:  d,
+		adapter:       adapter,
+		commandLine:   commandLine,
+		directives:    d,
+		matcher:       compromise.SelectMatcher(d),
+		joinedValuePc: -1,
 	}
+	commandLine.SetMatcher(e.matcher)
 	compdebug.Dump("CommandLine=", commandLine)
 	return e
 }
@@ -50,6 +68,19 @@ func (e *Engine) ParseSpec(spec string) {
 	e.astRoot = ast
 }
 
+// SetAST sets an already parsed spec, instead of calling ParseSpec. Visit states in the tree
+// will be reset.
+func (e *Engine) SetAST(ast *compast.Node) {
+	ast.ResetVisitStates()
+	e.astRoot = ast
+}
+
+// NeedsInteractive returns whether Run would launch an interactive selector (i.e. fzf), which
+// needs the terminal.
+func (e *Engine) NeedsInteractive() bool {
+	return e.adapter.UseFzf() && compstore.Load(e.commandLine.Environment()).IsDoublePress
+}
+
 func (e *Engine) Run() {
 	compdebug.Debugf("Run() start\n")
 
@@ -57,7 +88,7 @@ func (e *Engine) Run() {
 	e.adapter.StartCompletion(e.commandLine)
 	defer e.adapter.EndCompletion()
 
-	store := compstore.Load()
+	store := compstore.Load(e.commandLine.Environment())
 	cacheAge := store.LastCompletionAge()
 	compdebug.Debugf("Cache age: %v\n", cacheAge)
 	if store.NumConsecutiveInvocations > 1 && cacheAge <= compenv.CacheTimeout {
@@ -88,12 +119,14 @@ func (e *Engine) Run() {
 		}
 
 		// Sort the result.
-		sort.Slice(e.candidates, func(i, j int) bool {
-			return e.candidates[i].Value() < e.candidates[j].Value()
-		})
+		var weights map[string]float64
+		if compenv.Frecency && e.commandLine.CursorIndex() > 0 {
+			weights = compstore.HistoryWeights(e.commandLine.Environment(), e.commandLine.Command(), e.commandLine.WordAtCursor(-1))
+		}
+		sortCandidates(e.candidates, weights)
 
 		// Cache the candidates.
-		compstore.CacheCandidates(e.candidates)
+		compstore.CacheCandidates(e.commandLine.Environment(), e.candidates)
 	}
 
 	if len(e.candidates) == 0 {
@@ -101,7 +134,7 @@ func (e *Engine) Run() {
 	}
 
 	// Maybe try FZF.
-	if e.adapter.UseFzf() && compstore.Load().IsDoublePress {
+	if e.NeedsInteractive() {
 		compdebug.Debug("Trying fzf\n")
 		fzf := selectors.NewFzfSelector()
 		selected, err := fzf.Select(e.commandLine.WordAtCursor(0), e.candidates)
@@ -126,13 +159,51 @@ func (e *Engine) Run() {
 	}
 }
 
+// sortCandidates sorts candidates by score, weight (frecency) and then value, but keeps groups
+// together in the order they first appear.
+func sortCandidates(candidates []compromise.Candidate, weights map[string]float64) {
+	groupOrder := make(map[string]int)
+	for _, c := range candidates {
+		if _, ok := groupOrder[c.Group()]; !ok {
+			groupOrder[c.Group()] = len(groupOrder)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		gi, gj := groupOrder[candidates[i].Group()], groupOrder[candidates[j].Group()]
+		if gi != gj {
+			return gi < gj
+		}
+		si, sj := candidates[i].Score(), candidates[j].Score()
+		if si != sj {
+			return si > sj
+		}
+		wi, wj := weights[candidates[i].Value()], weights[candidates[j].Value()]
+		if wi != wj {
+			return wi > wj
+		}
+		return candidates[i].Value() < candidates[j].Value()
+	})
+}
+
+// copyCandidate returns a copy of a candidate, so the group and the score can be set without
+// changing the candidate that a function returned, which may be reused in later calls.
+func copyCandidate(c compromise.Candidate) compromise.Candidate {
+	return compromise.NewCandidate().SetValue(c.Value()).SetRaw(c.Raw()).SetHidden(c.Hidden()).
+		SetContinues(c.Continues()).SetForce(c.Force()).SetHelp(c.Help()).SetFile(c.File()).
+		SetGroup(c.Group()).SetScore(c.Score())
+}
+
 func (e *Engine) addCandidates(candidates ...compromise.Candidate) {
 	w := e.commandLine.WordAtCursor(0)
 	for _, c := range candidates {
+		c = copyCandidate(c)
+		if len(c.Group()) == 0 && len(e.group) > 0 {
+			c.SetGroup(e.group)
+		}
 		compdebug.Debugf("  -> Candidate: %v", c)
-		if c.Matches(w) {
+		if score, ok := c.MatchScore(e.matcher, w); ok && e.prefixCandidate(c) {
 			compdebug.Debug(" [Matched]")
-			e.candidates = append(e.candidates, c)
+			e.candidates = append(e.candidates, c.SetScore(score))
 		}
 		compdebug.Debug("\n")
 	}
@@ -154,6 +225,12 @@ func (e *Engine) execute() {
 	start := e.astRoot.GetStartNodeForCommand(e.commandLine.Command())
 	e.commandLine.SetPc(1)
 
+	// Words may be split by @joined and @bundle. Restore them for the shell adapter.
+	original := *e.commandLine
+	defer func() {
+		*e.commandLine = original
+	}()
+
 	f := doWithFlowControl(nil, func() {
 		m := false
 		e.executeNode(start, false, &m)
@@ -180,6 +257,12 @@ func (e *Engine) executeNode(n *compast.Node, inSwitch bool, matched *bool) {
 	compdebug.Indent()
 	defer compdebug.Unindent()
 
+	// @group only affects the following nodes in the same block.
+	lastGroup := e.group
+	defer func() {
+		e.group = lastGroup
+	}()
+
 	cl := e.commandLine
 	for ; !cl.AfterCursor() && n != nil; n = n.Next() {
 		compdebug.Debugf("[#%d] At %q (%d/%d) : executing %s (in-switch=%v)\n", id, cl.RawWordAt(0), cl.Pc(), cl.CursorIndex(), n, inSwitch)
@@ -188,11 +271,21 @@ func (e *Engine) executeNode(n *compast.Node, inSwitch bool, matched *bool) {
 
 		m := false
 		collecting := e.collecting()
+		stateMark := cl.StateMark()
 
 		if n.NodeType() == compast.NodeCommand {
 			// Just skip and move to next. Don't advance PC.
 			continue
 		}
+		if n.NodeType() == compast.NodeGroup {
+			// Set the group for the following nodes. Don't advance PC.
+			e.group = n.GroupName()
+			continue
+		}
+		if inSwitch && collecting && e.excluded(n) {
+			compdebug.Debug("[next: in switch and already used]\n")
+			continue
+		}
 
 		utils.DoAndEnsure(func() {
 			switch n.NodeType() {
@@ -213,6 +306,10 @@ func (e *Engine) executeNode(n *compast.Node, inSwitch bool, matched *bool) {
 				e.executeAny(n, inSwitch, &m)
 			case compast.NodeCandidate:
 				e.executeCandidate(n, inSwitch, &m)
+			case compast.NodeExec:
+				e.executeExec(n, inSwitch, &m)
+			case compast.NodeLines:
+				e.executeLines(n, inSwitch, &m)
 			case compast.NodeLiteral:
 				e.executeLiteral(n, inSwitch, &m)
 
@@ -220,6 +317,12 @@ func (e *Engine) executeNode(n *compast.Node, inSwitch bool, matched *bool) {
 				e.executeCall(n, inSwitch, &m)
 			case compast.NodeGoCall:
 				e.executeGoCall(n, &m)
+			case compast.NodeIf:
+				e.executeIf(n, inSwitch, &m)
+			case compast.NodeSet:
+				e.executeSet(n, &m)
+			case compast.NodeCapture:
+				e.executeCapture(n, &m)
 			default:
 				panic(fmt.Errorf("unexpected node %s", n))
 			}
@@ -227,10 +330,17 @@ func (e *Engine) executeNode(n *compast.Node, inSwitch bool, matched *bool) {
 			compdebug.Debugf("[#%d] result=%v\n", id, m)
 			if m {
 				*matched = true
+				if inSwitch && !collecting {
+					e.used(n)
+				}
 			}
 		})
 
 		if inSwitch {
+			// Values set by a branch don't leak to the other branches.
+			if collecting || !m {
+				cl.RollbackState(stateMark)
+			}
 			if collecting {
 				compdebug.Debug("[next: in switch and collecting]\n")
 				continue
@@ -254,7 +364,7 @@ func (e *Engine) executeCall(n *compast.Node, inSwitch bool, matched *bool) {
 	// @call: Jump to the target label, and then execute from it's next, until "return" is detected.
 
 	label := n.LabelWord()
-	target := e.astRoot.GetLabeledNode(label, n.Label()).Child()
+	target := n.GetLabeledNode(label, n.Label()).Child()
 
 	doWithFlowControl(catchReturn(), func() {
 		e.executeNode(target, inSwitch, matched)
@@ -278,10 +388,37 @@ func (e *Engine) executeCandidate(n *compast.Node, inSwitch bool, matched *bool)
 	}, matched)
 }
 
+func (e *Engine) executeExec(n *compast.Node, inSwitch bool, matched *bool) {
+	// @exec: lazily generate candidates from the output of a command. It matches any word.
+	e.executeCandidateNode(n, inSwitch, func() compromise.CandidateList {
+		return compfunc.BuildCandidateListFromExec(e.commandLine.Environment(), n.Args()[0], e.commandLine.WordAtCursor(0), n.HelpText())
+	}, matched)
+}
+
+func (e *Engine) executeLines(n *compast.Node, inSwitch bool, matched *bool) {
+	// @lines: lazily generate candidates from a file. It matches any word.
+	e.executeCandidateNode(n, inSwitch, func() compromise.CandidateList {
+		return compfunc.ReadCandidateListFromFileWithHelp(compfunc.ExpandPath(e.commandLine.Environment(), n.Args()[0]), n.HelpText())
+	}, matched)
+}
+
 func (e *Engine) executeLiteral(n *compast.Node, inSwitch bool, matched *bool) {
 	// Literal (such as -f, etc): Emits itself as a candidate. Only the exact same word will match.
+	if !inSwitch {
+		// In a switch, it's done for all the branches first.
+		e.splitFlag(n)
+	}
 	e.executeCandidateNode(n, inSwitch, func() compromise.CandidateList {
-		return compromise.StrictCandidates(n.AsCandidates()...)
+		cands := n.AsCandidates()
+		if n.Joined() && n.Child() != nil && e.collecting() {
+			// Complete long flags as "--flag=", so the value can be completed next.
+			for _, c := range cands {
+				if !compast.IsShortFlag(c.Value()) {
+					c.SetValue(c.Value() + "=").SetContinues(true)
+				}
+			}
+		}
+		return compromise.StrictCandidates(cands...)
 	}, matched)
 }
 
@@ -292,7 +429,7 @@ func (e *Engine) executeCandidateNode(n *compast.Node, inSwitch bool, genCands f
 
 	if e.collecting() {
 		compdebug.Debugf("  Collecting for %q\n", curWord)
-		e.addCandidates(genCands().GetCandidate(curWord)...)
+		e.addCandidates(compromise.GetCandidates(genCands(), e.matcher, curWord)...)
 		if !inSwitch {
 			panicFinish("cursor word consumed")
 		}
@@ -303,11 +440,21 @@ func (e *Engine) executeCandidateNode(n *compast.Node, inSwitch bool, genCands f
 	// Otherwise, if it has children, we need to go deeper.
 	if genCands().MatchesFully(curWord) {
 		e.advancePc("literal matched")
+		if n.NodeType() == compast.NodeLiteral {
+			e.skipOptionalJoinedValue(n)
+		}
 
 		// Note we don't need to propagate matched here. As long as this node matches,
 		// we still report "match" to the caller.
 		m := false
 		*matched = true
+
+		// The group doesn't apply to the children.
+		lastGroup := e.group
+		e.group = ""
+		defer func() {
+			e.group = lastGroup
+		}()
 		e.executeNode(n.Child(), false, &m)
 		return
 	}
@@ -324,6 +471,20 @@ func (e *Engine) executeGoCall(n *compast.Node, matched *bool) {
 	}
 }
 
+func (e *Engine) executeSet(n *compast.Node, matched *bool) {
+	// @set: Stores a value, which always matches without advancing PC.
+	*matched = true
+	args := n.Args()
+	e.commandLine.Set(args[0], args[1])
+}
+
+func (e *Engine) executeCapture(n *compast.Node, matched *bool) {
+	// @capture: Stores the word matched by the previous node, which always matches without
+	// advancing PC.
+	*matched = true
+	e.commandLine.Set(n.Args()[0], e.commandLine.WordAt(-1))
+}
+
 func (e *Engine) executeSwitchLoop(n *compast.Node, inSwitch, doSwitch bool, doLoop bool, matched *bool) {
 	myLabel := n.LabelWord()
 
@@ -338,6 +499,13 @@ func (e *Engine) executeSwitchLoop(n *compast.Node, inSwitch, doSwitch bool, doL
 		panic(compromise.NewSpecErrorf(n.SelfToken(), "%s must have at least one child", n.SelfToken()))
 	}
 
+	if doSwitch && doLoop {
+		e.loops = append(e.loops, newLoopState())
+		defer func() {
+			e.loops = e.loops[:len(e.loops)-1]
+		}()
+	}
+
 	for !e.commandLine.AfterCursor() {
 		// See if the current token is accepted by this loop.
 		if e.commandLine.BeforeCursor() && !n.PatternMatches(e.commandLine.WordAt(0)) {
@@ -346,6 +514,10 @@ func (e *Engine) executeSwitchLoop(n *compast.Node, inSwitch, doSwitch bool, doL
 			break
 		}
 
+		if doSwitch {
+			e.splitFlagInSwitch(n)
+		}
+
 		startPc := e.commandLine.Pc()
 		m := false
 		collecting := e.collecting()
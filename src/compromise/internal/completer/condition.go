@@ -0,0 +1,56 @@
+package compengine
+
+// @if conditions.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"os"
+	"regexp"
+	"strings"
+)
+
+func (e *Engine) executeIf(n *compast.Node, inSwitch bool, matched *bool) {
+	// @if: Runs the children as if they were in the parent, only when the condition holds.
+	if !e.conditionHolds(n) {
+		// In a switch, try the next branch. Otherwise, just skip the children.
+		*matched = !inSwitch
+		return
+	}
+	e.executeNode(n.Child(), inSwitch, matched)
+}
+
+func (e *Engine) conditionHolds(n *compast.Node) bool {
+	condition := n.Condition().Word
+	args := n.Args()
+
+	ret := false
+	switch strings.TrimPrefix(condition, "!") {
+	case "env":
+		ret = e.commandLine.Environment().Getenv(args[0]) != ""
+	case "file":
+		_, err := os.Stat(e.commandLine.Environment().Path(args[0]))
+		ret = err == nil
+	case "word":
+		// Any of the words before the current word.
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			panic(compromise.NewSpecErrorf(n.Condition(), "invalid regex %q", args[0]))
+		}
+		for i := 1; i < e.commandLine.Pc(); i++ {
+			if re.MatchString(e.commandLine.WordAtIndex(i)) {
+				ret = true
+				break
+			}
+		}
+	case "go":
+		ret = compfunc.InvokePredicate(args[0], e.commandLine, args[1:])
+	}
+	if strings.HasPrefix(condition, "!") {
+		ret = !ret
+	}
+	compdebug.Debugf("[if %s %v: %v]\n", condition, args, ret)
+	return ret
+}
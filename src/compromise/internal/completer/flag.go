@@ -0,0 +1,150 @@
+package compengine
+
+// Support for @joined and @bundle, which split words such as "--flag=VALUE", "-fVALUE" and "-la"
+// into separate words before matching them.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"strings"
+)
+
+// cursorPrefix is a part of the word at the cursor that was split off, which is added back to
+// the candidates for the rest of the word.
+type cursorPrefix struct {
+	prefix string
+
+	// Removed from candidates before adding the prefix, e.g. "-" for bundled short flags.
+	trim string
+}
+
+// apply adds the prefix to a candidate value, and returns false if the candidate can't follow the
+// prefix.
+func (p cursorPrefix) apply(value string) (string, bool) {
+	if p.trim != "" {
+		// Only short flags, possibly with a joined value, can follow bundled short flags.
+		if !strings.HasPrefix(value, "-") || strings.HasPrefix(value, "--") {
+			return "", false
+		}
+		value = strings.TrimPrefix(value, p.trim)
+	}
+	return p.prefix + value, true
+}
+
+// prefixCandidate adds the split off prefixes to a candidate for the word at the cursor.
+func (e *Engine) prefixCandidate(c compromise.Candidate) bool {
+	value := c.Value()
+	if value == "" {
+		// A help-only candidate, e.g. from @any, isn't a word to insert, so keep it as is.
+		return true
+	}
+	for i := len(e.cursorPrefixes) - 1; i >= 0; i-- {
+		var ok bool
+		if value, ok = e.cursorPrefixes[i].apply(value); !ok {
+			return false
+		}
+	}
+	c.SetValue(value)
+	return true
+}
+
+// switchLiterals returns the literals that can match the word at the start of a switch, including
+// ones in nested switches and called labels.
+func switchLiterals(n *compast.Node) []*compast.Node {
+	ret := make([]*compast.Node, 0)
+	visited := make(map[*compast.Node]bool)
+
+	var walk func(parent *compast.Node)
+	walk = func(parent *compast.Node) {
+		for c := parent.Child(); c != nil; c = c.Next() {
+			switch c.NodeType() {
+			case compast.NodeLiteral:
+				ret = append(ret, c)
+			case compast.NodeSwitch, compast.NodeIf:
+				walk(c)
+			case compast.NodeCall:
+				target := c.GetLabeledNode(c.LabelWord(), c.Label())
+				if !visited[target] {
+					visited[target] = true
+					walk(target)
+				}
+			}
+		}
+	}
+	walk(n)
+	return ret
+}
+
+// splitFlagInSwitch splits the current word if it has a joined or bundled flag of any of the
+// literals in a switch, unless any literal matches the whole word.
+func (e *Engine) splitFlagInSwitch(n *compast.Node) {
+	literals := switchLiterals(n)
+	word := e.commandLine.WordAt(0)
+	for _, l := range literals {
+		for _, c := range l.AsCandidates() {
+			if c.Value() == word {
+				return
+			}
+		}
+	}
+	for _, l := range literals {
+		if e.splitFlag(l) {
+			return
+		}
+	}
+}
+
+// splitFlag splits the current word if it has a joined or bundled flag of a literal, and returns
+// whether it did.
+func (e *Engine) splitFlag(n *compast.Node) bool {
+	if !n.Joined() && !n.Bundle() {
+		return false
+	}
+	cl := e.commandLine
+	word := cl.WordAt(0)
+	for _, c := range n.AsCandidates() {
+		flag := c.Value()
+		if !strings.HasPrefix(word, flag) || len(word) == len(flag) {
+			continue
+		}
+
+		atCursor := cl.AtCursor()
+		var p cursorPrefix
+		switch {
+		case n.Joined() && compast.IsShortFlag(flag):
+			cl.SplitWord(len(flag), 0, "")
+			p = cursorPrefix{prefix: flag}
+		case n.Joined() && word[len(flag)] == '=':
+			cl.SplitWord(len(flag), 1, "")
+			p = cursorPrefix{prefix: flag + "="}
+		case n.Bundle():
+			cl.SplitWord(len(flag), 0, "-")
+			p = cursorPrefix{prefix: flag, trim: "-"}
+		default:
+			continue
+		}
+		if n.Joined() {
+			e.joinedValuePc = cl.Pc() + 1
+		}
+		compdebug.Debugf("[split: %q into %q and %q]\n", word, cl.WordAt(0), cl.WordAt(1))
+		if atCursor {
+			e.cursorPrefixes = append(e.cursorPrefixes, p)
+		}
+		return true
+	}
+	return false
+}
+
+// skipOptionalJoinedValue skips the value split off from a matched literal flag with @joined but
+// no children, which takes an optional value only in the same word, e.g. "--color[=WHEN]".
+func (e *Engine) skipOptionalJoinedValue(n *compast.Node) {
+	if !n.Joined() || n.Child() != nil || e.commandLine.Pc() != e.joinedValuePc {
+		return
+	}
+	if e.collecting() {
+		// Nothing to complete for the value.
+		panicFinish("optional joined value at cursor")
+	}
+	e.advancePc("optional joined value")
+}
@@ -0,0 +1,62 @@
+package compengine
+
+// Support for @once and @exclusive, which drop branches of a @switchloop that already matched
+// earlier words.
+
+import (
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"strings"
+)
+
+type loopState struct {
+	// Branches with @once that matched.
+	once map[*compast.Node]bool
+
+	// @exclusive groups that any of the branches matched.
+	exclusive map[string]bool
+}
+
+func newLoopState() *loopState {
+	return &loopState{
+		once:      make(map[*compast.Node]bool),
+		exclusive: make(map[string]bool),
+	}
+}
+
+func exclusiveGroup(n *compast.Node) string {
+	if n.Exclusive() == nil {
+		return ""
+	}
+	return strings.ToLower(n.Exclusive().Word)
+}
+
+// used records that a branch matched a word in the innermost @switchloop.
+func (e *Engine) used(n *compast.Node) {
+	if len(e.loops) == 0 {
+		return
+	}
+	l := e.loops[len(e.loops)-1]
+	if n.Once() {
+		compdebug.Debugf("[used: %s]\n", n)
+		l.once[n] = true
+	}
+	if g := exclusiveGroup(n); g != "" {
+		compdebug.Debugf("[used: :%s]\n", g)
+		l.exclusive[g] = true
+	}
+}
+
+// excluded returns whether a branch shouldn't generate candidates, because it or another branch
+// in the same @exclusive group matched an earlier word in the innermost @switchloop.
+func (e *Engine) excluded(n *compast.Node) bool {
+	if len(e.loops) == 0 {
+		return false
+	}
+	l := e.loops[len(e.loops)-1]
+	if l.once[n] {
+		return true
+	}
+	g := exclusiveGroup(n)
+	return g != "" && l.exclusive[g]
+}
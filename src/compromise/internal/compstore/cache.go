@@ -5,7 +5,6 @@ import (
 	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compdebug"
 	"github.com/omakoto/compromise/src/compromise/compenv"
-	"github.com/omakoto/go-common/src/common"
 	"github.com/omakoto/go-common/src/utils"
 	"github.com/pkg/errors"
 	"io"
@@ -19,7 +18,7 @@ var (
 	cacheLock = &sync.Mutex{}
 )
 
-func CacheCandidates(candidates []compromise.Candidate) (e error) {
+func CacheCandidates(env *compromise.Environment, candidates []compromise.Candidate) (e error) {
 	if len(compenv.CacheFilename) == 0 {
 		return nil
 	}
@@ -30,7 +29,7 @@ func CacheCandidates(candidates []compromise.Candidate) (e error) {
 		f := compenv.CacheFilename
 		err := os.MkdirAll(filepath.Dir(f), 0700)
 		if err != nil {
-			common.Warnf("unable to create directory for %s", f)
+			env.Warnf("unable to create directory for %s", f)
 			e = errors.Wrap(err, "Unable to create directory")
 			return
 		}
@@ -45,11 +44,7 @@ func CacheCandidates(candidates []compromise.Candidate) (e error) {
 		bwr := bufio.NewWriter(wr)
 		defer bwr.Flush()
 
-		bwr.WriteString(strconv.Itoa(len(candidates)))
-		bwr.WriteByte(0)
-		for _, c := range candidates {
-			c.Serialize(bwr)
-		}
+		writeCandidates(bwr, candidates)
 	})
 	if e != nil {
 		compdebug.Warnf("Cache save error: %s", e)
@@ -72,24 +67,7 @@ func LoadCandidates() (result []compromise.Candidate, e error) {
 		}
 		defer rd.Close()
 
-		brd := bufio.NewReader(rd)
-		line, err := brd.ReadString(0)
-		if err == nil {
-			line = line[0 : len(line)-1]
-			size := utils.ParseInt(line, 10, 0)
-
-			result = make([]compromise.Candidate, 0, size)
-
-			for i := 0; i < size; i++ {
-				var c compromise.Candidate
-				c, err = compromise.Deserialize(brd)
-				if err != nil {
-					break
-				}
-				result = append(result, c)
-			}
-		}
-
+		result, err = readCandidates(bufio.NewReader(rd))
 		if err == io.EOF {
 			compdebug.Debugf("%d candidates loaded from cache\n", len(result))
 			return
@@ -101,3 +79,34 @@ func LoadCandidates() (result []compromise.Candidate, e error) {
 	}
 	return
 }
+
+// writeCandidates writes the number of candidates followed by serialized candidates.
+func writeCandidates(bwr *bufio.Writer, candidates []compromise.Candidate) {
+	bwr.WriteString(strconv.Itoa(len(candidates)))
+	bwr.WriteByte(0)
+	for _, c := range candidates {
+		c.Serialize(bwr)
+	}
+}
+
+// readCandidates reads candidates written by writeCandidates. Returns io.EOF at the end of input.
+func readCandidates(brd *bufio.Reader) (result []compromise.Candidate, err error) {
+	line, err := brd.ReadString(0)
+	if err != nil {
+		return nil, err
+	}
+	line = line[0 : len(line)-1]
+	size := utils.ParseInt(line, 10, 0)
+
+	result = make([]compromise.Candidate, 0, size)
+
+	for i := 0; i < size; i++ {
+		var c compromise.Candidate
+		c, err = compromise.Deserialize(brd)
+		if err != nil {
+			break
+		}
+		result = append(result, c)
+	}
+	return
+}
@@ -16,13 +16,15 @@ func TestCashe(t *testing.T) {
 		compromise.NewCandidate().SetHidden(true),
 		compromise.NewCandidate().SetForce(true),
 		compromise.NewCandidate().SetContinues(true),
+		compromise.NewCandidate().SetFile(true),
+		compromise.NewCandidate().SetGroup("group"),
 
-		compromise.NewCandidate().SetValue("v").SetHelp("h").SetRaw(true).SetHidden(true).SetForce(true).SetContinues(true),
+		compromise.NewCandidate().SetValue("v").SetHelp("h").SetRaw(true).SetHidden(true).SetForce(true).SetContinues(true).SetFile(true).SetGroup("g"),
 	}
 
 	compenv.CacheFilename = "/tmp/compromise-test-cache.dat"
 
-	err := CacheCandidates(source)
+	err := CacheCandidates(compromise.CurrentEnvironment(), source)
 	if err != nil {
 		assert.FailNow(t, "Failed to save to cache: %s", err)
 	}
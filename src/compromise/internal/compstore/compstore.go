@@ -2,6 +2,7 @@ package compstore
 
 import (
 	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compdebug"
 	"github.com/omakoto/compromise/src/compromise/compenv"
 	"github.com/omakoto/go-common/src/common"
@@ -16,6 +17,7 @@ import (
 
 type Store struct {
 	LastCommandLine           []string
+	LastWords                 []string
 	LastCursorIndex           int
 	LastCompletionTime        time.Time
 	CurrentCompletionTime     time.Time
@@ -25,34 +27,56 @@ type Store struct {
 }
 
 var (
-	lock  = &sync.Mutex{}
-	s     *Store
-	clock = utils.NewClock()
+	lock   = &sync.Mutex{}
+	s      *Store
+	sStamp fileStamp
+	clock  = utils.NewClock()
 )
 
-func ensureLoadedLocked() {
-	if s != nil {
+// fileStamp remembers the modification time of a loaded file, so that a long-lived process
+// (i.e. the daemon) only reloads it when another process has updated it.
+type fileStamp struct {
+	filename string
+	modTime  time.Time
+}
+
+func newFileStamp(filename string) fileStamp {
+	ret := fileStamp{filename: filename}
+	if st, err := os.Stat(filename); err == nil {
+		ret.modTime = st.ModTime()
+	}
+	return ret
+}
+
+// upToDate returns whether the file hasn't been updated since the stamp was taken.
+func (f fileStamp) upToDate(filename string) bool {
+	return f == newFileStamp(filename)
+}
+
+func ensureLoadedLocked(env *compromise.Environment) {
+	f := compenv.StoreFilename
+	if s != nil && sStamp.upToDate(f) {
 		return
 	}
 	s = &Store{}
+	sStamp = newFileStamp(f)
 
-	f := compenv.StoreFilename
 	if dry.FileExists(f) {
 		data, err := dry.FileGetBytes(f)
 		if err != nil {
-			common.Warnf("unable to load %s", f)
+			env.Warnf("unable to load %s", f)
 			return
 		}
 
 		err = json.Unmarshal(data, s)
 		if err != nil {
-			common.Warnf("unable to parse %s", f)
+			env.Warnf("unable to parse %s", f)
 			return
 		}
 	}
 }
 
-func saveLocked() {
+func saveLocked(env *compromise.Environment) {
 	if s == nil {
 		return
 	}
@@ -60,7 +84,7 @@ func saveLocked() {
 	f := compenv.StoreFilename
 	err := os.MkdirAll(filepath.Dir(f), 0700)
 	if err != nil {
-		common.Warnf("unable to create directory for %s", f)
+		env.Warnf("unable to create directory for %s", f)
 		return
 	}
 	data, err := json.MarshalIndent(s, "", "  ")
@@ -68,29 +92,36 @@ func saveLocked() {
 
 	err = os.WriteFile(f, data, 0600)
 	if err != nil {
-		common.Warnf("unable to save %s", f)
+		env.Warnf("unable to save %s", f)
 		return
 	}
+	sStamp = newFileStamp(f)
 }
 
-func Load() *Store {
+// Load returns the store. Warnings go to env.
+func Load(env *compromise.Environment) *Store {
 	lock.Lock()
 	defer lock.Unlock()
 
-	ensureLoadedLocked()
+	ensureLoadedLocked(env)
 	return s
 }
 
-func UpdateForInvocation(commandLine []string, cursorIndex int) *Store {
+// UpdateForInvocation updates the store for a new completion request. commandLine is the raw
+// words, words is the unescaped words and env is the shell's, whose current directory is recorded.
+func UpdateForInvocation(commandLine, words []string, cursorIndex int, env *compromise.Environment) *Store {
 	lock.Lock()
 	defer lock.Unlock()
 
-	ensureLoadedLocked()
+	ensureLoadedLocked(env)
+
+	if compenv.Frecency {
+		detectSelectionLocked(env, words, cursorIndex)
+	}
 
-	pwd, _ := os.Getwd()
 	now := clock.Now()
 
-	if s.LastPwd == pwd && s.LastCursorIndex == cursorIndex && reflect.DeepEqual(s.LastCommandLine, commandLine) {
+	if s.LastPwd == env.Dir && s.LastCursorIndex == cursorIndex && reflect.DeepEqual(s.LastCommandLine, commandLine) {
 		s.NumConsecutiveInvocations++
 	} else {
 		s.LastCursorIndex = cursorIndex
@@ -98,15 +129,16 @@ func UpdateForInvocation(commandLine []string, cursorIndex int) *Store {
 		s.NumConsecutiveInvocations = 1
 	}
 
+	s.LastWords = words
 	s.LastCompletionTime = s.CurrentCompletionTime
-	s.LastPwd = pwd
+	s.LastPwd = env.Dir
 	s.CurrentCompletionTime = now
 
 	s.IsDoublePress = s.NumConsecutiveInvocations > 1 && s.LastCompletionAge() <= compenv.DoublePressTimeout
 
 	compdebug.Dump("Store updated", s)
 
-	saveLocked()
+	saveLocked(env)
 
 	return s
 }
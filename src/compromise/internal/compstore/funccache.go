@@ -0,0 +1,213 @@
+package compstore
+
+// Persistent cache for results of slow candidate generator functions.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/go-common/src/utils"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// funcCacheEntry is content of a cache file kept in memory, which is only useful in a long-lived
+// process, i.e. the daemon.
+type funcCacheEntry struct {
+	stamp fileStamp
+	data  []byte
+}
+
+var (
+	funcCacheLock   = &sync.Mutex{}
+	funcCacheMemory = make(map[string]funcCacheEntry)
+)
+
+// readFuncCacheFile returns content of a cache file, using the in-memory copy if the file
+// hasn't been updated since it was read.
+func readFuncCacheFile(filename string) ([]byte, error) {
+	funcCacheLock.Lock()
+	defer funcCacheLock.Unlock()
+
+	stamp := newFileStamp(filename)
+	if e, ok := funcCacheMemory[filename]; ok && e.stamp == stamp {
+		return e.data, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		delete(funcCacheMemory, filename)
+		return nil, err
+	}
+	funcCacheMemory[filename] = funcCacheEntry{stamp: stamp, data: data}
+	return data, nil
+}
+
+func funcCacheFilename(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(compenv.FuncCacheDir, hex.EncodeToString(sum[:])+".dat")
+}
+
+// Kinds of cache files, which are stored after the key and the time.
+const (
+	funcCacheStrict = "0" // Candidates from a "strict" CandidateList.
+	funcCacheOpen   = "1" // Candidates from an "open" CandidateList.
+	funcCacheRaw    = "r" // Raw bytes, e.g. output of a slow command.
+)
+
+// SaveFuncCache stores candidates with a given key. open tells whether the candidates are
+// non-exhaustive, i.e. whether they were from an "open" CandidateList.
+func SaveFuncCache(key string, candidates []compromise.Candidate, open bool) (e error) {
+	kind := funcCacheStrict
+	if open {
+		kind = funcCacheOpen
+	}
+	return saveFuncCache(key, kind, func(bwr *bufio.Writer) {
+		writeCandidates(bwr, candidates)
+	})
+}
+
+// SaveFuncCacheBytes stores raw bytes with a given key.
+func SaveFuncCacheBytes(key string, data []byte) (e error) {
+	return saveFuncCache(key, funcCacheRaw, func(bwr *bufio.Writer) {
+		bwr.Write(data)
+	})
+}
+
+func saveFuncCache(key, kind string, write func(bwr *bufio.Writer)) (e error) {
+	compdebug.Time("Saving to func cache", func() {
+		err := os.MkdirAll(compenv.FuncCacheDir, 0700)
+		if err != nil {
+			e = errors.Wrap(err, "Unable to create directory")
+			return
+		}
+
+		// Write to a temp file and rename it, so other processes will never see a partial file.
+		f := funcCacheFilename(key)
+		wr, err := os.CreateTemp(compenv.FuncCacheDir, "tmp")
+		if err != nil {
+			e = errors.Wrap(err, "Unable to create file")
+			return
+		}
+		defer os.Remove(wr.Name())
+
+		bwr := bufio.NewWriter(wr)
+		bwr.WriteString(strconv.Quote(key)) // Keys may contain \0.
+		bwr.WriteByte(0)
+		bwr.WriteString(strconv.FormatInt(clock.Now().UnixNano(), 10))
+		bwr.WriteByte(0)
+		bwr.WriteString(kind)
+		bwr.WriteByte(0)
+		write(bwr)
+
+		err = bwr.Flush()
+		if err == nil {
+			err = wr.Close()
+		} else {
+			wr.Close()
+		}
+		if err != nil {
+			e = errors.Wrap(err, "Unable to write file")
+			return
+		}
+		if err = os.Rename(wr.Name(), f); err != nil {
+			e = errors.Wrap(err, "Unable to rename file")
+		}
+	})
+	if e != nil {
+		compdebug.Warnf("Func cache save error: %s", e)
+	}
+	return
+}
+
+// LoadFuncCache returns candidates stored with a given key, if they were stored within ttl, and
+// none of the dependency files has been modified since then.
+func LoadFuncCache(key string, ttl time.Duration, dependencies []string) (candidates []compromise.Candidate, open bool, ok bool) {
+	compdebug.Time("Loading from func cache", func() {
+		kind, brd := loadFuncCache(key, ttl, dependencies)
+		if kind != funcCacheStrict && kind != funcCacheOpen {
+			return
+		}
+		open = kind == funcCacheOpen
+
+		var err error
+		candidates, err = readCandidates(brd)
+		if err != nil {
+			compdebug.Warnf("Func cache load error: %s", err)
+			return
+		}
+		compdebug.Debugf("%d candidates loaded from func cache: %q\n", len(candidates), key)
+		ok = true
+	})
+	return
+}
+
+// LoadFuncCacheBytes returns raw bytes stored with a given key, in the same way as LoadFuncCache.
+func LoadFuncCacheBytes(key string, ttl time.Duration, dependencies []string) (data []byte, ok bool) {
+	compdebug.Time("Loading from func cache", func() {
+		kind, brd := loadFuncCache(key, ttl, dependencies)
+		if kind != funcCacheRaw {
+			return
+		}
+		var err error
+		data, err = io.ReadAll(brd)
+		if err != nil {
+			compdebug.Warnf("Func cache load error: %s", err)
+			return
+		}
+		compdebug.Debugf("%d bytes loaded from func cache: %q\n", len(data), key)
+		ok = true
+	})
+	return
+}
+
+// loadFuncCache returns the kind of a cache file and a reader of the rest, or "" if the cache
+// isn't available.
+func loadFuncCache(key string, ttl time.Duration, dependencies []string) (string, *bufio.Reader) {
+	data, err := readFuncCacheFile(funcCacheFilename(key))
+	if err != nil {
+		return "", nil
+	}
+
+	brd := bufio.NewReader(bytes.NewReader(data))
+	readField := func() string {
+		s, err := brd.ReadString(0)
+		if err != nil {
+			return ""
+		}
+		return s[:len(s)-1]
+	}
+
+	if readField() != strconv.Quote(key) {
+		return "", nil // Hash collision or a broken file.
+	}
+	created := time.Unix(0, int64(utils.ParseInt(readField(), 10, 0)))
+	if clock.Now().Sub(created) > ttl {
+		compdebug.Debugf("Func cache expired: %q\n", key)
+		return "", nil
+	}
+	for _, dep := range dependencies {
+		if st, err := os.Stat(dep); err == nil && st.ModTime().After(created) {
+			compdebug.Debugf("Func cache invalidated by %s: %q\n", dep, key)
+			return "", nil
+		}
+	}
+	return readField(), brd
+}
+
+// ClearFuncCache removes all the cached function results.
+func ClearFuncCache() error {
+	funcCacheLock.Lock()
+	funcCacheMemory = make(map[string]funcCacheEntry)
+	funcCacheLock.Unlock()
+
+	return os.RemoveAll(compenv.FuncCacheDir)
+}
@@ -0,0 +1,194 @@
+package compstore
+
+// History of candidates that were actually selected by the user, which is used to rank
+// candidates by "frecency" (frequency + recency).
+
+import (
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/omakoto/go-common/src/common"
+	"github.com/ungerik/go-dry"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Weight of a selection halves in this duration.
+	historyHalfLife = 7 * 24 * time.Hour
+
+	// Keep at most this many values for each position.
+	maxHistoryEntries = 200
+)
+
+// HistoryEntry is a record of a selected value.
+type HistoryEntry struct {
+	Count int
+	Last  time.Time
+}
+
+// weight returns the frecency of an entry.
+func (h *HistoryEntry) weight(now time.Time) float64 {
+	age := now.Sub(h.Last)
+	if age < 0 {
+		age = 0
+	}
+	return float64(h.Count) * math.Pow(0.5, float64(age)/float64(historyHalfLife))
+}
+
+// History holds selected values for each command and position. A position is identified by the
+// word before it, rather than by the index, so that e.g. extra flags don't shift it.
+type History struct {
+	// Command -> previous word -> value -> entry
+	Entries map[string]map[string]map[string]*HistoryEntry
+}
+
+var (
+	historyLock  = &sync.Mutex{}
+	history      *History
+	historyStamp fileStamp
+)
+
+func ensureHistoryLoadedLocked(env *compromise.Environment) {
+	f := compenv.HistoryFilename
+	if history != nil && historyStamp.upToDate(f) {
+		return
+	}
+	history = &History{}
+	historyStamp = newFileStamp(f)
+
+	if dry.FileExists(f) {
+		data, err := dry.FileGetBytes(f)
+		if err != nil {
+			env.Warnf("unable to load %s", f)
+		} else if err = json.Unmarshal(data, history); err != nil {
+			env.Warnf("unable to parse %s", f)
+		}
+	}
+	if history.Entries == nil {
+		history.Entries = make(map[string]map[string]map[string]*HistoryEntry)
+	}
+}
+
+func saveHistoryLocked(env *compromise.Environment) {
+	f := compenv.HistoryFilename
+	err := os.MkdirAll(filepath.Dir(f), 0700)
+	if err != nil {
+		env.Warnf("unable to create directory for %s", f)
+		return
+	}
+	data, err := json.Marshal(history)
+	common.CheckPanice(err)
+
+	err = os.WriteFile(f, data, 0600)
+	if err != nil {
+		env.Warnf("unable to save %s", f)
+		return
+	}
+	historyStamp = newFileStamp(f)
+}
+
+// RecordSelection records value as selected after a previous word for a command.
+func RecordSelection(env *compromise.Environment, command, previous, value string) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	ensureHistoryLoadedLocked(env)
+
+	positions, ok := history.Entries[command]
+	if !ok {
+		positions = make(map[string]map[string]*HistoryEntry)
+		history.Entries[command] = positions
+	}
+	values, ok := positions[previous]
+	if !ok {
+		values = make(map[string]*HistoryEntry)
+		positions[previous] = values
+	}
+	e, ok := values[value]
+	if !ok {
+		e = &HistoryEntry{}
+		values[value] = e
+	}
+	now := clock.Now()
+	e.Count++
+	e.Last = now
+
+	pruneLocked(values, now)
+
+	compdebug.Debugf("Selection recorded: %q %q %q\n", command, previous, value)
+
+	saveHistoryLocked(env)
+}
+
+// pruneLocked removes the least frecent values.
+func pruneLocked(values map[string]*HistoryEntry, now time.Time) {
+	if len(values) <= maxHistoryEntries {
+		return
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return values[keys[i]].weight(now) > values[keys[j]].weight(now)
+	})
+	for _, k := range keys[maxHistoryEntries:] {
+		delete(values, k)
+	}
+}
+
+// HistoryWeights returns the frecency of each value selected after a previous word for a command.
+func HistoryWeights(env *compromise.Environment, command, previous string) map[string]float64 {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	ensureHistoryLoadedLocked(env)
+
+	now := clock.Now()
+	ret := make(map[string]float64)
+	for value, e := range history.Entries[command][previous] {
+		ret[value] = e.weight(now)
+	}
+	return ret
+}
+
+// ClearHistory removes all the selection history.
+func ClearHistory() error {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	history = nil
+	err := os.Remove(compenv.HistoryFilename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// detectSelectionLocked checks whether the word at the previous cursor position is one of the
+// candidates from the previous completion, and if so, records it as selected.
+func detectSelectionLocked(env *compromise.Environment, words []string, cursorIndex int) {
+	prevIndex := s.LastCursorIndex
+	if prevIndex < 1 || prevIndex >= cursorIndex || prevIndex >= len(s.LastWords) || prevIndex >= len(words) {
+		return
+	}
+	for i := 0; i < prevIndex; i++ {
+		if s.LastWords[i] != words[i] {
+			return
+		}
+	}
+	selected := words[prevIndex]
+	candidates, _ := LoadCandidates()
+	for _, c := range candidates {
+		if c.Value() == selected {
+			RecordSelection(env, words[0], words[prevIndex-1], selected)
+			return
+		}
+	}
+}
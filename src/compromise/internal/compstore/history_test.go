@@ -0,0 +1,69 @@
+package compstore
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compenv"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	compenv.HistoryFilename = filepath.Join(dir, "history.json")
+	compenv.StoreFilename = filepath.Join(dir, "lastcommand.json")
+	compenv.CacheFilename = filepath.Join(dir, "lastcandidates.dat")
+	compenv.Frecency = true
+	s = nil
+	history = nil
+	env := &compromise.Environment{Dir: "/"}
+
+	RecordSelection(env, "adb", "am", "start")
+	RecordSelection(env, "adb", "am", "start")
+	RecordSelection(env, "adb", "am", "stop")
+
+	w := HistoryWeights(env, "adb", "am")
+	assert.Equal(t, 2, len(w))
+	assert.True(t, w["start"] > w["stop"])
+	assert.Equal(t, 0, len(HistoryWeights(env, "adb", "pm")))
+
+	// Reload from the file.
+	history = nil
+	w = HistoryWeights(env, "adb", "am")
+	assert.Equal(t, 2, len(w))
+	assert.True(t, w["start"] > w["stop"])
+
+	// "adb shell [TAB]" and then "adb shell am [TAB]" should record "am".
+	CacheCandidates(env, []compromise.Candidate{
+		compromise.NewCandidate().SetValue("am"),
+		compromise.NewCandidate().SetValue("pm"),
+	})
+	UpdateForInvocation([]string{"adb", "shell", ""}, []string{"adb", "shell", ""}, 2, env)
+	UpdateForInvocation([]string{"adb", "shell", "am", ""}, []string{"adb", "shell", "am", ""}, 3, env)
+	assert.Equal(t, 1, len(HistoryWeights(env, "adb", "shell")))
+
+	// Words that aren't candidates aren't recorded.
+	UpdateForInvocation([]string{"adb", "shell", "x", "y", ""}, []string{"adb", "shell", "x", "y", ""}, 4, env)
+	UpdateForInvocation([]string{"adb", "shell", "x", "y", "z", ""}, []string{"adb", "shell", "x", "y", "z", ""}, 5, env)
+	assert.Equal(t, 0, len(HistoryWeights(env, "adb", "y")))
+
+	assert.Nil(t, ClearHistory())
+	assert.Equal(t, 0, len(HistoryWeights(env, "adb", "am")))
+	_, err := os.Stat(compenv.HistoryFilename)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, ClearHistory())
+}
+
+func TestHistoryWarnings(t *testing.T) {
+	dir := t.TempDir()
+	compenv.HistoryFilename = filepath.Join(dir, "history.json")
+	os.WriteFile(compenv.HistoryFilename, []byte("{"), 0600)
+	history = nil
+
+	// Warnings go to the shell that requested the completion, which may not be ours.
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, len(HistoryWeights(&compromise.Environment{Stderr: stderr}, "adb", "am")))
+	assert.Contains(t, stderr.String(), "unable to parse "+compenv.HistoryFilename)
+}
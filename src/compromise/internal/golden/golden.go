@@ -0,0 +1,54 @@
+// Package golden compares outputs in tests with golden files in testdata.
+//
+// Run tests with COMPROMISE_UPDATE_GOLDEN=1 to rewrite the golden files with the outputs instead.
+package golden
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Read returns the content of a file, or fails the test if it can't be read.
+func Read(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+// Assert checks that an output matches the content of a golden file.
+func Assert(t *testing.T, file, actual string) {
+	t.Helper()
+	if os.Getenv("COMPROMISE_UPDATE_GOLDEN") != "" {
+		assert.NoError(t, os.WriteFile(file, []byte(actual), 0644))
+		return
+	}
+	assert.Equal(t, Read(t, file), actual, file)
+}
+
+// ForEach runs f in a subtest for each input file matching a pattern, e.g. "testdata/*.help",
+// with the content.
+func ForEach(t *testing.T, pattern string, f func(t *testing.T, file, input string)) {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files, pattern)
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			f(t, file, Read(t, file))
+		})
+	}
+}
+
+// Formats runs f in a subtest for each format, e.g. a shell, and compares the output with the
+// golden file that file returns for the format, e.g. "testdata/mytool.zsh".
+func Formats(t *testing.T, formats []string, file func(format string) string, f func(t *testing.T, format string) string) {
+	t.Helper()
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			Assert(t, file(format), f(t, format))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package golden_test
+
+import (
+	"bytes"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compdoc"
+	"github.com/omakoto/compromise/src/compromise/compexport"
+	"github.com/omakoto/compromise/src/compromise/compstruct"
+	"github.com/omakoto/compromise/src/compromise/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestUnsupportedFormats checks the errors of the packages whose outputs are tested with golden
+// files, for a format that they don't support.
+func TestUnsupportedFormats(t *testing.T) {
+	spec := "@command cmd\n"
+	root := parser.Parse(spec, compromise.NewDirectives())
+	tests := []struct {
+		name     string
+		run      func() error
+		expected string
+	}{
+		{"compexport", func() error {
+			_, err := compexport.Export(root, "csh", []string{"cmd"}, &bytes.Buffer{})
+			return err
+		}, `unsupported shell "csh"; must be one of zsh, fish, bash`},
+		{"compdoc", func() error {
+			return compdoc.Write(root, "html", []string{"cmd"}, &bytes.Buffer{})
+		}, `unsupported format "html"; must be one of markdown, man`},
+		{"compstruct", func() error {
+			_, err := compstruct.Convert(spec, compromise.NewDirectives(), "toml")
+			return err
+		}, `unsupported format "toml"; must be one of text, json, yaml`},
+	}
+	for _, v := range tests {
+		assert.EqualError(t, v.run(), v.expected, v.name)
+	}
+}
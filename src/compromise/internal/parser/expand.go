@@ -0,0 +1,60 @@
+package parser
+
+// Expansion of parameterized labels, e.g.
+//
+//   @call :body activity
+//   ...
+//   @label :body $kind
+//     @cand takeDeviceComponent $kind
+//
+// Each @call with arguments is changed to call an instance of the label, which is a copy of the
+// label with the parameters replaced with the arguments.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"regexp"
+)
+
+var paramRe = regexp.MustCompile(`^\$\w+$`)
+
+// maxInstances is the maximum number of label instances in a spec, which prevents infinite
+// expansion by recursive calls with different arguments.
+const maxInstances = 1000
+
+func expand(root *compast.Node) {
+	instances := 0
+
+	var walk func(n *compast.Node, inTemplate bool)
+	walk = func(n *compast.Node, inTemplate bool) {
+		if (n.NodeType() == compast.NodeCall || n.NodeType() == compast.NodeCommand) && n.Label() != nil {
+			// Undefined labels are reported later.
+			if target := n.FindLabeledNode(n.LabelWord()); target != nil {
+				args := n.Args()
+				if len(args) != len(target.Params()) {
+					panic(compromise.NewSpecErrorf(n.Label(), "label :%s takes %d argument(s), but %d given",
+						n.LabelWord(), len(target.Params()), len(args)))
+				}
+
+				// Calls in a template may have parameters in the arguments, so they're expanded
+				// in the instances instead.
+				if len(args) > 0 && !inTemplate {
+					instances++
+					if instances > maxInstances {
+						panic(compromise.NewSpecErrorf(n.Label(), "too many instances of parameterized labels, which may be called recursively"))
+					}
+					target.Instantiate(args)
+					n.SetLabelWord(compast.InstanceName(n.LabelWord(), args))
+				}
+			}
+		}
+		for c := n.Child(); c != nil; c = c.Next() {
+			walk(c, inTemplate)
+		}
+	}
+
+	// Instances are added to the end of the root, so they'll be expanded too.
+	for c := root.Child(); c != nil; c = c.Next() {
+		walk(c, c.NodeType() == compast.NodeLabel && len(c.Params()) > 0)
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	spec := "@call :body activity\n" +
+		"@call :body activity\n" +
+		"@call :body Activity\n" +
+		"@label :body $kind # Takes $kind\n" +
+		"  -$kind # A $kind\n" +
+		"  @cand TakeFile $kind\n" +
+		"  @call :both $kind x\n" +
+		"@label :both $a $ab\n" +
+		"  $ab$a\n"
+
+	// Node IDs depend on other tests.
+	dump := regexp.MustCompile(`#\d+ `).ReplaceAllString(Parse(spec, d).Dump(true), "")
+	assert.Equal(t, `[0] Root:
+  [1] Call: label="body(\"activity\")" args=["activity"]
+  [1] Call: label="body(\"activity\")" args=["activity"]
+  [1] Call: label="body(\"Activity\")" args=["Activity"]
+  [1] Label: label="body" help="Takes $kind" params=["$kind"]
+    [2] Literal: literal="-$kind" help="A $kind"
+    [2] Candidate: funcName="TakeFile" args=["$kind"]
+    [2] Call: label="both" args=["$kind", "x"]
+  [1] Label: label="both" params=["$a", "$ab"]
+    [2] Literal: literal="$ab$a"
+  [1] Label: label="body(\"activity\")" help="Takes activity"
+    [2] Literal: literal="-activity" help="A activity"
+    [2] Candidate: funcName="TakeFile" args=["activity"]
+    [2] Call: label="both(\"activity\", \"x\")" args=["activity", "x"]
+  [1] Label: label="body(\"Activity\")" help="Takes Activity"
+    [2] Literal: literal="-Activity" help="A Activity"
+    [2] Candidate: funcName="TakeFile" args=["Activity"]
+    [2] Call: label="both(\"Activity\", \"x\")" args=["Activity", "x"]
+  [1] Label: label="both(\"activity\", \"x\")"
+    [2] Literal: literal="xactivity"
+  [1] Label: label="both(\"Activity\", \"x\")"
+    [2] Literal: literal="xActivity"
+`, dump)
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"@call :x\n@label :x $a\n  $a\n", "label :x takes 1 argument(s), but 0 given at x:1:7"},
+		{"@call :x a b\n@label :x $a\n  $a\n", "label :x takes 1 argument(s), but 2 given at x:1:7"},
+		{"@command c :x\n@label :x $a\n  $a\n", "label :x takes 1 argument(s), but 0 given at x:1:12"},
+		{"@call :x\n@label :x a\n  a\n", "invalid parameter a, which must be $name at x:2:11"},
+		{"@call :x a a\n@label :x $a $a\n  $a\n", "duplicate parameter $a at x:2:14"},
+		{"@call :x a # help\n@label :x $a\n  $a\n", "Only string literals may appear here at x:1:12"},
+		{"@call :x a\n@label :x $a\n  @call :x $a.\n", "too many instances of parameterized labels, which may be called recursively at x:3:9"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
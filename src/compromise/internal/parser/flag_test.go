@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestJoinedAndBundle(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	spec := "@switchloop\n" +
+		"  -l|-a\n" +
+		"    @bundle\n" +
+		"  -s|--serial\n" +
+		"    @joined\n" +
+		"    @any\n"
+
+	dump := regexp.MustCompile(`#\d+ `).ReplaceAllString(Parse(spec, d).Dump(true), "")
+	assert.Equal(t, `[0] Root:
+  [1] SwitchLoop:
+    [2] Literal: literal="-l|-a" bundle
+    [2] Literal: literal="-s|--serial" joined
+      [3] Any:
+`, dump)
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"@switch\n  @any\n    @joined\n", "@joined must be a child of a literal at x:3:5"},
+		{"--all\n  @bundle\n", "@bundle only applies to short flags such as -a, but \"--all\" isn't at x:2:3"},
+		{"-a|b\n  @joined\n", "@joined only applies to flags, but \"b\" isn't at x:2:3"},
+		{"-a\n  @joined x\n", "excessive token detected at x:2:11"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
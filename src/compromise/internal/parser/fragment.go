@@ -0,0 +1,160 @@
+package parser
+
+// Spec fragments, which come from @include's or multiple specs passed to compmain.Main().
+//
+// Fragments are joined into a single spec string, because a spec is passed around as a string,
+// e.g. it's embedded in the shell script that "install" generates. Each fragment after the main
+// spec follows a fragmentSeparator line, and starts with its own directives.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const fragmentSeparator = "\n//@fragment\n"
+
+// JoinFragments joins a main spec and spec fragments into a single spec. Labels in each fragment
+// are in the namespace given by the fragment's directives, which defaults to the base name of
+// the filename.
+func JoinFragments(specs ...string) string {
+	if len(specs) == 1 {
+		return specs[0]
+	}
+	b := &strings.Builder{}
+	for i, spec := range specs {
+		if i > 0 {
+			b.WriteString(fragmentSeparator)
+		}
+		b.WriteString(strings.TrimSuffix(spec, "\n"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Bundle returns a spec with the files that it includes as fragments, so that the spec can be
+// parsed without the files.
+func Bundle(spec string, d *compromise.Directives) string {
+	return JoinFragments(append([]string{spec}, load(spec, d).loaded...)...)
+}
+
+// loader parses all the fragments of a spec into a single tree.
+type loader struct {
+	root *compast.Node
+
+	// Namespace -> filename, and filename -> namespace of the loaded fragments.
+	namespaces map[string]string
+	files      map[string]string
+
+	// Fragments read from included files.
+	loaded []string
+
+	// If set, @include's aren't loaded, but kept in includes, for ToStructured.
+	keepIncludes bool
+	includes     []*keptInclude
+}
+
+// keptInclude is an @include that isn't loaded.
+type keptInclude struct {
+	node *StructuredNode
+
+	// The last top level node before the @include, or nil.
+	after *compast.Node
+}
+
+func newLoader() *loader {
+	return &loader{
+		root:       compast.NewRoot(),
+		namespaces: make(map[string]string),
+		files:      make(map[string]string),
+	}
+}
+
+func load(spec string, d *compromise.Directives) *loader {
+	l := newLoader()
+	sources := strings.Split(spec, fragmentSeparator)
+
+	// Register the fragments first, so the @include's of them will be no-op.
+	parsers := make([]*parser, 0, len(sources))
+	parsers = append(parsers, &parser{source: sources[0], directives: d, loader: l})
+	for _, source := range sources[1:] {
+		fd := compromise.ExtractDirectives(source)
+		namespace := fd.Namespace
+		if namespace == "" {
+			namespace = namespaceFromFilename(fd.Filename)
+		}
+		if namespace == "" {
+			panic(compromise.NewSpecErrorf(nil, "spec fragment must have a namespace or a filename"))
+		}
+		l.register(fd.Filename, namespace, nil)
+		parsers = append(parsers, &parser{source: source, directives: fd, namespace: namespace, loader: l})
+	}
+
+	for _, p := range parsers {
+		p.parse()
+	}
+	expand(l.root)
+	return l
+}
+
+func namespaceFromFilename(filename string) string {
+	base := filepath.Base(filename)
+	if filename == "" || base == "." {
+		return ""
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (l *loader) register(filename, namespace string, referrer *compast.Token) {
+	if other, ok := l.namespaces[namespace]; ok {
+		var location compromise.SourceLocation
+		if referrer != nil {
+			location = referrer
+		}
+		panic(compromise.NewSpecErrorf(location, "namespace :%s is already used by %s", namespace, other))
+	}
+	l.namespaces[namespace] = filename
+	if filename != "" {
+		l.files[filename] = namespace
+	}
+}
+
+// include loads a file included by a fragment. The path is relative to the including file.
+func (l *loader) include(path, namespace *compast.Token, from *compromise.Directives) {
+	filename := path.Word
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(from.Filename), filename)
+	}
+
+	if other, ok := l.files[filename]; ok {
+		// Already loaded, or will be loaded as a fragment.
+		if namespace != nil && namespace.Word != other {
+			panic(compromise.NewSpecErrorf(path, "%s is already included as :%s", path.Word, other))
+		}
+		return
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		panic(compromise.NewSpecErrorf(path, "unable to include %s: %s", path.Word, err))
+	}
+	fd := compromise.ExtractDirectives(string(data))
+
+	ns := fd.Namespace
+	if namespace != nil {
+		ns = namespace.Word
+	} else if ns == "" {
+		ns = namespaceFromFilename(filename)
+	}
+	l.register(filename, ns, path)
+
+	// Line 1 of the file is line 2 of the fragment, because of the directives.
+	fd.SetFilename(filename).SetStartLine(0).SetNamespace(ns)
+	source := "//" + fd.JSON() + "\n" + string(data)
+	l.loaded = append(l.loaded, source)
+
+	p := &parser{source: source, directives: fd, namespace: ns, loader: l}
+	p.parse()
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parseError returns the error that Parse panics with, or "" if none.
+func parseError(spec string, d *compromise.Directives) (ret string) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret = r.(compromise.SpecError).Error()
+		}
+	}()
+	Parse(spec, d)
+	return ""
+}
+
+// callTarget returns the location of the label called by the @call at a given line under a node.
+func callTarget(n *compast.Node, line int) string {
+	var find func(n *compast.Node) *compast.Node
+	find = func(n *compast.Node) *compast.Node {
+		for c := n.Child(); c != nil; c = c.Next() {
+			if c.NodeType() == compast.NodeCall && c.SelfToken().Line == line {
+				return c
+			}
+			if found := find(c); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	call := find(n)
+	target := call.FindLabeledNode(call.LabelWord())
+	if target == nil {
+		return ""
+	}
+	file, line, _ := target.Label().SourceLocation()
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "lib", name), []byte(content), 0600))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0700))
+	write("intent.spec", "@include \"flags.spec\"\n"+
+		"@label :intent\n"+
+		"  @call :flags.flags\n"+
+		"  @call :local\n"+
+		"@label :local\n"+
+		"  x\n")
+	write("flags.spec", "@label :flags\n"+
+		"  -a\n")
+	write("broken.spec", "@label :x\n"+
+		"  @call :missing\n")
+	write("toplevel.spec", "@label :x\n"+
+		"  a\n"+
+		"b\n")
+
+	d := compromise.NewDirectives().SetFilename(filepath.Join(dir, "main.spec"))
+	spec := "@include \"lib/intent.spec\"\n" +
+		"@call :intent.intent\n" +
+		"@call :local\n" +
+		"@call :intent.local\n" +
+		"@label :local\n" +
+		"  y\n"
+
+	// Labels are first looked up in the same fragment.
+	root := Parse(spec, d)
+	assert.Equal(t, "intent.spec:2", callTarget(root, 2))
+	assert.Equal(t, "main.spec:5", callTarget(root, 3))
+	assert.Equal(t, "intent.spec:5", callTarget(root, 4))
+	assert.Equal(t, "flags.spec:1", callTarget(root.FindLabeledNode("intent.intent"), 3))
+	assert.Equal(t, "intent.spec:5", callTarget(root.FindLabeledNode("intent.intent"), 4))
+
+	// The bundled spec can be parsed without the files.
+	bundled := Bundle(spec, d)
+	assert.NoError(t, os.Rename(filepath.Join(dir, "lib", "intent.spec"), filepath.Join(dir, "lib", "x")))
+	root = Parse(bundled, d)
+	assert.Equal(t, "intent.spec:2", callTarget(root, 2))
+	assert.Equal(t, "flags.spec:1", callTarget(root.FindLabeledNode("intent.intent"), 3))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "lib", "x"), filepath.Join(dir, "lib", "intent.spec")))
+
+	// Errors.
+	lib := filepath.Join(dir, "lib")
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"@include \"lib/broken.spec\"\n", "undefined label :missing at " + lib + "/broken.spec:2:9"},
+		{"@include \"lib/toplevel.spec\"\n", "only @label and @include can appear at the top level of a spec fragment at " + lib + "/toplevel.spec:3:1"},
+		{"@include \"lib/none.spec\"\n", "unable to include lib/none.spec: open " + lib + "/none.spec: no such file or directory at " + dir + "/main.spec:1:10"},
+		{"@include \"lib/flags.spec\"\n@include \"lib/flags.spec\" :f\n", "lib/flags.spec is already included as :flags at " + dir + "/main.spec:2:10"},
+		{"@include \"lib/flags.spec\"\n@include \"lib/broken.spec\" :flags\n", "namespace :flags is already used by " + lib + "/flags.spec at " + dir + "/main.spec:2:10"},
+		{"@switch\n  @include \"lib/flags.spec\"\n", "@include must be at the toplevel at " + dir + "/main.spec:2:3"},
+		{"@include \"lib/flags.spec\"\n  a\n", "@include takes no children at " + dir + "/main.spec:2:3"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
+
+func TestJoinFragments(t *testing.T) {
+	spec := JoinFragments(
+		"@call :x\n@call :lib.x\n@label :x\n  a\n",
+		"//"+compromise.NewDirectives().SetFilename("/src/lib.go").SetStartLine(10).JSON()+"\n@label :x\n  @call :y\n@label :y\n  b\n",
+		"//"+compromise.NewDirectives().SetNamespace("other").JSON()+"\n@label :x\n  c\n",
+	)
+	root := Parse(spec, compromise.ExtractDirectives(spec))
+	assert.Equal(t, ".:3", callTarget(root, 1)) // No filename.
+	assert.Equal(t, "lib.go:11", callTarget(root, 2))
+	assert.Equal(t, "lib.go:13", callTarget(root.FindLabeledNode("lib.x"), 12))
+	assert.NotNil(t, root.FindLabeledNode("other.x"))
+
+	// Unused labels are only reported in the main spec.
+	assert.Equal(t, 0, len(Lint(spec, compromise.ExtractDirectives(spec))))
+
+	assert.Equal(t, "spec fragment must have a namespace or a filename",
+		parseError(JoinFragments("a\n", "@label :x\n  b\n"), compromise.NewDirectives()))
+}
@@ -0,0 +1,257 @@
+package parser
+
+// Lint pass over a parsed spec, which collects all errors and warnings.
+
+import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/compfunc"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	// Errors are mistakes that make a spec misbehave. Parse only rejects the ones that the engine
+	// can't run with, e.g. undefined labels.
+	SeverityError Severity = iota
+
+	// Warnings are likely mistakes, but they're only reported by Lint.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Problem is an error or a warning found by the linter.
+type Problem struct {
+	compromise.SpecError
+	Severity Severity
+
+	// Whether Parse rejects the spec too.
+	fatal bool
+}
+
+// String returns a problem in the "file:line:col: severity: message" form.
+func (p *Problem) String() string {
+	if p.Location == nil {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	file, line, column := p.Location.SourceLocation()
+	return fmt.Sprintf("%s:%d:%d: %s: %s", file, line, column, p.Severity, p.Message)
+}
+
+// Lint parses a spec and returns all the problems in it, sorted by location. If the spec can't
+// be parsed, the result only contains the parse error.
+func Lint(spec string, d *compromise.Directives) []*Problem {
+	_, problems := Analyze(spec, d)
+	return problems
+}
+
+// Analyze is similar to Lint, but also returns the tree, even if it has errors. The tree is nil
+// if the spec can't be parsed.
+func Analyze(spec string, d *compromise.Directives) (root *compast.Node, problems []*Problem) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(compromise.SpecError); ok {
+				root = nil
+				problems = []*Problem{{SpecError: e, Severity: SeverityError}}
+				return
+			}
+			panic(r)
+		}
+	}()
+	root = load(spec, d).root
+	return root, lint(root)
+}
+
+type linter struct {
+	problems []*Problem
+
+	// Labels referred by @call or @command.
+	usedLabels map[*compast.Node]bool
+}
+
+func (l *linter) add(severity Severity, fatal bool, location *compast.Token, format string, args ...interface{}) {
+	l.problems = append(l.problems, &Problem{compromise.NewSpecErrorf(location, format, args...), severity, fatal})
+}
+
+// fatalf adds an error that Parse rejects too.
+func (l *linter) fatalf(location *compast.Token, format string, args ...interface{}) {
+	l.add(SeverityError, true, location, format, args...)
+}
+
+func (l *linter) errorf(location *compast.Token, format string, args ...interface{}) {
+	l.add(SeverityError, false, location, format, args...)
+}
+
+func (l *linter) warnf(location *compast.Token, format string, args ...interface{}) {
+	l.add(SeverityWarning, false, location, format, args...)
+}
+
+func lint(root *compast.Node) []*Problem {
+	l := &linter{usedLabels: make(map[*compast.Node]bool)}
+
+	l.checkNode(root)
+
+	// Unused labels. Fragments are libraries, so only check the main spec.
+	for n := root.Child(); n != nil; n = n.Next() {
+		if n.NodeType() == compast.NodeLabel && n.Namespace() == "" && !l.usedLabels[n] {
+			l.warnf(n.Label(), "label :%s is never used", n.LabelWord())
+		}
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		fi, li, ci := l.problems[i].Location.SourceLocation()
+		fj, lj, cj := l.problems[j].Location.SourceLocation()
+		if fi != fj {
+			return fi < fj
+		}
+		if li != lj {
+			return li < lj
+		}
+		return ci < cj
+	})
+	return l.problems
+}
+
+func (l *linter) checkNode(n *compast.Node) {
+	if n.Template() != nil {
+		return // Instances of parameterized labels are checked as their templates.
+	}
+
+	switch n.NodeType() {
+	case compast.NodeCall, compast.NodeCommand:
+		if n.Label() != nil {
+			if target := n.FindLabeledNode(n.LabelWord()); target != nil {
+				l.usedLabels[target] = true
+				if target.Template() != nil {
+					l.usedLabels[target.Template()] = true
+				}
+			} else {
+				l.fatalf(n.Label(), "undefined label :%s", n.LabelWord())
+			}
+		}
+
+	case compast.NodeBreak, compast.NodeContinue:
+		if n.Label() != nil {
+			// Ensure any of parent nodes has the label.
+			if !findParentForLabel(n.LabelWord(), n) {
+				l.fatalf(n.Label(), "label :%s doesn't exist in the parents", n.LabelWord())
+			}
+		} else if !hasParent(n, compast.NodeLoop, compast.NodeSwitchLoop) && !hasParent(n, compast.NodeLabel) {
+			// Under a @label, it may be called from a loop.
+			l.errorf(n.SelfToken(), "%s must be in a @loop or a @switchloop", n.SelfToken().RawWord)
+		}
+
+	case compast.NodeGoCall, compast.NodeCandidate:
+		if err := compfunc.Defined(n.FuncName().Word); err != nil {
+			l.fatalf(n.FuncName(), "%s", err.Error())
+		}
+
+	case compast.NodeIf:
+		args := n.Args()
+		switch strings.TrimPrefix(n.Condition().Word, "!") {
+		case "word":
+			if _, err := regexp.Compile(args[0]); err != nil {
+				l.errorf(n.Condition(), "invalid regex %q: %s", args[0], err)
+			}
+		case "go":
+			if err := compfunc.PredicateDefined(args[0]); err != nil {
+				l.fatalf(n.Condition(), "%s", err.Error())
+			}
+		}
+		if n.Child() == nil {
+			l.errorf(n.SelfToken(), "%s must have at least one child", n.SelfToken().RawWord)
+		}
+
+	case compast.NodeSwitch, compast.NodeSwitchLoop, compast.NodeLoop:
+		if n.Pattern() != nil {
+			if _, err := regexp.Compile(n.Pattern().Word); err != nil {
+				l.errorf(n.Pattern(), "invalid regex %q: %s", n.Pattern().Word, err)
+			}
+		}
+		if n.Child() == nil {
+			l.errorf(n.SelfToken(), "%s must have at least one child", n.SelfToken().RawWord)
+		}
+	}
+
+	l.checkChildren(n)
+
+	for c := n.Child(); c != nil; c = c.Next() {
+		l.checkNode(c)
+	}
+}
+
+// checkChildren checks the relationship between the children of a node.
+func (l *linter) checkChildren(n *compast.Node) {
+	inSwitch := n.NodeType() == compast.NodeSwitch || n.NodeType() == compast.NodeSwitchLoop
+
+	// Literals seen in the switch.
+	literals := make(map[string]bool)
+
+	// The last node that prevents the following nodes from being executed or matched.
+	var blocker *compast.Node
+
+	for c := n.Child(); c != nil; c = c.Next() {
+		switch c.NodeType() {
+		case compast.NodeLabel, compast.NodeCommand, compast.NodeGroup:
+			continue
+		}
+		if blocker != nil {
+			switch blocker.NodeType() {
+			case compast.NodeFinish, compast.NodeBreak, compast.NodeContinue:
+				l.warnf(c.SelfToken(), "unreachable after %s at line %d", blocker.SelfToken().RawWord, blocker.SelfToken().Line)
+			default:
+				l.warnf(c.SelfToken(), "never matches because %s at line %d always matches", blocker.SelfToken().RawWord, blocker.SelfToken().Line)
+			}
+			// Only report the first one.
+			return
+		}
+
+		switch c.NodeType() {
+		case compast.NodeFinish, compast.NodeBreak, compast.NodeContinue:
+			blocker = c
+		case compast.NodeAny, compast.NodeGoCall:
+			if inSwitch {
+				blocker = c
+			}
+		case compast.NodeLiteral:
+			if inSwitch {
+				for _, cand := range c.AsCandidates() {
+					if literals[cand.Value()] {
+						l.warnf(c.SelfToken(), "duplicate literal %q in the same switch", cand.Value())
+					}
+					literals[cand.Value()] = true
+				}
+			}
+		}
+	}
+}
+
+func hasParent(n *compast.Node, nodeTypes ...int) bool {
+	for p := n.Parent(); p != nil && !p.IsRoot(); p = p.Parent() {
+		for _, t := range nodeTypes {
+			if p.NodeType() == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func findParentForLabel(label string, n *compast.Node) bool {
+	for p := n.Parent(); p != nil && !p.IsRoot(); p = p.Parent() {
+		if p.LabelWord() == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []string
+	}{
+		{"@switch\n  a\n  b\n", []string{}},
+
+		// Errors.
+		{"@call :x\n", []string{"x:1:7: error: undefined label :x"}},
+		{"@loop\n  @break :x\n", []string{"x:2:10: error: label :x doesn't exist in the parents"}},
+		{"@break\n", []string{"x:1:1: error: @break must be in a @loop or a @switchloop"}},
+		{"@cand noSuchFunc\n", []string{"x:1:7: error: function \"noSuchFunc\" not defined"}},
+		{"@switch \"[\"\n  a\n", []string{"x:1:9: error: invalid regex \"[\": error parsing regexp: missing closing ]: `[`"}},
+		{"@switch\n@loop\n  a\n", []string{"x:1:1: error: @switch must have at least one child"}},
+		{"@if word \"[\"\n  a\n", []string{"x:1:5: error: invalid regex \"[\": error parsing regexp: missing closing ]: `[`"}},
+		{"@if !go noSuchPredicate\n  a\n", []string{"x:1:5: error: predicate \"noSuchPredicate\" not defined"}},
+		{"@if env HOME\n", []string{"x:1:1: error: @if must have at least one child"}},
+
+		// Multiple errors are reported at once.
+		{"@call :x\n@call :y\n", []string{
+			"x:1:7: error: undefined label :x",
+			"x:2:7: error: undefined label :y",
+		}},
+
+		// Warnings.
+		{"@loop\n  @break\n  a\n", []string{"x:3:3: warning: unreachable after @break at line 2"}},
+		{"@switch\n  @any\n  a\n  b\n", []string{"x:3:3: warning: never matches because @any at line 2 always matches"}},
+		{"@switch\n  a|b\n  c\n  b\n", []string{"x:4:3: warning: duplicate literal \"b\" in the same switch"}},
+		{"a\n@label :x\n  b\n", []string{"x:2:8: warning: label :x is never used"}},
+
+		// Labels used by @call aren't reported; @break in a label may be called from a loop.
+		{"@loop\n  @call :x\n@label :x\n  @break\n", []string{}},
+
+		// Parse errors.
+		{"@switch\n    a\n  b\n", []string{"x:3:3: error: inconsistent indent for token \"b\", expected column is 1"}},
+		{"@if\n  a\n", []string{"x:2:3: error: @if must be followed by a condition: env NAME, file PATH, word PATTERN or go FUNCTION [ARGS...]"}},
+		{"@if env A B\n  a\n", []string{"x:1:5: error: @if env takes 1 argument, but 2 given"}},
+		{"@if go\n  a\n", []string{"x:1:5: error: @if go must be followed by a predicate name"}},
+		{"@if exists x\n  a\n", []string{"x:1:5: error: unknown condition \"exists\", which must be env, file, word or go, optionally with !"}},
+	}
+	for _, v := range tests {
+		actual := make([]string, 0)
+		for _, p := range Lint(v.spec, compromise.NewDirectives().SetFilename("x")) {
+			actual = append(actual, p.String())
+		}
+		assert.Equal(t, v.expected, actual, "%q", v.spec)
+	}
+}
+
+func TestParseRejectsLintErrors(t *testing.T) {
+	assert.Panics(t, func() { Parse("@call :x\n", compromise.NewDirectives()) })
+	assert.Panics(t, func() { Parse("@loop\n  @break :x\n", compromise.NewDirectives()) })
+	assert.Panics(t, func() { Parse("@cand noSuchFunc\n", compromise.NewDirectives()) })
+
+	// Other errors are only reported by Lint.
+	assert.NotPanics(t, func() { Parse("@switch\n@loop\n  a\n", compromise.NewDirectives()) })
+	assert.NotPanics(t, func() { Parse("@break\n", compromise.NewDirectives()) })
+	assert.NotPanics(t, func() { Parse("@switch \"[\"\n  a\n", compromise.NewDirectives()) })
+
+	// Warnings don't fail parsing.
+	assert.NotPanics(t, func() { Parse("a\n@label :x\n  b\n", compromise.NewDirectives()) })
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestOnceAndExclusive(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	spec := "@switchloop\n" +
+		"  -a\n" +
+		"    @once\n" +
+		"    @exclusive :x\n" +
+		"    @any\n" +
+		"  -b\n" +
+		"    @exclusive :x\n"
+
+	dump := regexp.MustCompile(`#\d+ `).ReplaceAllString(Parse(spec, d).Dump(true), "")
+	assert.Equal(t, `[0] Root:
+  [1] SwitchLoop:
+    [2] Literal: literal="-a" exclusive="x" once
+      [3] Any:
+    [2] Literal: literal="-b" exclusive="x"
+`, dump)
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"@once\n", "@once must be a child of a branch at x:1:1"},
+		{"@label :x\n  @once\n", "@once must be a child of a branch at x:2:3"},
+		{"a\n  @exclusive\n", "@exclusive must be followed by a group name (:name) at x:3:1"},
+		{"a\n  @exclusive :x\n  @exclusive :y\n", "a branch can only be in one @exclusive group at x:3:3"},
+		{"a\n  @once\n    b\n", "@once takes no children at x:3:5"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
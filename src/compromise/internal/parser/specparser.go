@@ -3,11 +3,12 @@ package parser
 import (
 	"github.com/omakoto/compromise/src/compromise"
 	"github.com/omakoto/compromise/src/compromise/compast"
-	"github.com/omakoto/compromise/src/compromise/compfunc"
 	"github.com/omakoto/compromise/src/compromise/internal/parser/tokenizer"
 	"github.com/omakoto/go-common/src/common"
+	"strings"
 )
 
+// parser parses a single spec fragment.
 type parser struct {
 	// Source string.
 	source string
@@ -16,22 +17,38 @@ type parser struct {
 	lastToken *compast.Token
 
 	directives *compromise.Directives
+
+	// Namespace of the fragment. "" for the main spec.
+	namespace string
+
+	loader *loader
 }
 
 func Parse(spec string, d *compromise.Directives) *compast.Node {
-	p := &parser{source: spec, directives: d}
-
-	return p.parse()
+	root := load(spec, d).root
+	sanityCheck(root)
+	return root
 }
 
-func (p *parser) parse() *compast.Node {
+// parse adds the nodes in the fragment to the tree, and then loads the included files.
+func (p *parser) parse() {
+	if format := StructuredFormat(p.directives); format != "" {
+		p.parseStructured(format)
+		return
+	}
 	t := tokenizer.NewTokenizer(p.source, p.directives)
 
 	lastLineStartColumn := 0
 	columns := make([]int, 0) // Used to detect to go back indents.
 	depth := 0
 
-	root := compast.NewRoot()
+	// Files included by the fragment, which are loaded after the fragment.
+	includes := make([]func(), 0)
+
+	// Directives that aren't nodes, such as @include, at each depth. They take no children.
+	nonNodes := make(map[int]*compast.Token)
+
+	root := p.loader.root
 	nodeStack := make([]*compast.Node, 0)
 	nodeStack = append(nodeStack, root)
 
@@ -84,6 +101,10 @@ func (p *parser) parse() *compast.Node {
 
 		common.Debugf("%3d> (%2d,%2d) [%d] [%s] [%s]\n", depth, tok.Line, tok.Column, tok.TokenType, tok.Word, tok.RawWord)
 
+		if p.namespace != "" && depth == 1 && (tok.TokenType != compast.TokenCommand || (tok.Word != "label" && tok.Word != "include")) {
+			panic(compromise.NewSpecError(tok, "only @label and @include can appear at the top level of a spec fragment"))
+		}
+
 		var n *compast.Node
 
 		//newNode := func(nodeType int, args ...*compast.Token) *compast.Node {
@@ -111,11 +132,21 @@ func (p *parser) parse() *compast.Node {
 					panic(compromise.NewSpecError(tok, "@label must be at the toplevel"))
 				}
 
-				const err = "@label must be followed by a label name (:name)"
+				const err = "@label must be followed by a label name (:name), and optionally parameters ($name) and a help string (#...)"
 				label := t.MustGetNextTokenInLine(compast.TokenLabel, err)
+				var help *compast.Token
+				params := make([]*compast.Token, 0)
+				for _, a := range t.MaybeGetArgsAndHelpToken() {
+					if a.TokenType == compast.TokenHelp {
+						help = a
+						continue
+					}
+					params = append(params, a)
+				}
+				checkParams(params)
 				common.Debugf("* Label %s", label.Word)
 
-				n = compast.NewLabel(tok, label)
+				n = compast.NewLabel(tok, label, help, params)
 
 			//case "jump":
 			//	const err = "@jump must be followed by a label name (:name)"
@@ -124,12 +155,62 @@ func (p *parser) parse() *compast.Node {
 			//
 			//	n = compast.NewJump(tok, label)
 
+			case "include":
+				if depth != 1 {
+					panic(compromise.NewSpecError(tok, "@include must be at the toplevel"))
+				}
+
+				const err = "@include must be followed by a filename and optionally a namespace (:name)"
+				path := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				namespace := t.MaybeGetLabel()
+				t.MustHaveNoTokenInLine()
+				common.Debugf("* Include %s", path.Word)
+
+				if p.loader.keepIncludes {
+					p.keepInclude(tok, path, namespace)
+				} else {
+					includes = append(includes, func() {
+						p.loader.include(path, namespace, p.directives)
+					})
+				}
+
+				// Not a node, and takes no children.
+				nodeStack[depth] = nil
+				nonNodes[depth] = tok
+				continue
+
+			case "once", "exclusive", "joined", "bundle":
+				branch := nodeStack[depth-1]
+				if depth == 1 || branch == nil || branch.NodeType() == compast.NodeLabel {
+					panic(compromise.NewSpecErrorf(tok, "%s must be a child of a branch", tok.RawWord))
+				}
+				var group *compast.Token
+				if tok.Word == "exclusive" {
+					const err = "@exclusive must be followed by a group name (:name)"
+					group = t.MustGetNextTokenInLine(compast.TokenLabel, err)
+				}
+				t.MustHaveNoTokenInLine()
+				common.Debugf("* Branch option: %s", tok.Word)
+
+				applyBranchOption(tok, branch, group)
+
+				// Not a node, and takes no children.
+				nodeStack[depth] = nil
+				nonNodes[depth] = tok
+				continue
+
 			case "call":
-				const err = "@call must be followed by a label name (:name)"
+				const err = "@call must be followed by a label name (:name) and optionally arguments"
 				label := t.MustGetNextTokenInLine(compast.TokenLabel, err)
+				args := t.MaybeGetArgsAndHelpToken()
+				for _, a := range args {
+					if a.TokenType != compast.TokenLiteral {
+						panic(compromise.NewSpecError(a, "Only string literals may appear here"))
+					}
+				}
 				common.Debugf("* Jump to %s", label.Word)
 
-				n = compast.NewCall(tok, label)
+				n = compast.NewCall(tok, label, args)
 
 			case "finish":
 				common.Debugf("* Action: finish")
@@ -177,6 +258,45 @@ func (p *parser) parse() *compast.Node {
 
 				n = compast.NewAny(tok, help)
 
+			case "group":
+				const err = "@group must be followed by a group name (any string)"
+				group := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				t.MustHaveNoTokenInLine()
+				common.Debugf("* Group: %s", group.Word)
+
+				n = compast.NewGroup(tok, group)
+
+			case "if":
+				const err = "@if must be followed by a condition: env NAME, file PATH, word PATTERN or go FUNCTION [ARGS...]"
+				condition := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				args := t.MaybeGetArgsAndHelpToken()
+				for _, a := range args {
+					if a.TokenType != compast.TokenLiteral {
+						panic(compromise.NewSpecError(a, "Only string literals may appear here"))
+					}
+				}
+				checkCondition(condition, args)
+				common.Debugf("* If: %s", condition.Word)
+
+				n = compast.NewIf(tok, condition, args)
+
+			case "set":
+				const err = "@set must be followed by a name and a value"
+				name := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				value := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				t.MustHaveNoTokenInLine()
+				common.Debugf("* Set: %s to %s", name.Word, value.Word)
+
+				n = compast.NewSet(tok, name, value)
+
+			case "capture":
+				const err = "@capture must be followed by a name"
+				name := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				t.MustHaveNoTokenInLine()
+				common.Debugf("* Capture: %s", name.Word)
+
+				n = compast.NewCapture(tok, name)
+
 			case "go_call":
 				const err = "@go_call must be followed by a function name"
 				funcName := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
@@ -185,6 +305,22 @@ func (p *parser) parse() *compast.Node {
 				n = compast.NewGoCall(tok, funcName, args)
 
 				common.Debugf("* Action: go_call to %s", funcName)
+			case "exec":
+				const err = "@exec must be followed by a command"
+				command := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				help := t.MaybeGetHelpToken()
+				common.Debugf("* Action: candidates from command %s", command.Word)
+
+				n = compast.NewExec(tok, command, help)
+
+			case "lines":
+				const err = "@lines must be followed by a file path"
+				path := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
+				help := t.MaybeGetHelpToken()
+				common.Debugf("* Action: candidates from file %s", path.Word)
+
+				n = compast.NewLines(tok, path, help)
+
 			case "cand":
 				const err = "@cand must be followed by a function name"
 				funcName := t.MustGetNextTokenInLine(compast.TokenLiteral, err)
@@ -205,49 +341,101 @@ func (p *parser) parse() *compast.Node {
 			panic(compromise.NewSpecErrorf(tok, "Unexpected token: %s", tok))
 		}
 
+		if nodeStack[depth-1] == nil {
+			panic(compromise.NewSpecErrorf(tok, "%s takes no children", nonNodes[depth-1].RawWord))
+		}
+		n.SetNamespace(p.namespace)
 		nodeStack[depth-1].AddChild(n)
 		nodeStack[depth] = n
 	}
-	p.sanityCheck(root)
-	return root
+
+	for _, include := range includes {
+		include()
+	}
 }
 
-func (p *parser) sanityCheck(n *compast.Node) {
-	if n == nil {
-		return
+// keepInclude records an @include, which is placed after the nodes that are already parsed.
+func (p *parser) keepInclude(tok, path, namespace *compast.Token) {
+	file, line, column := tok.SourceLocation()
+	n := &StructuredNode{Location: Location{file, line, column}, Type: "include", Words: []string{path.Word}}
+	if namespace != nil {
+		n.Label = namespace.Word
 	}
-	switch n.NodeType() {
-	case compast.NodeCall, compast.NodeCommand:
-		if n.Label() != nil {
-			if n.Root().GetLabeledNode(n.LabelWord(), n.SelfToken()) == nil {
-				panic(compromise.NewSpecErrorf(n.SelfToken(), "label %s doesn't exist", n.LabelWord()))
-			}
+	var after *compast.Node
+	for c := p.loader.root.Child(); c != nil; c = c.Next() {
+		after = c
+	}
+	p.loader.includes = append(p.loader.includes, &keptInclude{n, after})
+}
+
+// checkParams panics if the parameters of a label aren't valid, i.e. not $name, or duplicate.
+func checkParams(params []*compast.Token) {
+	for i, a := range params {
+		if !paramRe.MatchString(a.Word) {
+			panic(compromise.NewSpecErrorf(a, "invalid parameter %s, which must be $name", a.RawWord))
 		}
-	case compast.NodeBreak, compast.NodeContinue:
-		if n.Label() != nil {
-			// Ensure any of parent nodes has the label.
-			if !findParentForLabel(n.LabelWord(), n) {
-				panic(compromise.NewSpecErrorf(n.SelfToken(), "label %s doesn't exist", n.LabelWord()))
+		for _, other := range params[:i] {
+			if other.Word == a.Word {
+				panic(compromise.NewSpecErrorf(a, "duplicate parameter %s", a.RawWord))
 			}
 		}
+	}
+}
 
-	case compast.NodeGoCall, compast.NodeCandidate:
-		if compfunc.Defined(n.FuncName().Word) != nil {
-			panic(compromise.NewSpecErrorf(n.SelfToken(), "function %s isn't registered", n.Literal()))
+// checkCondition panics if the condition of an @if, e.g. "env" or "!file", is unknown, or doesn't
+// have the right number of arguments.
+func checkCondition(condition *compast.Token, args []*compast.Token) {
+	switch kind := strings.TrimPrefix(condition.Word, "!"); kind {
+	case "env", "file", "word":
+		if len(args) != 1 {
+			panic(compromise.NewSpecErrorf(condition, "@if %s takes 1 argument, but %d given", kind, len(args)))
 		}
-	}
-	for c := n.Child(); c != nil; c = c.Next() {
-		p.sanityCheck(c)
+	case "go":
+		if len(args) == 0 {
+			panic(compromise.NewSpecError(condition, "@if go must be followed by a predicate name"))
+		}
+	default:
+		panic(compromise.NewSpecErrorf(condition, "unknown condition %q, which must be env, file, word or go, optionally with !", condition.Word))
 	}
 }
 
-func findParentForLabel(label string, n *compast.Node) bool {
-	p := n.Parent()
-	if p.IsRoot() {
-		return false
+// applyBranchOption applies @once, @exclusive (with a group), @joined or @bundle to a branch,
+// and panics if it doesn't apply to the branch.
+func applyBranchOption(tok *compast.Token, branch *compast.Node, group *compast.Token) {
+	switch tok.Word {
+	case "once":
+		branch.SetOnce()
+	case "exclusive":
+		if branch.Exclusive() != nil {
+			panic(compromise.NewSpecError(tok, "a branch can only be in one @exclusive group"))
+		}
+		branch.SetExclusive(group)
+	default:
+		if branch.NodeType() != compast.NodeLiteral {
+			panic(compromise.NewSpecErrorf(tok, "%s must be a child of a literal", tok.RawWord))
+		}
+		for _, c := range branch.AsCandidates() {
+			if tok.Word == "bundle" && !compast.IsShortFlag(c.Value()) {
+				panic(compromise.NewSpecErrorf(tok, "@bundle only applies to short flags such as -a, but %q isn't", c.Value()))
+			}
+			if !strings.HasPrefix(c.Value(), "-") {
+				panic(compromise.NewSpecErrorf(tok, "%s only applies to flags, but %q isn't", tok.RawWord, c.Value()))
+			}
+		}
+		if tok.Word == "joined" {
+			branch.SetJoined()
+		} else {
+			branch.SetBundle()
+		}
 	}
-	if p.LabelWord() == label {
-		return true
+}
+
+// sanityCheck panics on the first error that the engine can't run with, such as an undefined label.
+// Other errors and warnings are only reported by Lint.
+func sanityCheck(root *compast.Node) {
+	for _, problem := range lint(root) {
+		if problem.fatal {
+			panic(problem.SpecError)
+		}
 	}
-	return findParentForLabel(label, p)
 }
@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestSetAndCapture(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	spec := "-d\n" +
+		"  @set target -d\n" +
+		"@any\n" +
+		"@capture serial\n"
+
+	dump := regexp.MustCompile(`#\d+ `).ReplaceAllString(Parse(spec, d).Dump(true), "")
+	assert.Equal(t, `[0] Root:
+  [1] Literal: literal="-d"
+    [2] Set: args=["target", "-d"]
+  [1] Any:
+  [1] Capture: args=["serial"]
+`, dump)
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"@set target\n", "@set must be followed by a name and a value at x:2:1"},
+		{"@set target -d -e\n", "excessive token detected at x:1:16"},
+		{"@capture\n", "@capture must be followed by a name at x:2:1"},
+		{"@set a b\n  x\n", "\"@set\" takes no children at x:1:1"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
@@ -0,0 +1,425 @@
+package parser
+
+// Structured specs, which describe the same nodes as text specs in JSON or YAML, e.g.
+//
+//   [
+//     {"type": "command", "name": "adb"},
+//     {"type": "switch", "children": [
+//       {"type": "literal", "words": "devices", "help": "List devices"},
+//       {"type": "literal", "words": ["push", "pull"], "children": [{"type": "cand", "func": "takeFile"}]},
+//       "kill-server"
+//     ]}
+//   ]
+//
+// A spec is a list of nodes. Each node is an object with a "type", which is "literal" or the name
+// of a directive, and the keys of its operands, which are listed in structuredSchemas. A string
+// is a literal without a help. A branch has the branch options as keys, e.g. "once": true or
+// "exclusive": "group", instead of @once and @exclusive children.
+
+import (
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/omakoto/compromise/src/compromise/internal/parser/tokenizer"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Location is a location in a spec, or in Go code for specs built with compspec.
+type Location struct {
+	File         string
+	Line, Column int
+}
+
+var _ compromise.SourceLocation = Location{}
+
+func (l Location) SourceLocation() (string, int, int) {
+	return l.File, l.Line, l.Column
+}
+
+// token returns a token at the location.
+func (l Location) token(tokenType int, word string) *compast.Token {
+	raw := word
+	switch tokenType {
+	case compast.TokenCommand:
+		raw = "@" + word
+	case compast.TokenLabel:
+		raw = ":" + word
+	case compast.TokenHelp:
+		raw = "# " + word
+	case compast.TokenLiteral:
+		raw = strconv.Quote(word)
+	}
+	return &compast.Token{TokenType: tokenType, Word: word, RawWord: raw, SourceFile: l.File, Line: l.Line, Column: l.Column}
+}
+
+// StructuredOption is a branch option, i.e. @once, @exclusive, @joined or @bundle.
+type StructuredOption struct {
+	Location
+	Name  string
+	Group string // Group of @exclusive, without ":".
+}
+
+// StructuredNode is a node of a structured spec.
+type StructuredNode struct {
+	Location
+	Type string // "literal", or a directive name, e.g. "switch".
+
+	Words []string // Alternatives of a literal, or operands of a directive.
+	Label string   // Label of @command, @label, @call, etc, or namespace of @include, without ":".
+	Help  string
+
+	Options  []*StructuredOption
+	Children []*StructuredNode
+}
+
+// structuredSchema describes the keys of a node type.
+type structuredSchema struct {
+	operands []string // Keys of the operands in Words, in order.
+	rest     string   // Key of the list of the other operands in Words, e.g. "args".
+	label    string   // Key of Label.
+	help     bool
+}
+
+var structuredSchemas = map[string]*structuredSchema{
+	"literal":    {rest: "words", help: true},
+	"command":    {operands: []string{"name"}, label: "label"},
+	"label":      {rest: "params", label: "label", help: true},
+	"include":    {operands: []string{"path"}, label: "namespace"},
+	"call":       {rest: "args", label: "label"},
+	"switch":     {operands: []string{"pattern"}, label: "label"},
+	"switchloop": {operands: []string{"pattern"}, label: "label"},
+	"loop":       {operands: []string{"pattern"}, label: "label"},
+	"break":      {label: "label"},
+	"continue":   {label: "label"},
+	"finish":     {},
+	"any":        {help: true},
+	"cand":       {operands: []string{"func"}, rest: "args"},
+	"go_call":    {operands: []string{"func"}, rest: "args"},
+	"exec":       {operands: []string{"command"}, help: true},
+	"lines":      {operands: []string{"path"}, help: true},
+	"if":         {operands: []string{"condition"}, rest: "args"},
+	"set":        {operands: []string{"name", "value"}},
+	"capture":    {operands: []string{"name"}},
+	"group":      {operands: []string{"name"}},
+}
+
+// StructuredFormat returns "json" or "yaml" for a structured spec, or "" for a text spec. The
+// format directive tells the format, which defaults to the extension of the filename. (The content
+// doesn't tell it; e.g. a text spec may start with a literal "-", like a YAML list.)
+func StructuredFormat(d *compromise.Directives) string {
+	format := d.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(d.Filename)) {
+		case ".json":
+			format = "json"
+		case ".yaml", ".yml":
+			format = "yaml"
+		}
+	}
+	switch format {
+	case "", "text":
+		return ""
+	case "json", "yaml":
+		return format
+	}
+	panic(compromise.NewSpecErrorf(nil, "unsupported spec format %q; must be one of text, json or yaml", format))
+}
+
+// BuildStructured returns a tree of structured nodes, which is checked the same way as Parse,
+// and panics on the first error.
+func BuildStructured(nodes []*StructuredNode) *compast.Node {
+	root := compast.NewRoot()
+	b := &structuredBuilder{}
+	for _, n := range nodes {
+		b.build(n, root, true)
+	}
+	expand(root)
+	sanityCheck(root)
+	return root
+}
+
+// ToStructured returns the nodes of a spec, which may be either a text spec or a structured
+// spec. The included files aren't loaded, and the parameterized labels aren't expanded, so the
+// nodes can be written back as a spec. Comments in text specs are lost.
+func ToStructured(spec string, d *compromise.Directives) []*StructuredNode {
+	if format := StructuredFormat(d); format != "" {
+		return decodeStructured(spec, format, d)
+	}
+	l := newLoader()
+	l.keepIncludes = true
+	p := &parser{source: spec, directives: d, loader: l}
+	p.parse()
+
+	ret := make([]*StructuredNode, 0)
+	addIncludes := func(after *compast.Node) {
+		for _, inc := range l.includes {
+			if inc.after == after {
+				ret = append(ret, inc.node)
+			}
+		}
+	}
+	addIncludes(nil)
+	for c := l.root.Child(); c != nil; c = c.Next() {
+		ret = append(ret, fromTree(c))
+		addIncludes(c)
+	}
+	return ret
+}
+
+// parseStructured adds the nodes in a structured fragment to the tree, and then loads the
+// included files.
+func (p *parser) parseStructured(format string) {
+	includes := make([]func(), 0)
+	b := &structuredBuilder{
+		namespace: p.namespace,
+		include: func(path, namespace *compast.Token) {
+			includes = append(includes, func() {
+				p.loader.include(path, namespace, p.directives)
+			})
+		},
+	}
+	for _, n := range decodeStructured(p.source, format, p.directives) {
+		b.build(n, p.loader.root, true)
+	}
+
+	for _, include := range includes {
+		include()
+	}
+}
+
+// fromTree returns a structured node of a node that's just parsed.
+func fromTree(n *compast.Node) *StructuredNode {
+	file, line, column := n.SelfToken().SourceLocation()
+	s := &StructuredNode{Location: Location{file, line, column}, Help: n.HelpText()}
+
+	switch n.NodeType() {
+	case compast.NodeLiteral:
+		s.Type = "literal"
+		s.Words = []string{n.Literal().Word}
+		if raw := n.Literal().RawWord; !strings.HasPrefix(raw, "\"") && strings.ContainsRune(raw, '|') {
+			s.Words = nil
+			for _, c := range n.AsCandidates() {
+				s.Words = append(s.Words, c.Value())
+			}
+		}
+	case compast.NodeCommand:
+		s.Words = []string{n.Command().Word}
+	case compast.NodeLabel:
+		for _, p := range n.Params() {
+			s.Words = append(s.Words, p.Word)
+		}
+	case compast.NodeSwitch, compast.NodeSwitchLoop, compast.NodeLoop:
+		if n.Pattern() != nil {
+			s.Words = []string{n.Pattern().Word}
+		}
+	case compast.NodeCandidate, compast.NodeGoCall:
+		s.Words = append([]string{n.FuncName().Word}, n.Args()...)
+	case compast.NodeIf:
+		s.Words = append([]string{n.Condition().Word}, n.Args()...)
+	case compast.NodeGroup:
+		s.Words = []string{n.GroupName()}
+	default:
+		// @call, @set, @capture, @exec and @lines have the operands in the arguments.
+		s.Words = n.Args()
+	}
+	if s.Type == "" {
+		s.Type = n.SelfToken().Word
+	}
+	s.Label = n.LabelWord()
+
+	option := func(name string, group *compast.Token) {
+		o := &StructuredOption{Location: s.Location, Name: name}
+		if group != nil {
+			o.Group = group.Word
+		}
+		s.Options = append(s.Options, o)
+	}
+	if n.Once() {
+		option("once", nil)
+	}
+	if n.Exclusive() != nil {
+		option("exclusive", n.Exclusive())
+	}
+	if n.Joined() {
+		option("joined", nil)
+	}
+	if n.Bundle() {
+		option("bundle", nil)
+	}
+
+	for c := n.Child(); c != nil; c = c.Next() {
+		s.Children = append(s.Children, fromTree(c))
+	}
+	return s
+}
+
+// structuredBuilder builds structured nodes into a tree.
+type structuredBuilder struct {
+	// Namespace of the fragment. "" for the main spec.
+	namespace string
+
+	// Called for each @include, or nil if @include isn't allowed.
+	include func(path, namespace *compast.Token)
+}
+
+func (n *StructuredNode) literals(words []string) []*compast.Token {
+	ret := make([]*compast.Token, 0, len(words))
+	for _, w := range words {
+		ret = append(ret, n.token(compast.TokenLiteral, w))
+	}
+	return ret
+}
+
+func (n *StructuredNode) helpToken() *compast.Token {
+	if n.Help == "" {
+		return nil
+	}
+	return n.token(compast.TokenHelp, strings.Join(strings.Fields(n.Help), " "))
+}
+
+func (n *StructuredNode) labelToken() *compast.Token {
+	if n.Label == "" {
+		return nil
+	}
+	return n.token(compast.TokenLabel, n.Label)
+}
+
+// operand returns the i-th operand, or nil.
+func (n *StructuredNode) operand(i int) *compast.Token {
+	if i < len(n.Words) {
+		return n.token(compast.TokenLiteral, n.Words[i])
+	}
+	return nil
+}
+
+// mustHaveOperands panics if the node has fewer than count operands, with the same message as
+// the text parser.
+func (n *StructuredNode) mustHaveOperands(count int, message string) {
+	if len(n.Words) < count || (count > 0 && n.Words[0] == "") {
+		panic(compromise.NewSpecError(n.token(compast.TokenCommand, n.Type), message))
+	}
+}
+
+// mustHaveLabel panics if the node has no label.
+func (n *StructuredNode) mustHaveLabel(message string) {
+	if n.Label == "" {
+		panic(compromise.NewSpecError(n.token(compast.TokenCommand, n.Type), message))
+	}
+}
+
+// build adds a node to the tree under parent.
+func (b *structuredBuilder) build(n *StructuredNode, parent *compast.Node, topLevel bool) {
+	this := n.token(compast.TokenCommand, n.Type)
+	switch n.Type {
+	case "command", "label", "include":
+		if !topLevel {
+			panic(compromise.NewSpecErrorf(this, "@%s must be at the toplevel", n.Type))
+		}
+	}
+	if b.namespace != "" && topLevel && n.Type != "label" && n.Type != "include" {
+		panic(compromise.NewSpecError(this, "only @label and @include can appear at the top level of a spec fragment"))
+	}
+
+	var c *compast.Node
+	switch n.Type {
+	case "literal":
+		if len(n.Words) == 0 {
+			panic(compromise.NewSpecError(n.token(compast.TokenLiteral, ""), "a literal must have a word"))
+		}
+		lit := n.token(compast.TokenLiteral, n.Words[0])
+		if len(n.Words) > 1 {
+			// Alternatives are written as "a|b", which can't be quoted.
+			for _, w := range n.Words {
+				if tokenizer.NeedsQuote(w) {
+					panic(compromise.NewSpecErrorf(lit, "alternative %q of a literal has a special character", w))
+				}
+			}
+			lit.Word = strings.Join(n.Words, "|")
+			lit.RawWord = lit.Word
+		}
+		c = compast.NewLiteral(lit, n.helpToken())
+	case "command":
+		n.mustHaveOperands(1, "@command must be followed by a command name (any string) and optionally a label name (:name)")
+		c = compast.NewCommand(this, n.operand(0), n.labelToken())
+	case "label":
+		n.mustHaveLabel("@label must be followed by a label name (:name), and optionally parameters ($name) and a help string (#...)")
+		params := n.literals(n.Words)
+		checkParams(params)
+		c = compast.NewLabel(this, n.labelToken(), n.helpToken(), params)
+	case "include":
+		n.mustHaveOperands(1, "@include must be followed by a filename and optionally a namespace (:name)")
+		if b.include == nil {
+			panic(compromise.NewSpecError(this, "@include can only be used in a spec file"))
+		}
+		if len(n.Options) > 0 || len(n.Children) > 0 {
+			panic(compromise.NewSpecErrorf(this, "%s takes no children", this.RawWord))
+		}
+		b.include(n.operand(0), n.labelToken())
+		return
+	case "call":
+		n.mustHaveLabel("@call must be followed by a label name (:name) and optionally arguments")
+		c = compast.NewCall(this, n.labelToken(), n.literals(n.Words))
+	case "switch":
+		c = compast.NewSwitch(this, n.operand(0), n.labelToken())
+	case "switchloop":
+		c = compast.NewSwitchLoop(this, n.operand(0), n.labelToken())
+	case "loop":
+		c = compast.NewLoop(this, n.operand(0), n.labelToken())
+	case "break":
+		c = compast.NewBreak(this, n.labelToken())
+	case "continue":
+		c = compast.NewContinue(this, n.labelToken())
+	case "finish":
+		c = compast.NewFinish(this)
+	case "any":
+		c = compast.NewAny(this, n.helpToken())
+	case "cand":
+		n.mustHaveOperands(1, "@cand must be followed by a function name")
+		c = compast.NewCandidate(this, n.operand(0), n.literals(n.Words[1:]))
+	case "go_call":
+		n.mustHaveOperands(1, "@go_call must be followed by a function name")
+		c = compast.NewGoCall(this, n.operand(0), n.literals(n.Words[1:]))
+	case "exec":
+		n.mustHaveOperands(1, "@exec must be followed by a command")
+		c = compast.NewExec(this, n.operand(0), n.helpToken())
+	case "lines":
+		n.mustHaveOperands(1, "@lines must be followed by a file path")
+		c = compast.NewLines(this, n.operand(0), n.helpToken())
+	case "if":
+		n.mustHaveOperands(1, "@if must be followed by a condition: env NAME, file PATH, word PATTERN or go FUNCTION [ARGS...]")
+		condition := n.operand(0)
+		args := n.literals(n.Words[1:])
+		checkCondition(condition, args)
+		c = compast.NewIf(this, condition, args)
+	case "set":
+		n.mustHaveOperands(2, "@set must be followed by a name and a value")
+		c = compast.NewSet(this, n.operand(0), n.operand(1))
+	case "capture":
+		n.mustHaveOperands(1, "@capture must be followed by a name")
+		c = compast.NewCapture(this, n.operand(0))
+	case "group":
+		n.mustHaveOperands(1, "@group must be followed by a group name (any string)")
+		c = compast.NewGroup(this, n.operand(0))
+	default:
+		panic(compromise.NewSpecErrorf(this, "unexpected command %s", this))
+	}
+	c.SetNamespace(b.namespace)
+	parent.AddChild(c)
+
+	for _, o := range n.Options {
+		tok := o.token(compast.TokenCommand, o.Name)
+		// Same as text specs, where an option is a child of the node it applies to.
+		if c.NodeType() == compast.NodeLabel {
+			panic(compromise.NewSpecErrorf(tok, "%s must be a child of a branch", tok.RawWord))
+		}
+		var group *compast.Token
+		if o.Name == "exclusive" {
+			group = o.token(compast.TokenLabel, o.Group)
+		}
+		applyBranchOption(tok, c, group)
+	}
+	for _, child := range n.Children {
+		b.build(child, c, false)
+	}
+}
@@ -0,0 +1,455 @@
+package parser
+
+// Decoding and encoding structured specs in JSON and YAML.
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
+	"gopkg.in/yaml.v3"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	valueNull = iota
+	valueScalar
+	valueBool
+	valueList
+	valueMap
+)
+
+// structuredValue is a value in a JSON or YAML document, with its location.
+type structuredValue struct {
+	Location
+	kind int
+
+	// Text of a scalar, which is a string, a number or a boolean.
+	text string
+
+	list []*structuredValue
+
+	// Keys and values of a map, in order.
+	keys, values []*structuredValue
+}
+
+func (v *structuredValue) error(format string, args ...interface{}) {
+	panic(compromise.NewSpecErrorf(v.Location, format, args...))
+}
+
+// mustString returns the text of a scalar. Numbers and booleans are strings too, which is how
+// YAML reads words such as "1" and "true" without quotes.
+func (v *structuredValue) mustString(key string) string {
+	if v.kind != valueScalar && v.kind != valueBool {
+		v.error("%q must be a string", key)
+	}
+	return v.text
+}
+
+// mustStrings returns the texts of a list of scalars, or a single scalar.
+func (v *structuredValue) mustStrings(key string) []string {
+	if v.kind != valueList {
+		return []string{v.mustString(key)}
+	}
+	ret := make([]string, 0, len(v.list))
+	for _, e := range v.list {
+		ret = append(ret, e.mustString(key))
+	}
+	return ret
+}
+
+func (v *structuredValue) mustBool(key string) bool {
+	if v.kind != valueBool {
+		v.error("%q must be true or false", key)
+	}
+	return v.text == "true"
+}
+
+// decodeStructured decodes a structured spec, and panics if it's not valid.
+func decodeStructured(source, format string, d *compromise.Directives) []*StructuredNode {
+	// Replace the directives with spaces, so that the locations don't change.
+	if strings.HasPrefix(source, "//") {
+		end := strings.IndexByte(source, '\n')
+		if end < 0 {
+			end = len(source)
+		}
+		source = strings.Repeat(" ", end) + source[end:]
+	}
+
+	var v *structuredValue
+	if format == "json" {
+		v = decodeJSON(source, d)
+	} else {
+		v = decodeYAML(source, d)
+	}
+	if v.kind == valueNull {
+		return nil
+	}
+	if v.kind != valueList {
+		v.error("a structured spec must be a list of nodes")
+	}
+	ret := make([]*StructuredNode, 0, len(v.list))
+	for _, e := range v.list {
+		ret = append(ret, toStructuredNode(e))
+	}
+	return ret
+}
+
+func toStructuredNode(v *structuredValue) *StructuredNode {
+	n := &StructuredNode{Location: v.Location}
+	if v.kind == valueScalar {
+		n.Type = "literal"
+		n.Words = []string{v.text}
+		return n
+	}
+	if v.kind != valueMap {
+		v.error("a node must be an object or a string")
+	}
+
+	for i, k := range v.keys {
+		if k.text == "type" {
+			n.Type = v.values[i].mustString("type")
+		}
+	}
+	schema, ok := structuredSchemas[n.Type]
+	if !ok {
+		if n.Type == "" {
+			v.error("a node must have a \"type\"")
+		}
+		types := make([]string, 0, len(structuredSchemas))
+		for t := range structuredSchemas {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		v.error("unknown type %q, which must be one of: %s", n.Type, strings.Join(types, ", "))
+	}
+
+	operands := make([]*string, len(schema.operands))
+	var rest []string
+	for i, k := range v.keys {
+		key, value := k.text, v.values[i]
+		if value.kind == valueNull {
+			continue
+		}
+		switch {
+		case key == "type":
+		case key == "help" && schema.help:
+			n.Help = value.mustString(key)
+		case key == "children":
+			if value.kind != valueList {
+				value.error("\"children\" must be a list of nodes")
+			}
+			for _, c := range value.list {
+				n.Children = append(n.Children, toStructuredNode(c))
+			}
+		case key == "exclusive":
+			group := strings.TrimPrefix(value.mustString(key), ":")
+			n.Options = append(n.Options, &StructuredOption{Location: k.Location, Name: key, Group: group})
+		case key == "once" || key == "joined" || key == "bundle":
+			if value.mustBool(key) {
+				n.Options = append(n.Options, &StructuredOption{Location: k.Location, Name: key})
+			}
+		case key == schema.label:
+			n.Label = strings.TrimPrefix(value.mustString(key), ":")
+		case key == schema.rest:
+			rest = value.mustStrings(key)
+		default:
+			found := false
+			for j, o := range schema.operands {
+				if key == o {
+					s := value.mustString(key)
+					operands[j] = &s
+					found = true
+				}
+			}
+			if !found {
+				k.error("unknown key %q for type %q", key, n.Type)
+			}
+		}
+	}
+
+	for i, o := range operands {
+		if o == nil {
+			// Later operands need the earlier ones.
+			for j := i + 1; j < len(operands); j++ {
+				if operands[j] != nil {
+					v.error("type %q needs %q with %q", n.Type, schema.operands[i], schema.operands[j])
+				}
+			}
+			break
+		}
+		n.Words = append(n.Words, *o)
+	}
+	if len(n.Words) == len(schema.operands) {
+		n.Words = append(n.Words, rest...)
+	} else if len(rest) > 0 {
+		v.error("type %q needs %q with %q", n.Type, schema.operands[len(n.Words)], schema.rest)
+	}
+	return n
+}
+
+// lineStarts returns the offsets of the lines in a source.
+func lineStarts(source string) []int {
+	ret := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			ret = append(ret, i+1)
+		}
+	}
+	return ret
+}
+
+// jsonReader reads JSON values with their locations.
+type jsonReader struct {
+	source     string
+	dec        *json.Decoder
+	directives *compromise.Directives
+	lines      []int
+}
+
+func decodeJSON(source string, d *compromise.Directives) *structuredValue {
+	dec := json.NewDecoder(strings.NewReader(source))
+	dec.UseNumber()
+	r := &jsonReader{source: source, dec: dec, directives: d, lines: lineStarts(source)}
+
+	v := r.value()
+	offset := r.nextOffset()
+	if _, err := dec.Token(); err != io.EOF {
+		panic(compromise.NewSpecError(r.location(offset), "unexpected data after the spec"))
+	}
+	return v
+}
+
+func (r *jsonReader) location(offset int) Location {
+	if offset > len(r.source) {
+		offset = len(r.source)
+	}
+	line := sort.SearchInts(r.lines, offset+1) - 1
+	column := utf8.RuneCountInString(r.source[r.lines[line]:offset]) + 1
+	return Location{r.directives.Filename, line + r.directives.StartLine, column}
+}
+
+// nextOffset returns the offset of the next token.
+func (r *jsonReader) nextOffset() int {
+	offset := int(r.dec.InputOffset())
+	for offset < len(r.source) && strings.IndexByte(" \t\r\n,:", r.source[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (r *jsonReader) next() (json.Token, Location) {
+	offset := r.nextOffset()
+	tok, err := r.dec.Token()
+	if err != nil {
+		if e, ok := err.(*json.SyntaxError); ok && e.Offset > 0 {
+			offset = int(e.Offset) - 1
+		} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+			offset = len(r.source)
+		}
+		panic(compromise.NewSpecErrorf(r.location(offset), "invalid JSON: %s", err))
+	}
+	return tok, r.location(offset)
+}
+
+func (r *jsonReader) value() *structuredValue {
+	tok, at := r.next()
+	v := &structuredValue{Location: at}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			v.kind = valueList
+			for r.dec.More() {
+				v.list = append(v.list, r.value())
+			}
+		} else {
+			v.kind = valueMap
+			for r.dec.More() {
+				key := r.value()
+				for _, other := range v.keys {
+					if other.text == key.text {
+						key.error("duplicate key %q", key.text)
+					}
+				}
+				v.keys = append(v.keys, key)
+				v.values = append(v.values, r.value())
+			}
+		}
+		r.next() // ']' or '}'
+	case string:
+		v.kind = valueScalar
+		v.text = t
+	case json.Number:
+		v.kind = valueScalar
+		v.text = t.String()
+	case bool:
+		v.kind = valueBool
+		v.text = strconv.FormatBool(t)
+	case nil:
+		v.kind = valueNull
+	}
+	return v
+}
+
+var yamlErrorRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func decodeYAML(source string, d *compromise.Directives) *structuredValue {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(source), &doc); err != nil {
+		at := Location{File: d.Filename}
+		message := err.Error()
+		if m := yamlErrorRe.FindStringSubmatch(message); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			at.Line, at.Column = line+d.StartLine-1, 1
+			message = m[2]
+		}
+		panic(compromise.NewSpecErrorf(at, "invalid YAML: %s", message))
+	}
+	if len(doc.Content) == 0 {
+		return &structuredValue{kind: valueNull}
+	}
+	return fromYAML(doc.Content[0], d)
+}
+
+func fromYAML(n *yaml.Node, d *compromise.Directives) *structuredValue {
+	if n.Kind == yaml.AliasNode {
+		return fromYAML(n.Alias, d)
+	}
+	v := &structuredValue{Location: Location{d.Filename, n.Line + d.StartLine - 1, n.Column}}
+	switch n.Kind {
+	case yaml.SequenceNode:
+		v.kind = valueList
+		for _, c := range n.Content {
+			v.list = append(v.list, fromYAML(c, d))
+		}
+	case yaml.MappingNode:
+		v.kind = valueMap
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.keys = append(v.keys, fromYAML(n.Content[i], d))
+			v.values = append(v.values, fromYAML(n.Content[i+1], d))
+		}
+	default:
+		switch n.ShortTag() {
+		case "!!null":
+			v.kind = valueNull
+		case "!!bool":
+			v.kind = valueBool
+			b := false
+			n.Decode(&b)
+			v.text = strconv.FormatBool(b)
+		default:
+			v.kind = valueScalar
+			v.text = n.Value
+		}
+	}
+	return v
+}
+
+// structuredField is a key and a value of a node to encode, which is a string, a list of
+// strings, true, or a list of nodes.
+type structuredField struct {
+	key   string
+	value interface{}
+}
+
+// fields returns the keys and the values of a node, in the order of the schema.
+func (n *StructuredNode) fields() []structuredField {
+	schema := structuredSchemas[n.Type]
+	if schema == nil {
+		// Unknown types are only written back.
+		schema = &structuredSchema{}
+	}
+	ret := []structuredField{{"type", n.Type}}
+	words := n.Words
+	for _, o := range schema.operands {
+		if len(words) == 0 {
+			break
+		}
+		ret = append(ret, structuredField{o, words[0]})
+		words = words[1:]
+	}
+	if n.Label != "" {
+		ret = append(ret, structuredField{schema.label, n.Label})
+	}
+	if schema.rest != "" && len(words) > 0 {
+		if n.Type == "literal" && len(words) == 1 {
+			ret = append(ret, structuredField{schema.rest, words[0]})
+		} else {
+			ret = append(ret, structuredField{schema.rest, words})
+		}
+	}
+	if n.Help != "" {
+		ret = append(ret, structuredField{"help", n.Help})
+	}
+	for _, o := range n.Options {
+		if o.Name == "exclusive" {
+			ret = append(ret, structuredField{o.Name, o.Group})
+		} else {
+			ret = append(ret, structuredField{o.Name, true})
+		}
+	}
+	if len(n.Children) > 0 {
+		ret = append(ret, structuredField{"children", n.Children})
+	}
+	return ret
+}
+
+// isPlainLiteral returns whether a node is a literal that can be written as a string.
+func (n *StructuredNode) isPlainLiteral() bool {
+	return n.Type == "literal" && len(n.Words) == 1 && n.Help == "" && len(n.Options) == 0 && len(n.Children) == 0
+}
+
+// marshalJSON is json.Marshal without escaping '<', '>' and '&', which are common in helps.
+func marshalJSON(v interface{}) ([]byte, error) {
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// MarshalJSON writes a node with the keys in the order of the schema.
+func (n *StructuredNode) MarshalJSON() ([]byte, error) {
+	if n.isPlainLiteral() {
+		return marshalJSON(n.Words[0])
+	}
+	b := &bytes.Buffer{}
+	b.WriteString("{")
+	for i, f := range n.fields() {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := marshalJSON(f.key)
+		value, err := marshalJSON(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// MarshalYAML writes a node with the keys in the order of the schema.
+func (n *StructuredNode) MarshalYAML() (interface{}, error) {
+	if n.isPlainLiteral() {
+		return n.Words[0], nil
+	}
+	ret := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range n.fields() {
+		value := &yaml.Node{}
+		if err := value.Encode(f.value); err != nil {
+			return nil, err
+		}
+		ret.Content = append(ret.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, value)
+	}
+	return ret, nil
+}
@@ -0,0 +1,281 @@
+package parser
+
+import (
+	"encoding/json"
+	"github.com/omakoto/compromise/src/compromise"
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func dumpWithoutIDs(root *compast.Node) string {
+	// Node IDs depend on other tests.
+	return regexp.MustCompile(`#\d+ `).ReplaceAllString(root.Dump(true), "")
+}
+
+func TestStructured(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	text := "@command cmd :cmd\n" +
+		"@label :cmd\n" +
+		"  @switchloop \"^-\" :flags\n" +
+		"    -v|--verbose # Verbose\n" +
+		"      @once\n" +
+		"    -o # Output\n" +
+		"      @exclusive :out\n" +
+		"      @joined\n" +
+		"      @cand TakeFile\n" +
+		"    --\n" +
+		"      @break :flags\n" +
+		"  @switch\n" +
+		"    \"a b\" # Has a space\n" +
+		"      @any # Anything\n" +
+		"    \"x|y\"\n" +
+		"      @call :files push\n" +
+		"    set\n" +
+		"      @set key value\n" +
+		"      @if !env NO_X\n" +
+		"        @lines \"/etc/hosts\"\n" +
+		"      @finish\n" +
+		"@label :files $kind # Files to $kind\n" +
+		"  @loop\n" +
+		"    @cand TakeFile $kind\n"
+
+	jsonSpec := `[
+  {"type": "command", "name": "cmd", "label": "cmd"},
+  {"type": "label", "label": "cmd", "children": [
+    {"type": "switchloop", "pattern": "^-", "label": "flags", "children": [
+      {"type": "literal", "words": ["-v", "--verbose"], "help": "Verbose", "once": true},
+      {"type": "literal", "words": "-o", "help": "Output", "exclusive": ":out", "joined": true, "children": [
+        {"type": "cand", "func": "TakeFile"}
+      ]},
+      {"type": "literal", "words": "--", "children": [{"type": "break", "label": "flags"}]}
+    ]},
+    {"type": "switch", "children": [
+      {"type": "literal", "words": "a b", "help": "Has a space", "children": [{"type": "any", "help": "Anything"}]},
+      {"type": "literal", "words": "x|y", "children": [{"type": "call", "label": "files", "args": ["push"]}]},
+      {"type": "literal", "words": "set", "children": [
+        {"type": "set", "name": "key", "value": "value"},
+        {"type": "if", "condition": "!env", "args": ["NO_X"], "children": [{"type": "lines", "path": "/etc/hosts"}]},
+        {"type": "finish"}
+      ]}
+    ]}
+  ]},
+  {"type": "label", "label": "files", "params": ["$kind"], "help": "Files to $kind", "children": [
+    {"type": "loop", "children": [{"type": "cand", "func": "TakeFile", "args": "$kind"}]}
+  ]}
+]
+`
+	yamlSpec := `# Comments are allowed in YAML.
+- type: command
+  name: cmd
+  label: cmd
+- type: label
+  label: cmd
+  children:
+    - type: switchloop
+      pattern: ^-
+      label: flags
+      children:
+        - {type: literal, words: [-v, --verbose], help: Verbose, once: true}
+        - type: literal
+          words: -o
+          help: Output
+          exclusive: out
+          joined: true
+          children:
+            - {type: cand, func: TakeFile}
+        - type: literal
+          words: --
+          children: [{type: break, label: flags}]
+    - type: switch
+      children:
+        - {type: literal, words: a b, help: Has a space, children: [{type: any, help: Anything}]}
+        - type: literal
+          words: x|y
+          children: [{type: call, label: files, args: [push]}]
+        - type: literal
+          words: set
+          children:
+            - {type: set, name: key, value: value}
+            - type: if
+              condition: "!env"
+              args: [NO_X]
+              children: [{type: lines, path: /etc/hosts}]
+            - type: finish
+- type: label
+  label: files
+  params: [$kind]
+  help: Files to $kind
+  children:
+    - type: loop
+      children: [{type: cand, func: TakeFile, args: [$kind]}]
+`
+	jsonDirectives := compromise.NewDirectives().SetFilename("x").SetFormat("json")
+	expected := dumpWithoutIDs(Parse(text, d))
+	assert.Equal(t, expected, dumpWithoutIDs(Parse(jsonSpec, jsonDirectives)))
+	assert.Equal(t, expected, dumpWithoutIDs(Parse(yamlSpec, compromise.NewDirectives().SetFilename("x").SetFormat("yaml"))))
+
+	// "x|y" is a single word, and "a b" is quoted.
+	root := Parse(jsonSpec, jsonDirectives)
+	var words []string
+	for c := root.Child().Next().Child().Next().Child(); c != nil; c = c.Next() {
+		for _, cand := range c.AsCandidates() {
+			words = append(words, cand.Value())
+		}
+	}
+	assert.Equal(t, []string{"a b", "x|y", "set"}, words)
+}
+
+func TestStructuredLocations(t *testing.T) {
+	// The directives in the first line don't change the locations.
+	d := compromise.NewDirectives().SetFilename("x.json").SetStartLine(10)
+	spec := "//" + d.JSON() + "\n" +
+		"[\n" +
+		"  {\"type\": \"call\", \"label\": \"undefined\"}\n" +
+		"]\n"
+	assert.Equal(t, "undefined label :undefined at x.json:12:3", parseError(spec, compromise.ExtractDirectives(spec)))
+
+	d = compromise.NewDirectives().SetFilename("x.yaml")
+	spec = "- type: switch\n" +
+		"  children:\n" +
+		"    - a\n" +
+		"    - type: call\n" +
+		"      label: undefined\n"
+	assert.Equal(t, "undefined label :undefined at x.yaml:4:7", parseError(spec, d))
+}
+
+func TestStructuredErrors(t *testing.T) {
+	tests := []struct {
+		format   string
+		spec     string
+		expected string
+	}{
+		{"json", `[{"type": "swich"}]`, `unknown type "swich", which must be one of: any, break, call, cand, capture, command, continue, exec, finish, go_call, group, if, include, label, lines, literal, loop, set, switch, switchloop at x:1:2`},
+		{"json", `[{"words": "a"}]`, `a node must have a "type" at x:1:2`},
+		{"json", `[{"type": "switch", "patern": "^-"}]`, `unknown key "patern" for type "switch" at x:1:21`},
+		{"json", `[{"type": "any", "help": "a", "help": "b"}]`, `duplicate key "help" at x:1:31`},
+		{"json", `[{"type": "switch", "children": ["a", ["b"]]}]`, `a node must be an object or a string at x:1:39`},
+		{"json", `[{"type": "switch", "children": "a"}]`, `"children" must be a list of nodes at x:1:33`},
+		{"json", `[{"type": "literal", "words": {"a": "b"}}]`, `"words" must be a string at x:1:31`},
+		{"json", `[{"type": "literal", "words": "-a", "once": "yes"}]`, `"once" must be true or false at x:1:45`},
+		{"json", `[{"type": "set", "value": "x"}]`, `type "set" needs "name" with "value" at x:1:2`},
+		{"json", `[{"type": "cand", "args": ["x"]}]`, `type "cand" needs "func" with "args" at x:1:2`},
+		{"json", `[{"type": "cand"}]`, `@cand must be followed by a function name at x:1:2`},
+		{"json", `[{"type": "label"}]`, `@label must be followed by a label name (:name), and optionally parameters ($name) and a help string (#...) at x:1:2`},
+		{"json", `[{"type": "literal", "words": ["a b", "c"]}]`, `alternative "a b" of a literal has a special character at x:1:2`},
+		{"json", `[{"type": "switch", "children": [{"type": "command", "name": "a"}]}]`, `@command must be at the toplevel at x:1:34`},
+		{"json", `[{"type": "label", "label": "x"}, "a"]`, `only @label can appear at the top level at x:1:35`},
+		{"json", `[{"type": "label", "label": "x", "once": true}]`, `@once must be a child of a branch at x:1:34`},
+		{"json", `[{"type": "include", "path": "a.spec", "children": ["a"]}]`, `@include takes no children at x:1:2`},
+		{"json", `{"type": "switch"}`, `a structured spec must be a list of nodes at x:1:1`},
+		{"json", "[\n  {\"type\": \"switch\",, }\n]\n", `invalid JSON: invalid character ',' looking for beginning of value at x:2:21`},
+		{"json", "[\n  {\"type\": \"switch\"}\n]\n]\n", `unexpected data after the spec at x:4:1`},
+		{"yaml", "- type: switch\n  children:\n   - a\n  - b\n", `invalid YAML: did not find expected key at x:3:1`},
+	}
+	for _, v := range tests {
+		d := compromise.NewDirectives().SetFilename("x").SetFormat(v.format)
+		assert.Equal(t, v.expected, parseError(v.spec, d), "%q", v.spec)
+	}
+}
+
+func TestStructuredFormat(t *testing.T) {
+	tests := []struct {
+		d        *compromise.Directives
+		expected string
+	}{
+		{compromise.NewDirectives(), ""},
+		{compromise.NewDirectives().SetFilename("x.spec"), ""},
+		{compromise.NewDirectives().SetFilename("x.json"), "json"},
+		{compromise.NewDirectives().SetFilename("x.YAML"), "yaml"},
+		{compromise.NewDirectives().SetFilename("x.yml"), "yaml"},
+		{compromise.NewDirectives().SetFilename("x.json").SetFormat("text"), ""},
+		{compromise.NewDirectives().SetFilename("x.go").SetFormat("yaml"), "yaml"},
+		{compromise.ExtractDirectives("//{\"format\":\"json\"}\n[]\n"), "json"},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expected, StructuredFormat(v.d), "%s", v.d.JSON())
+	}
+	assert.PanicsWithValue(t, compromise.NewSpecErrorf(nil, "unsupported spec format \"xml\"; must be one of text, json or yaml"), func() {
+		StructuredFormat(compromise.NewDirectives().SetFormat("xml"))
+	})
+
+	// Text specs that look like YAML are still text specs.
+	for _, spec := range []string{"- # stdin\n-v\n", "-\n", "---\n"} {
+		assert.Contains(t, dumpWithoutIDs(Parse(spec, compromise.NewDirectives().SetFilename("x.spec"))), "Literal: literal=\"-", "%q", spec)
+	}
+}
+
+func TestStructuredInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("main.spec", "@include \"flags.json\"\n"+
+		"@command cmd\n"+
+		"@call :flags.flags\n"+
+		"@call :opts.opts\n")
+	write("flags.json", "[\n"+
+		"  {\"type\": \"include\", \"path\": \"options.yaml\", \"namespace\": \"opts\"},\n"+
+		"  {\"type\": \"label\", \"label\": \"flags\", \"children\": [\"-a\"]}\n"+
+		"]\n")
+	write("options.yaml", "- type: label\n"+
+		"  label: opts\n"+
+		"  children: [-b]\n")
+
+	filename := filepath.Join(dir, "main.spec")
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	root := Parse(string(data), compromise.NewDirectives().SetFilename(filename))
+
+	assert.Equal(t, "flags.json:3", callTarget(root, 3))
+	assert.Equal(t, "options.yaml:1", callTarget(root, 4))
+}
+
+func TestToStructured(t *testing.T) {
+	d := compromise.NewDirectives().SetFilename("x")
+	spec := "// Comments are lost.\n" +
+		"@command cmd\n" +
+		"@include \"lib.spec\" :lib\n" +
+		"@switch \"\" :sw\n" +
+		"  a|b # Help\n" +
+		"    @once\n" +
+		"  \"c|d\"\n" +
+		"  @call :lib.x arg\n" +
+		"@include \"other.spec\"\n"
+
+	actual, err := json.Marshal(ToStructured(spec, d))
+	assert.NoError(t, err)
+	assert.Equal(t, `[`+
+		`{"type":"command","name":"cmd"},`+
+		`{"type":"include","path":"lib.spec","namespace":"lib"},`+
+		`{"type":"switch","pattern":"","label":"sw","children":[`+
+		`{"type":"literal","words":["a","b"],"help":"Help","once":true},`+
+		`"c|d",`+
+		`{"type":"call","label":"lib.x","args":["arg"]}]},`+
+		`{"type":"include","path":"other.spec"}]`, string(actual))
+
+	// The locations are the same as the nodes in the tree.
+	nodes := ToStructured(spec, d)
+	assert.Equal(t, Location{"x", 4, 1}, nodes[2].Location)
+	assert.Equal(t, Location{"x", 5, 3}, nodes[2].Children[0].Location)
+}
+
+// TestStructuredBranchOptions checks that options are allowed on the same branches as text specs,
+// including the children of a label.
+func TestStructuredBranchOptions(t *testing.T) {
+	text := "-b\n" +
+		"  @once\n" +
+		"@label :x\n" +
+		"  -a\n" +
+		"    @once\n"
+	d := compromise.NewDirectives().SetFilename("x")
+	jsonSpec, err := json.Marshal(ToStructured(text, d))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"literal","words":"-b","once":true},`+
+		`{"type":"label","label":"x","children":[{"type":"literal","words":"-a","once":true}]}]`, string(jsonSpec))
+	assert.Equal(t, dumpWithoutIDs(Parse(text, d)),
+		dumpWithoutIDs(Parse(string(jsonSpec), compromise.NewDirectives().SetFilename("x").SetFormat("json"))))
+}
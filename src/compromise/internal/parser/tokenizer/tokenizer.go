@@ -68,6 +68,8 @@ type Tokenizer struct {
 	indexInLine int
 
 	directives *compromise.Directives
+
+	keepComments bool
 }
 
 // NewTokenizer creates a new Tokenizer that tokenizes a completion spec string.
@@ -85,6 +87,13 @@ func NewTokenizer(source string, d *compromise.Directives) *Tokenizer {
 	return t
 }
 
+// KeepComments makes the tokenizer return comments as TokenComment, rather than skipping them.
+// Used by the formatter.
+func (t *Tokenizer) KeepComments() *Tokenizer {
+	t.keepComments = true
+	return t
+}
+
 func (t *Tokenizer) SourceLocation() (string, int, int) {
 	return t.directives.Filename, t.scanner.Line + t.directives.StartLine - 1, t.scanner.Column
 }
@@ -115,6 +124,8 @@ func (t *Tokenizer) NextToken() *compast.Token {
 		t.current = r
 		return r
 	}
+	var err error
+	tokenType := compast.TokenLiteral
 	for {
 		tok := t.scanner.Scan()
 		if tok == scanner.EOF {
@@ -123,9 +134,11 @@ func (t *Tokenizer) NextToken() *compast.Token {
 		if tok != scanner.Comment {
 			break
 		}
+		if t.keepComments {
+			tokenType = compast.TokenComment
+			break
+		}
 	}
-	var err error
-	tokenType := compast.TokenLiteral
 
 	rawWord := t.scanner.TokenText()
 	word := rawWord
@@ -134,25 +147,27 @@ func (t *Tokenizer) NextToken() *compast.Token {
 	if len(rawWord) == 0 {
 		panic("zero-length spec detected.")
 	}
-	switch first {
-	case '@':
+	switch {
+	case tokenType == compast.TokenComment:
+		// Comments are returned as is.
+	case first == '@':
 		if len(rawWord) == 1 {
 			panic(compromise.NewSpecError(t, "missing function or command name after @"))
 		}
 		word = rawWord[1:]
 
 		tokenType = compast.TokenCommand
-	case ':':
+	case first == ':':
 		if len(rawWord) == 1 {
 			panic(compromise.NewSpecError(t, "missing label name after :"))
 		}
 		word = rawWord[1:]
 		tokenType = compast.TokenLabel
-	case '#':
+	case first == '#':
 		word = strings.Trim(rawWord[1:], " \t\r\n")
 		word = helpLineConcatRe.ReplaceAllString(word, "")
 		tokenType = compast.TokenHelp
-	case '"', '`':
+	case first == '"', first == '`':
 		word, err = strconv.Unquote(rawWord)
 		if err != nil {
 			panic(compromise.NewSpecError(t, "invalid string "+rawWord))
@@ -268,3 +283,20 @@ func (t *Tokenizer) MustHaveNoTokenInLine() {
 		panic(compromise.NewSpecError(tok, "excessive token detected"))
 	}
 }
+
+// NeedsQuote returns whether a literal needs to be quoted to be read as a single word.
+func NeedsQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	switch s[0] {
+	case '#', '"', '`', '/':
+		return true
+	}
+	for _, ch := range s {
+		if ch == '|' || ch == '@' || ch == ':' || unicode.IsSpace(ch) || !unicode.IsPrint(ch) {
+			return true
+		}
+	}
+	return false
+}
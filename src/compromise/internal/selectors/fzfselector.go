@@ -81,6 +81,10 @@ func (s *fzfSelector) Select(prefix string, candidates []compromise.Candidate) (
 	for i, c := range candidates {
 		bwr.WriteString(strconv.Itoa(i))
 		bwr.WriteString(" ")
+		if len(c.Group()) > 0 {
+			adapters.AddGroupString(c.Group(), bwr)
+			bwr.WriteString(" ")
+		}
 		adapters.AddDisplayString(c, bwr)
 		bwr.WriteByte(0)
 	}
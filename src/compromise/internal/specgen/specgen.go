@@ -0,0 +1,40 @@
+// Package specgen has helpers shared by the packages that generate specs, e.g. from Go flags,
+// --help output and completion scripts of other shells.
+package specgen
+
+import (
+	"strings"
+	"unicode"
+)
+
+// HelpComment returns the help part of a spec line, e.g. " # Write to FILE", or "" if the help is
+// empty.
+func HelpComment(help string) string {
+	// A help ends at the end of the line, and a trailing backslash would continue it.
+	help = strings.TrimRight(strings.Join(strings.Fields(help), " "), "\\")
+	if help == "" {
+		return ""
+	}
+	return " # " + help
+}
+
+// ValueSpec returns the spec for the value of a flag from the name of the value, e.g.
+// "@cand takeFile" for "FILE", or "@any" with the name as the help.
+func ValueSpec(name string) string {
+	// Check whole words, so e.g. "direction" and "profile" aren't taken as a dir or a file.
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	switch {
+	case words["dir"] || words["dirs"] || words["directory"]:
+		return "@cand takeDir"
+	case words["file"] || words["files"] || words["filename"] || words["path"]:
+		return "@cand takeFile"
+	case name != "":
+		return "@any # <" + name + ">"
+	}
+	return "@any"
+}
@@ -0,0 +1,130 @@
+// Package specwalk walks a spec tree in the order that words are matched, for the packages that
+// describe commands statically, such as completion scripts for other shells and references.
+package specwalk
+
+import (
+	"github.com/omakoto/compromise/src/compromise/compast"
+	"strings"
+)
+
+// Walker walks nodes, following @call's and @if's as if their children were inline.
+type Walker struct {
+	// OnRecursion is called, if set, with a @call of a label that's already being walked, which
+	// is skipped.
+	OnRecursion func(n *compast.Node)
+
+	// OnCondition is called, if set, with an @if, whose children are walked as if the condition
+	// always holds.
+	OnCondition func(n *compast.Node)
+
+	// Labels being called, to detect recursion.
+	calling map[*compast.Node]bool
+}
+
+// Call runs f with the nodes under the label that a @call calls, unless it's recursive.
+func (w *Walker) Call(n *compast.Node, f func(target *compast.Node)) {
+	target := n.GetLabeledNode(n.LabelWord(), n.Label())
+	if w.calling[target] {
+		if w.OnRecursion != nil {
+			w.OnRecursion(n)
+		}
+		return
+	}
+	if w.calling == nil {
+		w.calling = make(map[*compast.Node]bool)
+	}
+	w.calling[target] = true
+	defer delete(w.calling, target)
+	f(target.Child())
+}
+
+func (w *Walker) condition(n *compast.Node) {
+	if w.OnCondition != nil {
+		w.OnCondition(n)
+	}
+}
+
+// Sequence calls f with each node that matches words one after another, from n to the end of the
+// label.
+func (w *Walker) Sequence(n *compast.Node, f func(n *compast.Node)) {
+	for ; n != nil; n = n.Next() {
+		switch n.NodeType() {
+		case compast.NodeLabel:
+			// The end of a label.
+			return
+		case compast.NodeCall:
+			w.Call(n, func(target *compast.Node) {
+				w.Sequence(target, f)
+			})
+		case compast.NodeIf:
+			w.condition(n)
+			w.Sequence(n.Child(), f)
+		default:
+			f(n)
+		}
+	}
+}
+
+// Branches calls f with each branch of a switch, which n is the first child of, including the
+// ones in nested switches and loops.
+func (w *Walker) Branches(n *compast.Node, f func(n *compast.Node)) {
+	for ; n != nil; n = n.Next() {
+		switch n.NodeType() {
+		case compast.NodeLabel:
+			return
+		case compast.NodeSwitch, compast.NodeSwitchLoop, compast.NodeLoop:
+			w.Branches(n.Child(), f)
+		case compast.NodeCall:
+			w.Call(n, func(target *compast.Node) {
+				w.Branches(target, f)
+			})
+		case compast.NodeIf:
+			w.condition(n)
+			w.Branches(n.Child(), f)
+		default:
+			f(n)
+		}
+	}
+}
+
+// Flags calls f with each branch of a switch for flags, which n is the first child of, skipping
+// the nodes that don't match words, e.g. @finish. The branches are usually literal flags.
+func (w *Walker) Flags(n *compast.Node, f func(n *compast.Node)) {
+	w.Branches(n, func(n *compast.Node) {
+		switch n.NodeType() {
+		case compast.NodeCommand, compast.NodeGroup, compast.NodeFinish, compast.NodeBreak, compast.NodeContinue:
+		default:
+			f(n)
+		}
+	})
+}
+
+// IsFlagSwitch returns whether a switch is for flags, i.e. its pattern starts with "^-", or all
+// the literals start with "-".
+func IsFlagSwitch(n *compast.Node) bool {
+	if n.Pattern() != nil {
+		return strings.HasPrefix(n.Pattern().Word, "^-")
+	}
+	found := false
+	for c := n.Child(); c != nil; c = c.Next() {
+		if c.NodeType() != compast.NodeLiteral {
+			continue
+		}
+		for _, word := range Words(c) {
+			if !strings.HasPrefix(word, "-") {
+				return false
+			}
+		}
+		found = true
+	}
+	return found
+}
+
+// Words returns the words of a literal, e.g. "-o" and "--output" for "-o|--output".
+func Words(n *compast.Node) []string {
+	var ret []string
+	for _, c := range n.AsCandidates() {
+		ret = append(ret, c.Value())
+	}
+	return ret
+}
@@ -1,8 +1,12 @@
 package compromise
 
 import (
+	"fmt"
+	"github.com/omakoto/compromise/src/compromise/compdebug"
 	"github.com/omakoto/compromise/src/compromise/compenv"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 var (
@@ -29,6 +33,213 @@ func init() {
 	}
 }
 
-func StringMatches(s, prefix string) bool {
-	return strings.HasPrefix(converter(s), converter(prefix))
+// Matcher decides whether a candidate matches a word on the command line.
+type Matcher interface {
+	// Match returns whether s matches word, and if so, a score. The higher the score is,
+	// the better the match is.
+	Match(s, word string) (score int, ok bool)
+}
+
+// MatcherFunc is an adapter to use an ordinary function as a Matcher.
+type MatcherFunc func(s, word string) (score int, ok bool)
+
+func (f MatcherFunc) Match(s, word string) (score int, ok bool) {
+	return f(s, word)
+}
+
+// Scores returned by the built-in matchers.
+const (
+	PrefixScore     = 1000
+	SubstringScore  = 500
+	InitialismScore = 300
+	FuzzyScore      = 100
+)
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// PrefixMatch matches when word is a prefix of s. This is the default.
+func PrefixMatch(s, word string) (int, bool) {
+	if strings.HasPrefix(converter(s), converter(word)) {
+		return PrefixScore, true
+	}
+	return 0, false
+}
+
+// SubstringMatch matches when word is a substring of s. Matches closer to the start score higher.
+func SubstringMatch(s, word string) (int, bool) {
+	if score, ok := PrefixMatch(s, word); ok {
+		return score, ok
+	}
+	index := strings.Index(converter(s), converter(word))
+	if index < 0 {
+		return 0, false
+	}
+	return SubstringScore - minInt(index, SubstringScore-InitialismScore-1), true
+}
+
+// FuzzyMatch matches when word is a subsequence of s. Tighter matches score higher.
+func FuzzyMatch(s, word string) (int, bool) {
+	if score, ok := SubstringMatch(s, word); ok {
+		return score, ok
+	}
+	cs := []rune(converter(s))
+	cw := []rune(converter(word))
+
+	first, last := -1, -1
+	i := 0
+	for _, ch := range cw {
+		for i < len(cs) && cs[i] != ch {
+			i++
+		}
+		if i >= len(cs) {
+			return 0, false
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+		i++
+	}
+	gaps := last - first + 1 - len(cw)
+	return FuzzyScore - minInt(gaps, FuzzyScore-1), true
+}
+
+// InitialismMatch matches when each part of word is a prefix of each part of s, where parts are
+// separated by non-alphanumeric characters or camelCase humps. e.g. "sAD" and "sad" match
+// "start-activity-dump".
+func InitialismMatch(s, word string) (int, bool) {
+	if score, ok := PrefixMatch(s, word); ok {
+		return score, ok
+	}
+	// Leading non-alphanumeric characters (e.g. "--") must match as is.
+	sParts, sLead := splitWords(s)
+	wParts, wLead := splitWords(word)
+	if !strings.HasPrefix(converter(sLead), converter(wLead)) {
+		return 0, false
+	}
+	if len(wParts) == 0 {
+		return InitialismScore, len(wLead) == len(sLead)
+	}
+	if matchInitialism(strings.Join(wParts, ""), sParts) {
+		return InitialismScore, true
+	}
+	return 0, false
+}
+
+// matchInitialism returns whether word can be split into prefixes of consecutive parts.
+func matchInitialism(word string, parts []string) bool {
+	if len(word) == 0 {
+		return true
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	part := converter(parts[0])
+	for i := minInt(len(word), len(part)); i > 0; i-- {
+		if converter(word[:i]) == part[:i] && matchInitialism(word[i:], parts[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords splits s into alphanumeric words, separated by other characters or camelCase humps.
+// It also returns leading non-alphanumeric characters.
+func splitWords(s string) (words []string, lead string) {
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	start := strings.IndexFunc(s, isWordRune)
+	if start < 0 {
+		return nil, s
+	}
+	lead = s[:start]
+
+	current := make([]rune, 0)
+	var prev rune
+	for _, r := range s[start:] {
+		if !isWordRune(r) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+				current = current[:0]
+			}
+		} else {
+			if len(current) > 0 && unicode.IsUpper(r) && !unicode.IsUpper(prev) {
+				words = append(words, string(current))
+				current = current[:0]
+			}
+			current = append(current, r)
+		}
+		prev = r
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return
+}
+
+var (
+	matchers = map[string]Matcher{
+		"prefix":      MatcherFunc(PrefixMatch),
+		"substring":   MatcherFunc(SubstringMatch),
+		"fuzzy":       MatcherFunc(FuzzyMatch),
+		"subsequence": MatcherFunc(FuzzyMatch),
+		"initialism":  MatcherFunc(InitialismMatch),
+		"camelcase":   MatcherFunc(InitialismMatch),
+	}
+
+	// DefaultMatcher is the prefix matcher, which is used unless a spec or $COMPROMISE_MATCHER
+	// selects another one.
+	DefaultMatcher = matchers["prefix"]
+)
+
+// RegisterMatcher registers a Matcher with a name, which can be used with the "matcher" directive
+// or $COMPROMISE_MATCHER.
+func RegisterMatcher(name string, m Matcher) {
+	matchers[strings.ToLower(name)] = m
+}
+
+// GetMatcher returns a Matcher with a given name.
+func GetMatcher(name string) (Matcher, error) {
+	if m, ok := matchers[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	names := make([]string, 0, len(matchers))
+	for n := range matchers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown matcher %q; must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// SelectMatcher returns the Matcher specified by $COMPROMISE_MATCHER or the "matcher" directive,
+// or DefaultMatcher if neither is set.
+func SelectMatcher(d *Directives) Matcher {
+	m := DefaultMatcher
+	if d.Matcher != "" {
+		var err error
+		m, err = GetMatcher(d.Matcher)
+		if err != nil {
+			panic(NewSpecError(nil, err.Error()))
+		}
+	}
+	if compenv.Matcher != "" {
+		if em, err := GetMatcher(compenv.Matcher); err == nil {
+			m = em
+		} else {
+			compdebug.Warnf("$COMPROMISE_MATCHER: %s\n", err)
+		}
+	}
+	return m
+}
+
+// StringMatches returns whether s matches a word on the command line, using DefaultMatcher.
+func StringMatches(s, word string) bool {
+	_, ok := DefaultMatcher.Match(s, word)
+	return ok
 }
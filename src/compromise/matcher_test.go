@@ -0,0 +1,88 @@
+package compromise
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		matcher       func(s, word string) (int, bool)
+		s             string
+		word          string
+		expectedOk    bool
+		expectedScore int
+	}{
+		{PrefixMatch, "start-activity", "", true, PrefixScore},
+		{PrefixMatch, "start-activity", "st", true, PrefixScore},
+		{PrefixMatch, "start-activity", "START_", true, PrefixScore},
+		{PrefixMatch, "start-activity", "act", false, 0},
+
+		{SubstringMatch, "start-activity", "st", true, PrefixScore},
+		{SubstringMatch, "start-activity", "act", true, SubstringScore - 6},
+		{SubstringMatch, "start-activity", "sa", false, 0},
+
+		{FuzzyMatch, "start-activity", "st", true, PrefixScore},
+		{FuzzyMatch, "start-activity", "act", true, SubstringScore - 6},
+		{FuzzyMatch, "start-activity", "sa", true, FuzzyScore - 1},
+		{FuzzyMatch, "start-activity", "sy", true, FuzzyScore - 12},
+		{FuzzyMatch, "start-activity", "ys", false, 0},
+
+		{InitialismMatch, "start-activity-dump", "sta", true, PrefixScore},
+		{InitialismMatch, "start-activity-dump", "sad", true, InitialismScore},
+		{InitialismMatch, "start-activity-dump", "sAD", true, InitialismScore},
+		{InitialismMatch, "start-activity-dump", "stActD", true, InitialismScore},
+		{InitialismMatch, "start-activity-dump", "sd", false, 0},
+		{InitialismMatch, "--start-activity", "--sa", true, InitialismScore},
+		{InitialismMatch, "--start-activity", "sa", true, InitialismScore},
+		{InitialismMatch, "--start-activity", "-+sa", false, 0},
+		{InitialismMatch, "startActivityDump", "sad", true, InitialismScore},
+	}
+	for _, v := range tests {
+		score, ok := v.matcher(v.s, v.word)
+		assert.Equal(t, v.expectedOk, ok, "%q %q", v.s, v.word)
+		assert.Equal(t, v.expectedScore, score, "%q %q", v.s, v.word)
+	}
+}
+
+func TestGetMatcher(t *testing.T) {
+	for _, name := range []string{"prefix", "substring", "fuzzy", "subsequence", "initialism", "camelCase"} {
+		m, err := GetMatcher(name)
+		assert.Nil(t, err, name)
+		assert.NotNil(t, m, name)
+	}
+	_, err := GetMatcher("nonexistent")
+	assert.NotNil(t, err)
+}
+
+func TestSelectMatcher(t *testing.T) {
+	// Matchers selected for different specs don't affect each other.
+	fuzzy := SelectMatcher(NewDirectives().SetMatcher("fuzzy"))
+	prefix := SelectMatcher(NewDirectives())
+	c := NewCandidate().SetValue("start-activity")
+
+	_, ok := c.MatchScore(fuzzy, "sy")
+	assert.True(t, ok)
+	_, ok = c.MatchScore(prefix, "sy")
+	assert.False(t, ok)
+	assert.Equal(t, 1, len(GetCandidates(StrictCandidates(c), fuzzy, "sy")))
+	assert.Equal(t, 0, len(GetCandidates(StrictCandidates(c), prefix, "sy")))
+}
+
+// prefixOnlyList is a CandidateList that doesn't support other matchers.
+type prefixOnlyList struct {
+	CandidateList
+}
+
+func TestGetCandidates(t *testing.T) {
+	fuzzy := SelectMatcher(NewDirectives().SetMatcher("fuzzy"))
+	l := StrictCandidates(NewCandidate().SetValue("start-activity"))
+
+	assert.Equal(t, 0, len(l.GetCandidate("sy")))
+	assert.Equal(t, 1, len(l.GetCandidate("sta")))
+	assert.Equal(t, 1, len(GetCandidates(l, fuzzy, "sy")))
+
+	// Lists without GetCandidateWithMatcher only match prefixes.
+	assert.Equal(t, 0, len(GetCandidates(prefixOnlyList{l}, fuzzy, "sy")))
+	assert.Equal(t, 1, len(GetCandidates(prefixOnlyList{l}, fuzzy, "sta")))
+}
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# Simple smoke test -- make sure the output is readable by Fish.
+
+cd "${0%/*}/.."
+
+if ! type fish >&/dev/null ; then
+    echo "fish not found; skipping."
+    exit 0
+fi
+
+echo "Loading in fish..."
+COMPROMISE_SHELL=fish go run ./src/cmds/compromise-adb/adb.go | fish --no-config |& grep '^Installed completion'